@@ -0,0 +1,237 @@
+// Package audit keeps a log of every change of a book. Wrap decorates a
+// store.Repository so that each create, update and delete is recorded with
+// who made it, through which route and which fields changed, whichever API
+// made the change.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/logging"
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Actions recorded in the log
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionPurge   = "purge"
+)
+
+// anonymous is recorded as the actor of changes made without credentials
+const anonymous = "anonymous"
+
+// Source tells who is changing books, from where and through which route
+type Source struct {
+	Actor    string // user name or API key; "" for anonymous callers
+	Route    string // like "PUT /api/v1/books/:id"
+	ClientIP string // address of the caller, behind trusted proxies
+}
+
+// sourceKey is the context key of the Source
+type sourceKey struct{}
+
+// WithSource returns ctx carrying src, which is recorded with the changes
+// made with the context
+func WithSource(ctx context.Context, src Source) context.Context {
+	return context.WithValue(ctx, sourceKey{}, src)
+}
+
+// repository records the book changes made through the embedded Repository
+type repository struct {
+	store.Repository
+}
+
+// Wrap returns r recording every book change in its audit log. Entries are
+// written with the context of the change, so changes made in a transaction
+// are only logged if it commits.
+func Wrap(r store.Repository) store.Repository {
+	return &repository{r}
+}
+
+// record writes an entry for a change of book id. A failure is logged but
+// does not undo the change.
+func (r *repository) record(ctx context.Context, action, id string, before, after map[string]string) {
+	src, _ := ctx.Value(sourceKey{}).(Source)
+	if src.Actor == "" {
+		src.Actor = anonymous
+	}
+	entry := models.AuditEntry{
+		BookID:    id,
+		Action:    action,
+		Actor:     src.Actor,
+		Route:     src.Route,
+		ClientIP:  src.ClientIP,
+		RequestID: logging.RequestID(ctx),
+		Time:      time.Now().UTC(),
+		Before:    before,
+		After:     after,
+	}
+	if err := r.Repository.InsertAuditEntry(ctx, &entry); err != nil {
+		slog.ErrorContext(ctx, "cannot write audit entry", "action", action, "book", id, "error", err)
+	}
+}
+
+// bookFields returns the fields of book keyed by API field name
+func bookFields(book models.BookStore) map[string]string {
+	return map[string]string{
+		"id":      book.ID,
+		"title":   book.BookName,
+		"author":  book.BookAuthor,
+		"pages":   book.BookPages,
+		"edition": book.BookEdition,
+		"year":    book.BookYear,
+	}
+}
+
+// diff returns the fields that differ between before and after, with their
+// old and new values
+func diff(before, after models.BookStore) (map[string]string, map[string]string) {
+	old, changed := map[string]string{}, map[string]string{}
+	oldFields := bookFields(before)
+	for name, value := range bookFields(after) {
+		if oldFields[name] != value {
+			old[name], changed[name] = oldFields[name], value
+		}
+	}
+	return old, changed
+}
+
+// CreateBook stores a new book and records its fields
+func (r *repository) CreateBook(ctx context.Context, book models.BookStore) error {
+	if err := r.Repository.CreateBook(ctx, book); err != nil {
+		return err
+	}
+	r.record(ctx, ActionCreate, book.ID, nil, bookFields(book))
+	return nil
+}
+
+// CreateBooks stores new books and records each stored one
+func (r *repository) CreateBooks(ctx context.Context, books []models.BookStore) ([]error, error) {
+	errs, err := r.Repository.CreateBooks(ctx, books)
+	if err != nil {
+		return errs, err
+	}
+	for i, book := range books {
+		if errs[i] == nil {
+			r.record(ctx, ActionCreate, book.ID, nil, bookFields(book))
+		}
+	}
+	return errs, nil
+}
+
+// UpdateBook updates a book and records the fields that changed. The book
+// is read first to learn their previous values.
+func (r *repository) UpdateBook(ctx context.Context, id string, revision int64, fields map[string]string) (models.BookStore, error) {
+	before, err := r.Repository.GetBook(ctx, id)
+	if err != nil {
+		return before, err
+	}
+	book, err := r.Repository.UpdateBook(ctx, id, revision, fields)
+	if err != nil {
+		return book, err
+	}
+	old, changed := diff(before, book)
+	r.record(ctx, ActionUpdate, id, old, changed)
+	return book, nil
+}
+
+// SetCover replaces the cover of a book and records the images, by type
+// and size
+func (r *repository) SetCover(ctx context.Context, id string, cover models.Cover, data []byte, thumbnails map[string][]byte) (models.BookStore, error) {
+	before, err := r.Repository.GetBook(ctx, id)
+	if err != nil {
+		return before, err
+	}
+	book, err := r.Repository.SetCover(ctx, id, cover, data, thumbnails)
+	if err != nil {
+		return book, err
+	}
+	r.record(ctx, ActionUpdate, id, map[string]string{"cover": describeCover(before.Cover)}, map[string]string{"cover": describeCover(book.Cover)})
+	return book, nil
+}
+
+// describeCover summarizes cover for the audit log, "" if there is none
+func describeCover(cover *models.Cover) string {
+	if cover == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s, %d bytes", cover.ContentType, cover.Size)
+}
+
+// UpdateBooks updates the books matching q and records the fields that
+// changed in each of them
+func (r *repository) UpdateBooks(ctx context.Context, q store.BookQuery, fields map[string]string) (int64, []models.BookStore, error) {
+	q.Page = 0
+	matching, _, err := r.Repository.ListBooks(ctx, q)
+	if err != nil {
+		return 0, nil, err
+	}
+	matched, books, err := r.Repository.UpdateBooks(ctx, q, fields)
+	if err != nil {
+		return matched, books, err
+	}
+	byOID := make(map[primitive.ObjectID]models.BookStore, len(matching))
+	for _, book := range matching {
+		byOID[book.MongoID] = book
+	}
+	for _, book := range books {
+		old, changed := diff(byOID[book.MongoID], book)
+		r.record(ctx, ActionUpdate, book.ID, old, changed)
+	}
+	return matched, books, nil
+}
+
+// DeleteBook moves a book to the trash and records its fields
+func (r *repository) DeleteBook(ctx context.Context, id string) error {
+	book, err := r.Repository.GetBook(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.Repository.DeleteBook(ctx, id); err != nil {
+		return err
+	}
+	r.record(ctx, ActionDelete, id, bookFields(book), nil)
+	return nil
+}
+
+// DeleteBooks moves the books matching q to the trash and records each
+func (r *repository) DeleteBooks(ctx context.Context, q store.BookQuery) ([]models.BookStore, error) {
+	books, err := r.Repository.DeleteBooks(ctx, q)
+	if err != nil {
+		return books, err
+	}
+	for _, book := range books {
+		r.record(ctx, ActionDelete, book.ID, bookFields(book), nil)
+	}
+	return books, nil
+}
+
+// RestoreBook takes a book out of the trash and records its fields
+func (r *repository) RestoreBook(ctx context.Context, id string) (models.BookStore, error) {
+	book, err := r.Repository.RestoreBook(ctx, id)
+	if err != nil {
+		return book, err
+	}
+	r.record(ctx, ActionRestore, id, nil, bookFields(book))
+	return book, nil
+}
+
+// PurgeBooks removes books in the trash for good and records each
+func (r *repository) PurgeBooks(ctx context.Context, q store.BookQuery) ([]models.BookStore, error) {
+	books, err := r.Repository.PurgeBooks(ctx, q)
+	if err != nil {
+		return books, err
+	}
+	for _, book := range books {
+		r.record(ctx, ActionPurge, book.ID, bookFields(book), nil)
+	}
+	return books, nil
+}
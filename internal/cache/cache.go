@@ -0,0 +1,116 @@
+// Package cache keeps the JSON responses of the read endpoints so that
+// repeated requests do not reach the database. Entries expire after a TTL and
+// are dropped explicitly whenever a book changes.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTTL is how long entries are kept unless CACHE_TTL is set
+const DefaultTTL = time.Minute
+
+// Cache stores encoded responses of GET /api/v1/books/:id, keyed by book ID,
+// and of GET /api/v1/books, keyed by the normalized query string. Failures
+// of the cache are logged and reported as misses, never to the client.
+//
+// A response read from the database just before a concurrent change may be
+// stored after that change invalidated the cache; the TTL bounds how long
+// such an entry is served.
+type Cache interface {
+	GetBook(ctx context.Context, id string) ([]byte, bool)
+	SetBook(ctx context.Context, id string, data []byte)
+	GetList(ctx context.Context, query string) ([]byte, bool)
+	SetList(ctx context.Context, query string, data []byte)
+	// Invalidate drops the entry of the book id and every list, since any
+	// list may include the book. An empty id, as reported for deletes whose
+	// book is unknown, drops every book.
+	Invalidate(ctx context.Context, id string)
+	// Stats reports the lookups of this process
+	Stats() Stats
+}
+
+// Stats counts the lookups of a cache, as reported by GET /api/v1/cache/stats
+type Stats struct {
+	Backend string  `json:"backend"`
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"` // hits per lookup, 0 before the first lookup
+	Entries int     `json:"entries,omitempty"`
+}
+
+// counters tracks the hits and misses of a cache
+type counters struct {
+	hits, misses atomic.Int64
+}
+
+// record counts a lookup and passes its result through
+func (n *counters) record(data []byte, ok bool) ([]byte, bool) {
+	if ok {
+		n.hits.Add(1)
+	} else {
+		n.misses.Add(1)
+	}
+	return data, ok
+}
+
+// stats returns the counted lookups
+func (n *counters) stats(backend string) Stats {
+	s := Stats{Backend: backend, Hits: n.hits.Load(), Misses: n.misses.Load()}
+	if total := s.Hits + s.Misses; total > 0 {
+		s.HitRate = float64(s.Hits) / float64(total)
+	}
+	return s
+}
+
+// ttlFromEnv reads CACHE_TTL
+func ttlFromEnv() (time.Duration, error) {
+	v := os.Getenv("CACHE_TTL")
+	if v == "" {
+		return DefaultTTL, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid CACHE_TTL %q: must be a positive duration like 30s", v)
+	}
+	return d, nil
+}
+
+// FromEnv returns the cache configured in the environment and a function
+// releasing it, or a nil Cache if caching is disabled. REDIS_URI selects
+// Redis; otherwise CACHE_BACKEND=memory selects an in-process cache holding
+// up to CACHE_MAX_ENTRIES (default 1000) entries per route.
+func FromEnv(ctx context.Context) (Cache, func(), error) {
+	rc, err := RedisFromEnv(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rc != nil {
+		return rc, rc.Close, nil
+	}
+	switch backend := os.Getenv("CACHE_BACKEND"); backend {
+	case "":
+		return nil, func() {}, nil
+	case "memory":
+		ttl, err := ttlFromEnv()
+		if err != nil {
+			return nil, nil, err
+		}
+		maxEntries := DefaultMaxEntries
+		if v := os.Getenv("CACHE_MAX_ENTRIES"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return nil, nil, fmt.Errorf("invalid CACHE_MAX_ENTRIES %q: must be a positive integer", v)
+			}
+			maxEntries = n
+		}
+		return NewMemory(ttl, maxEntries), func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown CACHE_BACKEND %q: use memory, or set REDIS_URI for Redis", backend)
+	}
+}
@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/store"
+)
+
+// DefaultMaxEntries is how many entries the in-process cache keeps per route
+// unless CACHE_MAX_ENTRIES is set
+const DefaultMaxEntries = 1000
+
+// entry is a cached response
+type entry struct {
+	data    []byte
+	expires time.Time
+}
+
+// Memory is a Cache in the memory of a single process, for deployments
+// without Redis. Since the books are changed by other services, it has to
+// be invalidated from the change stream of the store; see Follow.
+type Memory struct {
+	mu         sync.Mutex
+	books      map[string]entry // keyed by book ID
+	lists      map[string]entry // keyed by query string
+	ttl        time.Duration
+	maxEntries int
+	counters
+}
+
+var _ Cache = (*Memory)(nil)
+
+// NewMemory returns an empty cache keeping entries for ttl and at most
+// maxEntries entries per route
+func NewMemory(ttl time.Duration, maxEntries int) *Memory {
+	return &Memory{
+		books:      map[string]entry{},
+		lists:      map[string]entry{},
+		ttl:        ttl,
+		maxEntries: maxEntries,
+	}
+}
+
+// get returns the unexpired entry of key in m
+func (c *Memory) get(m map[string]entry, key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := m[key]
+	if ok && time.Now().After(e.expires) {
+		delete(m, key)
+		ok = false
+	}
+	return c.record(e.data, ok)
+}
+
+// set stores data under key in m. A full route first drops its expired
+// entries and, if that is not enough, an arbitrary one.
+func (c *Memory) set(m map[string]entry, key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if _, ok := m[key]; !ok && len(m) >= c.maxEntries {
+		for k, e := range m {
+			if now.After(e.expires) {
+				delete(m, k)
+			}
+		}
+		for k := range m {
+			if len(m) < c.maxEntries {
+				break
+			}
+			delete(m, k)
+		}
+	}
+	m[key] = entry{data: data, expires: now.Add(c.ttl)}
+}
+
+// GetBook returns the cached response of book id
+func (c *Memory) GetBook(ctx context.Context, id string) ([]byte, bool) {
+	return c.get(c.books, id)
+}
+
+// SetBook caches the response of book id
+func (c *Memory) SetBook(ctx context.Context, id string, data []byte) {
+	c.set(c.books, id, data)
+}
+
+// GetList returns the cached response of the list query
+func (c *Memory) GetList(ctx context.Context, query string) ([]byte, bool) {
+	return c.get(c.lists, query)
+}
+
+// SetList caches the response of the list query
+func (c *Memory) SetList(ctx context.Context, query string, data []byte) {
+	c.set(c.lists, query, data)
+}
+
+// Invalidate drops book id, or every book if id is empty, and all lists
+func (c *Memory) Invalidate(ctx context.Context, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id == "" {
+		c.books = map[string]entry{}
+	} else {
+		delete(c.books, id)
+	}
+	c.lists = map[string]entry{}
+}
+
+// Stats reports the lookups and the number of cached entries
+func (c *Memory) Stats() Stats {
+	c.mu.Lock()
+	entries := len(c.books) + len(c.lists)
+	c.mu.Unlock()
+	s := c.stats("memory")
+	s.Entries = entries
+	return s
+}
+
+// Follow invalidates the cache for every change reported by events until
+// the channel is closed
+func (c *Memory) Follow(events <-chan store.BookEvent) {
+	for ev := range events {
+		c.Invalidate(context.Background(), ev.Book.ID)
+	}
+}
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// bookKey prefixes the entries of single books
+	bookKey = "bookstore:book:"
+	// listVersionKey is bumped on every change. List entries embed the
+	// version they were stored under, so bumping it retires all of them at
+	// once; the stale entries expire on their own.
+	listVersionKey = "bookstore:books:version"
+	listKey        = "bookstore:books:"
+)
+
+// Redis is a Cache shared by every replica of the GET service
+type Redis struct {
+	client *redis.Client
+	ttl    time.Duration
+	counters
+}
+
+var _ Cache = (*Redis)(nil)
+
+// ConnectRedis connects to the Redis server at uri, e.g.
+// redis://:password@redis:6379/0, and keeps entries for ttl
+func ConnectRedis(ctx context.Context, uri string, ttl time.Duration) (*Redis, error) {
+	opts, err := redis.ParseURL(uri)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	slog.Info("caching responses in Redis", "addr", opts.Addr, "ttl", ttl)
+	return &Redis{client: client, ttl: ttl}, nil
+}
+
+// RedisFromEnv connects to the Redis server at REDIS_URI, keeping entries
+// for CACHE_TTL (default one minute). It returns nil if REDIS_URI is not set.
+func RedisFromEnv(ctx context.Context) (*Redis, error) {
+	uri := os.Getenv("REDIS_URI")
+	if uri == "" {
+		return nil, nil
+	}
+	ttl, err := ttlFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return ConnectRedis(ctx, uri, ttl)
+}
+
+// get returns the value of key; missing keys and errors are misses
+func (r *Redis) get(ctx context.Context, key string) ([]byte, bool) {
+	data, err := r.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			slog.ErrorContext(ctx, "cannot read from Redis", "key", key, "error", err)
+		}
+		return nil, false
+	}
+	return data, true
+}
+
+// set stores data under key for the TTL of the cache
+func (r *Redis) set(ctx context.Context, key string, data []byte) {
+	if err := r.client.Set(ctx, key, data, r.ttl).Err(); err != nil {
+		slog.ErrorContext(ctx, "cannot write to Redis", "key", key, "error", err)
+	}
+}
+
+// listVersion returns the current version of the cached lists
+func (r *Redis) listVersion(ctx context.Context) (string, error) {
+	v, err := r.client.Get(ctx, listVersionKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return "0", nil
+	}
+	return v, err
+}
+
+// GetBook returns the cached response of book id
+func (r *Redis) GetBook(ctx context.Context, id string) ([]byte, bool) {
+	return r.record(r.get(ctx, bookKey+id))
+}
+
+// SetBook caches the response of book id
+func (r *Redis) SetBook(ctx context.Context, id string, data []byte) {
+	r.set(ctx, bookKey+id, data)
+}
+
+// GetList returns the cached response of the list query
+func (r *Redis) GetList(ctx context.Context, query string) ([]byte, bool) {
+	v, err := r.listVersion(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "cannot read from Redis", "key", listVersionKey, "error", err)
+		return r.record(nil, false)
+	}
+	return r.record(r.get(ctx, listKey+v+":"+query))
+}
+
+// SetList caches the response of the list query
+func (r *Redis) SetList(ctx context.Context, query string, data []byte) {
+	v, err := r.listVersion(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "cannot read from Redis", "key", listVersionKey, "error", err)
+		return
+	}
+	r.set(ctx, listKey+v+":"+query, data)
+}
+
+// Invalidate drops book id and retires all cached lists. Books are only
+// dropped by ID: the write services always know the changed book.
+func (r *Redis) Invalidate(ctx context.Context, id string) {
+	_, err := r.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		if id != "" {
+			p.Del(ctx, bookKey+id)
+		}
+		p.Incr(ctx, listVersionKey)
+		return nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "cannot invalidate cache", "book", id, "error", err)
+	}
+}
+
+// Stats reports the lookups of this process; the entries are shared with
+// other processes and not counted
+func (r *Redis) Stats() Stats {
+	return r.stats("redis")
+}
+
+// Ping reports whether the Redis server can be reached
+func (r *Redis) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// Close disconnects from Redis
+func (r *Redis) Close() {
+	if err := r.client.Close(); err != nil {
+		slog.Error("cannot close Redis connection", "error", err)
+	}
+}
@@ -0,0 +1,483 @@
+// Package config loads the settings every service shares: where it listens,
+// how it logs and which database it uses. They are read from an optional
+// YAML file named by CONFIG_FILE and from environment variables, which take
+// precedence over the file, and are checked before the service starts so
+// that a typo stops it with a message instead of a surprise later on.
+//
+// A file with every setting, all of which are optional:
+//
+//	port: "3001"        # 0 for a free port picked by the system
+//	bind_addr: 127.0.0.1 # every interface if empty
+//	socket: /run/bookstore/api.sock # a Unix socket instead of the port
+//	log:
+//	  level: info        # debug, info, warn or error
+//	  format: text       # text or json
+//	database:
+//	  backend: mongo     # mongo, postgres, sqlite or memory
+//	  uri: mongodb://localhost:27017/exercise-1?authSource=admin
+//	  name: exercise-1   # MongoDB database
+//	  collection: information # MongoDB collection of the books
+//	  connect_retry: 30s
+//	  max_results: 10000
+//	  max_books: 0       # how many books may be stored, 0 for any number
+//	  seed_file: books.yaml # the books stored at start, the examples if empty
+//	tls:
+//	  cert_file: /etc/bookstore/tls.crt
+//	  key_file: /etc/bookstore/tls.key
+//	  # or certificates from Let's Encrypt, with the service on port 443
+//	  autocert_hosts: [books.example.com]
+//	  autocert_cache: autocert # where they are kept
+//	  autocert_email: admin@example.com
+//	  acme_directory: https://acme-staging-v02.api.letsencrypt.org/directory
+//	http:
+//	  hsts_max_age: 8760h # 0 to send no Strict-Transport-Security header
+//	  https_redirect: false
+//	  cors_allowed_origins: [https://books.example.com] # or * for every origin
+//	  cors_allowed_methods: [GET, POST] # those of the API if empty
+//	  cors_allowed_headers: [Authorization, Content-Type]
+//	  compression_level: 5 # 1 to 9, 0 to send responses uncompressed
+//	  body_limit: 1MiB # of requests, like 512KB or 2MB
+//	  request_timeout: 10s # after which the context of a request is cancelled
+//	  trusted_proxies: [10.0.0.0/8, 192.0.2.1] # or [none]; private networks if empty
+//	admin:
+//	  username: admin    # both or neither; without them there is no admin
+//	  password: secret
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/server"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	units "github.com/labstack/gommon/bytes"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the shared settings of a service
+type Config struct {
+	// Port is the TCP port the service listens on (PORT), on the interface
+	// with the address BindAddr (BIND_ADDR) or every interface
+	Port     string `yaml:"port"`
+	BindAddr string `yaml:"bind_addr"`
+	// Socket is the path of the Unix domain socket the service listens on
+	// instead of the port, if set (SOCKET_PATH)
+	Socket string   `yaml:"socket"`
+	Log    Log      `yaml:"log"`
+	DB     Database `yaml:"database"`
+	TLS    TLS      `yaml:"tls"`
+	HTTP   HTTP     `yaml:"http"`
+	Admin  Admin    `yaml:"admin"`
+}
+
+// Log sets up the logger, see logging.Setup
+type Log struct {
+	Level  string `yaml:"level"`  // LOG_LEVEL
+	Format string `yaml:"format"` // LOG_FORMAT
+}
+
+// Database selects the storage backend, see store.Config
+type Database struct {
+	Backend      string        `yaml:"backend"`       // STORAGE_BACKEND
+	URI          string        `yaml:"uri"`           // DATABASE_URI, or SQLITE_PATH for SQLite
+	Name         string        `yaml:"name"`          // DB_NAME
+	Collection   string        `yaml:"collection"`    // DB_COLLECTION
+	ConnectRetry time.Duration `yaml:"connect_retry"` // DB_CONNECT_RETRY
+	MaxResults   int64         `yaml:"max_results"`   // MAX_RESULTS
+	MaxBooks     int64         `yaml:"max_books"`     // MAX_BOOKS
+	SeedFile     string        `yaml:"seed_file"`     // SEED_FILE, see store.ReadSeedFile
+}
+
+// TLS names the certificate the service serves HTTPS with, or the hosts it
+// obtains certificates for from Let's Encrypt, see server.Autocert. Without
+// either it serves plain HTTP.
+type TLS struct {
+	CertFile      string   `yaml:"cert_file"`      // TLS_CERT_FILE
+	KeyFile       string   `yaml:"key_file"`       // TLS_KEY_FILE
+	AutocertHosts []string `yaml:"autocert_hosts"` // TLS_AUTOCERT_HOSTS, separated by commas
+	AutocertCache string   `yaml:"autocert_cache"` // TLS_AUTOCERT_CACHE
+	AutocertEmail string   `yaml:"autocert_email"` // TLS_AUTOCERT_EMAIL
+	ACMEDirectory string   `yaml:"acme_directory"` // TLS_ACME_DIRECTORY, Let's Encrypt if empty
+}
+
+// HTTP sets up what every service adds to its responses, see server.Options
+type HTTP struct {
+	HSTSMaxAge    time.Duration `yaml:"hsts_max_age"`   // HSTS_MAX_AGE
+	HTTPSRedirect bool          `yaml:"https_redirect"` // HTTPS_REDIRECT
+	// The pages that may call the API from other origins, separated by
+	// commas in the environment
+	CORSAllowedOrigins []string      `yaml:"cors_allowed_origins"` // CORS_ALLOWED_ORIGINS
+	CORSAllowedMethods []string      `yaml:"cors_allowed_methods"` // CORS_ALLOWED_METHODS
+	CORSAllowedHeaders []string      `yaml:"cors_allowed_headers"` // CORS_ALLOWED_HEADERS
+	CompressionLevel   int           `yaml:"compression_level"`    // COMPRESSION_LEVEL
+	BodyLimit          ByteSize      `yaml:"body_limit"`           // BODY_LIMIT
+	RequestTimeout     time.Duration `yaml:"request_timeout"`      // REQUEST_TIMEOUT
+	// The addresses and CIDR ranges of the proxies in front of the service,
+	// or just none, separated by commas in the environment
+	TrustedProxies []string `yaml:"trusted_proxies"` // TRUSTED_PROXIES
+
+	// trustedNets are TrustedProxies as parsed by validate
+	trustedNets []*net.IPNet
+}
+
+// Admin is the built-in administrator, who logs in to the API and to the
+// admin pages of the frontend. It is disabled if both are empty.
+type Admin struct {
+	Username string `yaml:"username"` // ADMIN_USERNAME
+	Password string `yaml:"password"` // ADMIN_PASSWORD
+}
+
+// Enabled reports whether the administrator has credentials
+func (a Admin) Enabled() bool {
+	return a.Username != "" && a.Password != ""
+}
+
+// ByteSize is a size in bytes, written like 512KB or 2MB
+type ByteSize int64
+
+// UnmarshalText reads a size like 512KB, 2MB or 1048576
+func (s *ByteSize) UnmarshalText(text []byte) error {
+	n, err := units.Parse(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid size %q: must look like 512KB or 2MB", text)
+	}
+	*s = ByteSize(n)
+	return nil
+}
+
+// Load returns the settings of a service listening on port unless told
+// otherwise: the defaults, overridden by the file named by CONFIG_FILE, if
+// any, overridden by the environment. All problems found are reported at
+// once.
+func Load(port string) (Config, error) {
+	conf := Config{
+		Port: port,
+		DB: Database{
+			Name:         store.DefaultDatabase,
+			Collection:   store.DefaultCollection,
+			ConnectRetry: store.DefaultConnectRetry,
+		},
+		TLS: TLS{AutocertCache: "autocert"},
+		HTTP: HTTP{
+			HSTSMaxAge:       server.DefaultHSTSMaxAge,
+			CompressionLevel: server.DefaultCompressionLevel,
+			BodyLimit:        server.DefaultBodyLimit,
+			RequestTimeout:   server.DefaultRequestTimeout,
+		},
+	}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := conf.readFile(path); err != nil {
+			return conf, err
+		}
+	}
+	errs := conf.readEnv()
+	if conf.DB.URI == "" {
+		switch conf.DB.Backend {
+		case "", store.BackendMongo:
+			slog.Info("DATABASE_URI not set, using default localhost URI")
+			conf.DB.URI = "mongodb://localhost:27017/exercise-1?authSource=admin"
+		case store.BackendSQLite:
+			slog.Info("SQLITE_PATH not set, using bookstore.db")
+			conf.DB.URI = "bookstore.db"
+		}
+	}
+	errs = append(errs, conf.validate()...)
+	if len(errs) > 0 {
+		return conf, fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return conf, nil
+}
+
+// readFile reads the settings in the YAML file at path over conf. Keys the
+// file should not have are rejected, as they are most likely misspelt.
+func (conf *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read CONFIG_FILE: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(conf); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid CONFIG_FILE %s: %w", path, err)
+	}
+	return nil
+}
+
+// readEnv reads the settings set in the environment over conf
+func (conf *Config) readEnv() []error {
+	var errs []error
+	for name, field := range map[string]*string{
+		"PORT":               &conf.Port,
+		"BIND_ADDR":          &conf.BindAddr,
+		"SOCKET_PATH":        &conf.Socket,
+		"LOG_LEVEL":          &conf.Log.Level,
+		"LOG_FORMAT":         &conf.Log.Format,
+		"STORAGE_BACKEND":    &conf.DB.Backend,
+		"DB_NAME":            &conf.DB.Name,
+		"DB_COLLECTION":      &conf.DB.Collection,
+		"SEED_FILE":          &conf.DB.SeedFile,
+		"TLS_CERT_FILE":      &conf.TLS.CertFile,
+		"TLS_KEY_FILE":       &conf.TLS.KeyFile,
+		"TLS_AUTOCERT_CACHE": &conf.TLS.AutocertCache,
+		"TLS_AUTOCERT_EMAIL": &conf.TLS.AutocertEmail,
+		"TLS_ACME_DIRECTORY": &conf.TLS.ACMEDirectory,
+		"ADMIN_USERNAME":     &conf.Admin.Username,
+		"ADMIN_PASSWORD":     &conf.Admin.Password,
+	} {
+		if v := os.Getenv(name); v != "" {
+			*field = v
+		}
+	}
+	for name, field := range map[string]*[]string{
+		"TLS_AUTOCERT_HOSTS":   &conf.TLS.AutocertHosts,
+		"CORS_ALLOWED_ORIGINS": &conf.HTTP.CORSAllowedOrigins,
+		"CORS_ALLOWED_METHODS": &conf.HTTP.CORSAllowedMethods,
+		"CORS_ALLOWED_HEADERS": &conf.HTTP.CORSAllowedHeaders,
+		"TRUSTED_PROXIES":      &conf.HTTP.TrustedProxies,
+	} {
+		if v := os.Getenv(name); v != "" {
+			*field = nil
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*field = append(*field, item)
+				}
+			}
+		}
+	}
+	// SQLite is given a file rather than a URI
+	uriVar := "DATABASE_URI"
+	if conf.DB.Backend == store.BackendSQLite {
+		uriVar = "SQLITE_PATH"
+	}
+	if v := os.Getenv(uriVar); v != "" {
+		conf.DB.URI = v
+	}
+	if v := os.Getenv("DB_CONNECT_RETRY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid DB_CONNECT_RETRY %q: must be a duration like 1m or 0 to fail at once", v))
+		}
+		conf.DB.ConnectRetry = d
+	}
+	if v := os.Getenv("MAX_RESULTS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			errs = append(errs, fmt.Errorf("invalid MAX_RESULTS %q: must be a positive integer", v))
+		}
+		conf.DB.MaxResults = n
+	}
+	if v := os.Getenv("MAX_BOOKS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid MAX_BOOKS %q: must be a non-negative integer", v))
+		}
+		conf.DB.MaxBooks = n
+	}
+	if v := os.Getenv("HSTS_MAX_AGE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid HSTS_MAX_AGE %q: must be a duration like 8760h or 0 to disable HSTS", v))
+		}
+		conf.HTTP.HSTSMaxAge = d
+	}
+	if v := os.Getenv("HTTPS_REDIRECT"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid HTTPS_REDIRECT %q: must be true or false", v))
+		}
+		conf.HTTP.HTTPSRedirect = b
+	}
+	if v := os.Getenv("COMPRESSION_LEVEL"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid COMPRESSION_LEVEL %q: must be a number from 1 to 9 or 0 to disable compression", v))
+		}
+		conf.HTTP.CompressionLevel = n
+	}
+	if v := os.Getenv("BODY_LIMIT"); v != "" {
+		if err := conf.HTTP.BodyLimit.UnmarshalText([]byte(v)); err != nil {
+			errs = append(errs, fmt.Errorf("invalid BODY_LIMIT %q: must be a size like 512KB or 2MB", v))
+		}
+	}
+	if v := os.Getenv("REQUEST_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid REQUEST_TIMEOUT %q: must be a duration like 5s", v))
+		}
+		conf.HTTP.RequestTimeout = d
+	}
+	return errs
+}
+
+// validate checks the settings that readEnv and readFile take as they are.
+// The trusted proxies are parsed on the way.
+func (conf *Config) validate() []error {
+	var errs []error
+	if n, err := strconv.Atoi(conf.Port); err != nil || n < 0 || n > 65535 {
+		errs = append(errs, fmt.Errorf("invalid port %q: must be a number between 0 and 65535", conf.Port))
+	}
+	if conf.BindAddr != "" && net.ParseIP(conf.BindAddr) == nil && strings.ContainsAny(conf.BindAddr, ":/[]") {
+		errs = append(errs, fmt.Errorf("invalid bind address %q: must be a host name or an IP address without port", conf.BindAddr))
+	}
+	if conf.Log.Level != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(conf.Log.Level)); err != nil {
+			errs = append(errs, fmt.Errorf("invalid log level %q: use debug, info, warn or error", conf.Log.Level))
+		}
+	}
+	switch conf.Log.Format {
+	case "", "text", "json":
+	default:
+		errs = append(errs, fmt.Errorf("invalid log format %q: use text or json", conf.Log.Format))
+	}
+	switch conf.DB.Backend {
+	case "", store.BackendMongo, store.BackendPostgres, store.BackendSQLite, store.BackendMemory:
+	default:
+		errs = append(errs, fmt.Errorf("unknown storage backend %q: use %s, %s, %s or %s", conf.DB.Backend,
+			store.BackendMongo, store.BackendPostgres, store.BackendSQLite, store.BackendMemory))
+	}
+	if conf.DB.Name == "" || conf.DB.Collection == "" {
+		errs = append(errs, errors.New("the database name and the collection of the books must not be empty"))
+	}
+	if conf.DB.ConnectRetry < 0 {
+		errs = append(errs, fmt.Errorf("invalid connect retry %s: must not be negative", conf.DB.ConnectRetry))
+	}
+	if conf.DB.MaxResults < 0 {
+		errs = append(errs, fmt.Errorf("invalid max results %d: must be positive", conf.DB.MaxResults))
+	}
+	if conf.DB.MaxBooks < 0 {
+		errs = append(errs, fmt.Errorf("invalid max books %d: must not be negative", conf.DB.MaxBooks))
+	}
+	if (conf.Admin.Username == "") != (conf.Admin.Password == "") {
+		errs = append(errs, errors.New("the admin needs both a username and a password"))
+	}
+	if (conf.TLS.CertFile == "") != (conf.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("TLS needs both a certificate and a key file"))
+	}
+	if len(conf.TLS.AutocertHosts) > 0 {
+		if conf.TLS.CertFile != "" {
+			errs = append(errs, errors.New("TLS takes either a certificate file or autocert hosts, not both"))
+		}
+		if conf.Socket != "" {
+			errs = append(errs, errors.New("autocert needs the service on port 443, not on a Unix socket"))
+		}
+		if conf.TLS.AutocertCache == "" {
+			errs = append(errs, errors.New("autocert needs a cache directory for its certificates"))
+		}
+		for _, host := range conf.TLS.AutocertHosts {
+			if host == "" || strings.ContainsAny(host, ":/ ") {
+				errs = append(errs, fmt.Errorf("invalid autocert host %q: must be a domain name without scheme or port", host))
+			}
+		}
+	}
+	if conf.HTTP.HSTSMaxAge < 0 {
+		errs = append(errs, fmt.Errorf("invalid HSTS max age %s: must not be negative", conf.HTTP.HSTSMaxAge))
+	}
+	if conf.HTTP.CompressionLevel < 0 || conf.HTTP.CompressionLevel > 9 {
+		errs = append(errs, fmt.Errorf("invalid compression level %d: must be from 1 to 9, or 0 for none", conf.HTTP.CompressionLevel))
+	}
+	if conf.HTTP.BodyLimit <= 0 {
+		errs = append(errs, fmt.Errorf("invalid body limit %d: must be positive", conf.HTTP.BodyLimit))
+	}
+	if conf.HTTP.RequestTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("invalid request timeout %s: must be positive", conf.HTTP.RequestTimeout))
+	}
+	if !conf.HTTP.trustNoProxy() {
+		for _, proxy := range conf.HTTP.TrustedProxies {
+			ipNet, err := parseProxy(proxy)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid trusted proxy %q: must be an address or a CIDR range like 10.0.0.0/8, or none alone", proxy))
+				continue
+			}
+			conf.HTTP.trustedNets = append(conf.HTTP.trustedNets, ipNet)
+		}
+	}
+	for _, origin := range conf.HTTP.CORSAllowedOrigins {
+		if u, err := url.Parse(origin); origin != "*" && (err != nil || u.Scheme == "" || u.Host == "" || u.Path != "") {
+			errs = append(errs, fmt.Errorf("invalid CORS origin %q: must look like https://example.com or be *", origin))
+		}
+	}
+	for _, path := range []string{conf.TLS.CertFile, conf.TLS.KeyFile} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			errs = append(errs, fmt.Errorf("cannot read TLS file: %w", err))
+		}
+	}
+	return errs
+}
+
+// Store returns the settings of the storage backend
+func (conf Config) Store() store.Config {
+	return store.Config{
+		Backend:      conf.DB.Backend,
+		URI:          conf.DB.URI,
+		Database:     conf.DB.Name,
+		Collection:   conf.DB.Collection,
+		MaxResults:   conf.DB.MaxResults,
+		ConnectRetry: conf.DB.ConnectRetry,
+	}
+}
+
+// Listener returns where and how the service serves HTTP
+func (conf Config) Listener() server.Listener {
+	return server.Listener{
+		Host:     conf.BindAddr,
+		Port:     conf.Port,
+		Socket:   conf.Socket,
+		CertFile: conf.TLS.CertFile,
+		KeyFile:  conf.TLS.KeyFile,
+		Autocert: server.Autocert{
+			Hosts:     conf.TLS.AutocertHosts,
+			Cache:     conf.TLS.AutocertCache,
+			Email:     conf.TLS.AutocertEmail,
+			Directory: conf.TLS.ACMEDirectory,
+		},
+	}
+}
+
+// Server returns the settings of the echo instance of the service
+func (conf Config) Server() server.Options {
+	return server.Options{
+		HSTSMaxAge:       conf.HTTP.HSTSMaxAge,
+		HTTPSRedirect:    conf.HTTP.HTTPSRedirect,
+		CORSOrigins:      conf.HTTP.CORSAllowedOrigins,
+		CORSMethods:      conf.HTTP.CORSAllowedMethods,
+		CORSHeaders:      conf.HTTP.CORSAllowedHeaders,
+		CompressionLevel: conf.HTTP.CompressionLevel,
+		BodyLimit:        int64(conf.HTTP.BodyLimit),
+		RequestTimeout:   conf.HTTP.RequestTimeout,
+		TrustedProxies:   conf.HTTP.trustedNets,
+		TrustNoProxy:     conf.HTTP.trustNoProxy(),
+	}
+}
+
+// trustNoProxy reports whether the proxies are set to none
+func (h HTTP) trustNoProxy() bool {
+	return len(h.TrustedProxies) == 1 && h.TrustedProxies[0] == "none"
+}
+
+// parseProxy returns the range of addresses proxy stands for: itself, if it
+// is a single address, or the CIDR range it is
+func parseProxy(proxy string) (*net.IPNet, error) {
+	cidr := proxy
+	if !strings.Contains(proxy, "/") {
+		if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+			cidr += "/32"
+		} else {
+			cidr += "/128"
+		}
+	}
+	_, ipNet, err := net.ParseCIDR(cidr)
+	return ipNet, err
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/server"
+)
+
+func TestHTTPDefaults(t *testing.T) {
+	conf, err := Load("3001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := server.Options{
+		HSTSMaxAge:       server.DefaultHSTSMaxAge,
+		CompressionLevel: server.DefaultCompressionLevel,
+		BodyLimit:        server.DefaultBodyLimit,
+		RequestTimeout:   server.DefaultRequestTimeout,
+	}
+	if got := conf.Server(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Server() = %+v, want %+v", got, want)
+	}
+}
+
+func TestHTTPFromEnv(t *testing.T) {
+	t.Setenv("HSTS_MAX_AGE", "0")
+	t.Setenv("HTTPS_REDIRECT", "true")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://books.example.com, http://localhost:8080,")
+	t.Setenv("CORS_ALLOWED_METHODS", "GET")
+	t.Setenv("COMPRESSION_LEVEL", "0")
+	t.Setenv("BODY_LIMIT", "512KB")
+	t.Setenv("REQUEST_TIMEOUT", "5s")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.1, 2001:db8::1")
+	conf, err := Load("3001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := server.Options{
+		HTTPSRedirect:  true,
+		CORSOrigins:    []string{"https://books.example.com", "http://localhost:8080"},
+		CORSMethods:    []string{"GET"},
+		BodyLimit:      512_000,
+		RequestTimeout: 5 * time.Second,
+		TrustedProxies: []*net.IPNet{
+			{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)},
+			{IP: net.IP{192, 0, 2, 1}, Mask: net.CIDRMask(32, 32)},
+			{IP: net.ParseIP("2001:db8::1"), Mask: net.CIDRMask(128, 128)},
+		},
+	}
+	if got := conf.Server(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Server() = %+v, want %+v", got, want)
+	}
+}
+
+func TestTrustNoProxy(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "none")
+	conf, err := Load("3001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := conf.Server(); !got.TrustNoProxy || got.TrustedProxies != nil {
+		t.Errorf("Server() = %+v, want no proxy trusted", got)
+	}
+}
+
+func TestHTTPFromFile(t *testing.T) {
+	for body, want := range map[string]int64{"2MB": 2_000_000, "2MiB": 2 << 20, "4096": 4096} {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		file := "http:\n  compression_level: 9\n  body_limit: " + body + "\n"
+		if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("CONFIG_FILE", path)
+		conf, err := Load("3001")
+		if err != nil {
+			t.Fatalf("body_limit %s: %v", body, err)
+		}
+		if got := conf.Server(); got.CompressionLevel != 9 || got.BodyLimit != want {
+			t.Errorf("body_limit %s: Server() = %+v, want level 9 and a limit of %d", body, got, want)
+		}
+	}
+}
+
+func TestInvalidHTTPSettings(t *testing.T) {
+	tests := []struct{ name, value, want string }{
+		{"HSTS_MAX_AGE", "a year", "HSTS_MAX_AGE"},
+		{"HSTS_MAX_AGE", "-1h", "HSTS max age"},
+		{"HTTPS_REDIRECT", "yes please", "HTTPS_REDIRECT"},
+		{"COMPRESSION_LEVEL", "best", "COMPRESSION_LEVEL"},
+		{"COMPRESSION_LEVEL", "11", "compression level"},
+		{"BODY_LIMIT", "huge", "BODY_LIMIT"},
+		{"BODY_LIMIT", "0", "body limit"},
+		{"REQUEST_TIMEOUT", "soon", "REQUEST_TIMEOUT"},
+		{"REQUEST_TIMEOUT", "0s", "request timeout"},
+		{"TRUSTED_PROXIES", "nginx", "trusted proxy"},
+		{"TRUSTED_PROXIES", "none,10.0.0.0/8", "trusted proxy"},
+		{"CORS_ALLOWED_ORIGINS", "books.example.com", "CORS origin"},
+		{"CORS_ALLOWED_ORIGINS", "https://books.example.com/", "CORS origin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"="+tt.value, func(t *testing.T) {
+			t.Setenv(tt.name, tt.value)
+			_, err := Load("3001")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want one about %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	tests := []struct {
+		username, password string
+		enabled, valid     bool
+	}{
+		{"", "", false, true},
+		{"root", "secret", true, true},
+		{"", "secret", false, false},
+		{"root", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.username+":"+tt.password, func(t *testing.T) {
+			t.Setenv("ADMIN_USERNAME", tt.username)
+			t.Setenv("ADMIN_PASSWORD", tt.password)
+			conf, err := Load("3001")
+			if valid := err == nil; valid != tt.valid {
+				t.Fatalf("Load() error = %v, want valid %t", err, tt.valid)
+			}
+			if got := conf.Admin.Enabled(); got != tt.enabled {
+				t.Errorf("Admin.Enabled() = %t, want %t", got, tt.enabled)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package events
+
+import (
+	"context"
+
+	"github.com/CAPS-Cloud/exercises/internal/cache"
+)
+
+// invalidator drops the cached responses a change makes stale
+type invalidator struct {
+	cache cache.Cache
+}
+
+// Invalidate returns a publisher dropping the cached responses of every
+// changed book. It runs before the write returns, so the next read of the
+// client that made the change is not served from the cache.
+func Invalidate(c cache.Cache) Publisher {
+	return invalidator{c}
+}
+
+// Publish drops the cached responses of ev.Book
+func (i invalidator) Publish(ctx context.Context, ev Event) {
+	i.cache.Invalidate(ctx, ev.Book.ID)
+}
@@ -0,0 +1,45 @@
+package events
+
+import (
+	"context"
+	"os"
+
+	"github.com/CAPS-Cloud/exercises/internal/cache"
+)
+
+// PublishersFromEnv returns the publishers configured in the environment
+// and a function releasing them. NATS_URL enables publishing to NATS, on the
+// subjects prefixed with NATS_SUBJECT (default bookstore.books); REDIS_URI
+// enables dropping the responses the GET service cached in Redis. Without
+// configuration there are no publishers.
+func PublishersFromEnv(ctx context.Context) ([]Publisher, func(), error) {
+	var pubs []Publisher
+	var closers []func()
+	closeAll := func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+	if url := os.Getenv("NATS_URL"); url != "" {
+		prefix := os.Getenv("NATS_SUBJECT")
+		if prefix == "" {
+			prefix = defaultSubject
+		}
+		bus, err := ConnectNATS(url, prefix)
+		if err != nil {
+			return nil, nil, err
+		}
+		pubs = append(pubs, bus)
+		closers = append(closers, bus.Close)
+	}
+	rc, err := cache.RedisFromEnv(ctx)
+	if err != nil {
+		closeAll()
+		return nil, nil, err
+	}
+	if rc != nil {
+		pubs = append(pubs, Invalidate(rc))
+		closers = append(closers, rc.Close)
+	}
+	return pubs, closeAll, nil
+}
@@ -0,0 +1,256 @@
+// Package events tells other systems about changes of books. Wrap decorates
+// a store.Repository so that every successful create, update and delete is
+// handed to the configured publishers, whichever API made the change.
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+)
+
+// OpPurge is the type of the event published when a book in the trash is
+// removed for good. Trashing it was already published as store.OpDelete.
+const OpPurge = "purge"
+
+// Event is a change of a book as published to other systems
+type Event struct {
+	Type string           // store.OpInsert, store.OpUpdate, store.OpDelete or OpPurge
+	Book models.BookStore // the book after the change, or before a delete
+	Time time.Time
+}
+
+// Payload is the JSON body of an event: {"type", "id", "book", "timestamp"}
+func (ev Event) Payload() map[string]interface{} {
+	return map[string]interface{}{
+		"type":      ev.Type,
+		"id":        ev.Book.ID,
+		"book":      ev.Book.ToMap(),
+		"timestamp": ev.Time.Format(time.RFC3339),
+	}
+}
+
+// Publisher delivers events. Publish must not block the write that caused
+// the event for long; slow deliveries belong in a goroutine.
+type Publisher interface {
+	Publish(ctx context.Context, ev Event)
+}
+
+// repository publishes the book changes made through the embedded
+// Repository
+type repository struct {
+	store.Repository
+	pubs []Publisher
+}
+
+// pendingKey is the context key of the events of a running transaction
+type pendingKey struct{}
+
+// Wrap returns r publishing every book change to pubs. Changes made inside
+// a transaction are published once it has been committed.
+func Wrap(r store.Repository, pubs ...Publisher) store.Repository {
+	if len(pubs) == 0 {
+		return r
+	}
+	return &repository{r, pubs}
+}
+
+// publish hands ev to the publishers, or holds it back until the running
+// transaction commits
+func (r *repository) publish(ctx context.Context, op string, book models.BookStore) {
+	ev := Event{Type: op, Book: book, Time: time.Now().UTC()}
+	if pending, ok := ctx.Value(pendingKey{}).(*[]Event); ok {
+		*pending = append(*pending, ev)
+		return
+	}
+	// The change has been made; a client going away must not stop it from
+	// being published.
+	ctx = context.WithoutCancel(ctx)
+	for _, p := range r.pubs {
+		p.Publish(ctx, ev)
+	}
+}
+
+// stored returns the book with the given ID as the store keeps it, with the
+// revision and creation time the store gave it. If it cannot be read, book
+// is returned as it was handed to the store.
+func (r *repository) stored(ctx context.Context, book models.BookStore) models.BookStore {
+	if got, err := r.Repository.GetBook(ctx, book.ID); err == nil {
+		return got
+	}
+	return book
+}
+
+// CreateBook stores a new book and publishes an insert event carrying the
+// stored book
+func (r *repository) CreateBook(ctx context.Context, book models.BookStore) error {
+	if err := r.Repository.CreateBook(ctx, book); err != nil {
+		return err
+	}
+	r.publish(ctx, store.OpInsert, r.stored(ctx, book))
+	return nil
+}
+
+// CreateBooks stores new books and publishes an insert event for each
+// stored one, see CreateBook
+func (r *repository) CreateBooks(ctx context.Context, books []models.BookStore) ([]error, error) {
+	errs, err := r.Repository.CreateBooks(ctx, books)
+	if err != nil {
+		return errs, err
+	}
+	for i, book := range books {
+		if errs[i] == nil {
+			r.publish(ctx, store.OpInsert, r.stored(ctx, book))
+		}
+	}
+	return errs, nil
+}
+
+// UpsertBooks stores the books whose ID is not taken and publishes an insert
+// event for each of them. Books that were already stored, also in the trash,
+// are left alone by the store and so are not published.
+func (r *repository) UpsertBooks(ctx context.Context, books []models.BookStore) (int64, error) {
+	ids := make([]string, len(books))
+	for i, book := range books {
+		ids[i] = book.ID
+	}
+	taken := map[string]bool{}
+	for _, deleted := range []bool{false, true} {
+		err := r.Repository.EachBook(ctx, store.BookQuery{IDs: ids, Deleted: deleted}, func(book models.BookStore) error {
+			taken[book.ID] = true
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	stored, err := r.Repository.UpsertBooks(ctx, books)
+	if err != nil || stored == 0 {
+		return stored, err
+	}
+	var added []string
+	for _, id := range ids {
+		if !taken[id] {
+			added = append(added, id)
+		}
+	}
+	if len(added) == 0 {
+		return stored, nil
+	}
+	err = r.Repository.EachBook(ctx, store.BookQuery{IDs: added}, func(book models.BookStore) error {
+		r.publish(ctx, store.OpInsert, book)
+		return nil
+	})
+	return stored, err
+}
+
+// UpdateBook updates a book and publishes an update event
+func (r *repository) UpdateBook(ctx context.Context, id string, revision int64, fields map[string]string) (models.BookStore, error) {
+	book, err := r.Repository.UpdateBook(ctx, id, revision, fields)
+	if err != nil {
+		return book, err
+	}
+	r.publish(ctx, store.OpUpdate, book)
+	return book, nil
+}
+
+// SetCover replaces the cover of a book and publishes an update event,
+// since the book now refers to another image
+func (r *repository) SetCover(ctx context.Context, id string, cover models.Cover, data []byte, thumbnails map[string][]byte) (models.BookStore, error) {
+	book, err := r.Repository.SetCover(ctx, id, cover, data, thumbnails)
+	if err != nil {
+		return book, err
+	}
+	r.publish(ctx, store.OpUpdate, book)
+	return book, nil
+}
+
+// DeleteBook moves a book to the trash and publishes a delete event
+// carrying the removed book
+func (r *repository) DeleteBook(ctx context.Context, id string) error {
+	book, err := r.Repository.GetBook(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.Repository.DeleteBook(ctx, id); err != nil {
+		return err
+	}
+	r.publish(ctx, store.OpDelete, book)
+	return nil
+}
+
+// RestoreBook takes a book out of the trash and publishes an insert event,
+// since it was reported deleted when it was trashed
+func (r *repository) RestoreBook(ctx context.Context, id string) (models.BookStore, error) {
+	book, err := r.Repository.RestoreBook(ctx, id)
+	if err != nil {
+		return book, err
+	}
+	r.publish(ctx, store.OpInsert, book)
+	return book, nil
+}
+
+// UpdateBooks updates the books matching q and publishes an update event for
+// each changed one
+func (r *repository) UpdateBooks(ctx context.Context, q store.BookQuery, fields map[string]string) (int64, []models.BookStore, error) {
+	matched, books, err := r.Repository.UpdateBooks(ctx, q, fields)
+	if err != nil {
+		return matched, books, err
+	}
+	for _, book := range books {
+		r.publish(ctx, store.OpUpdate, book)
+	}
+	return matched, books, nil
+}
+
+// DeleteBooks moves the books matching q to the trash and publishes a delete event for
+// each of them
+func (r *repository) DeleteBooks(ctx context.Context, q store.BookQuery) ([]models.BookStore, error) {
+	books, err := r.Repository.DeleteBooks(ctx, q)
+	if err != nil {
+		return books, err
+	}
+	for _, book := range books {
+		r.publish(ctx, store.OpDelete, book)
+	}
+	return books, nil
+}
+
+// PurgeBooks removes the books in the trash matching q for good and
+// publishes a purge event for each of them
+func (r *repository) PurgeBooks(ctx context.Context, q store.BookQuery) ([]models.BookStore, error) {
+	books, err := r.Repository.PurgeBooks(ctx, q)
+	if err != nil {
+		return books, err
+	}
+	for _, book := range books {
+		r.publish(ctx, OpPurge, book)
+	}
+	return books, nil
+}
+
+// WithTransaction runs fn in a transaction of the embedded Repository and
+// publishes the events of fn after the commit
+func (r *repository) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(pendingKey{}).(*[]Event); ok {
+		return r.Repository.WithTransaction(ctx, fn)
+	}
+	var pending []Event
+	err := r.Repository.WithTransaction(ctx, func(ctx context.Context) error {
+		// MongoDB may retry fn; only the events of the last attempt count.
+		pending = pending[:0]
+		return fn(context.WithValue(ctx, pendingKey{}, &pending))
+	})
+	if err != nil {
+		return err
+	}
+	ctx = context.WithoutCancel(ctx)
+	for _, ev := range pending {
+		for _, p := range r.pubs {
+			p.Publish(ctx, ev)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/nats-io/nats.go"
+)
+
+// defaultSubject prefixes the subjects events are published on unless
+// NATS_SUBJECT is set
+const defaultSubject = "bookstore.books"
+
+// NATS publishes every event as JSON on the subject <prefix>.<type>, e.g.
+// bookstore.books.insert, so consumers can subscribe to all changes with
+// bookstore.books.> or to a single kind of change.
+type NATS struct {
+	conn   *nats.Conn
+	prefix string
+}
+
+// ConnectNATS connects to the NATS server at url. The connection reconnects
+// on its own; events published while it is down are buffered by the client.
+func ConnectNATS(url, prefix string) (*NATS, error) {
+	conn, err := nats.Connect(url, nats.Name("bookstore"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("publishing book events to NATS", "url", url, "subject", prefix+".<type>")
+	return &NATS{conn: conn, prefix: prefix}, nil
+}
+
+// Publish sends ev without waiting for the server
+func (n *NATS) Publish(ctx context.Context, ev Event) {
+	data, err := json.Marshal(ev.Payload())
+	if err != nil {
+		slog.ErrorContext(ctx, "cannot encode event", "event", ev.Type, "book", ev.Book.ID, "error", err)
+		return
+	}
+	if err := n.conn.Publish(n.prefix+"."+ev.Type, data); err != nil {
+		slog.ErrorContext(ctx, "cannot publish event", "event", ev.Type, "book", ev.Book.ID, "error", err)
+	}
+}
+
+// Close flushes the buffered events and disconnects
+func (n *NATS) Close() {
+	if err := n.conn.Drain(); err != nil {
+		slog.Error("cannot close NATS connection", "error", err)
+	}
+}
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// apiKeyPrefix starts every minted key so that leaked keys are easy to spot
+const apiKeyPrefix = "bk_"
+
+// createKey serves POST /api/v1/admin/keys: it mints an API key for the
+// given name and role (editor by default). The key itself is only part of
+// this response.
+func (a *API) createKey(c echo.Context) error {
+	var req struct {
+		Name string `json:"name"`
+		Role string `json:"role"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return bindFailed(c, err)
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Role == "" {
+		req.Role = models.RoleEditor
+	}
+	errs := map[string]string{}
+	if req.Name == "" {
+		errs["name"] = "is required"
+	}
+	if !models.ValidRole(req.Role) {
+		errs["role"] = "must be viewer, editor or admin"
+	}
+	if len(errs) > 0 {
+		return validationFailed(c, errs)
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		logError(c, "rand.Read", err)
+		return problem.Respond(c, http.StatusInternalServerError, "could not generate key")
+	}
+	key := apiKeyPrefix + hex.EncodeToString(secret)
+	doc := models.APIKey{
+		Name:      req.Name,
+		Role:      req.Role,
+		Prefix:    key[:len(apiKeyPrefix)+8],
+		Hash:      hashAPIKey(key),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := a.store.InsertAPIKey(c.Request().Context(), &doc); err != nil {
+		return storeFailed(c, "InsertAPIKey", err)
+	}
+	return respond(c, http.StatusCreated, struct {
+		models.APIKey
+		Key string `json:"key"`
+	}{doc, key})
+}
+
+// listKeys serves GET /api/v1/admin/keys. Only key prefixes are shown; the
+// keys themselves are never stored.
+func (a *API) listKeys(c echo.Context) error {
+	keys, err := a.store.ListAPIKeys(c.Request().Context())
+	if err != nil {
+		return storeFailed(c, "ListAPIKeys", err)
+	}
+	return respond(c, http.StatusOK, keys)
+}
+
+// revokeKey serves DELETE /api/v1/admin/keys/:id. Revoked keys are kept so
+// that GET /api/v1/admin/keys still shows when they were revoked.
+func (a *API) revokeKey(c echo.Context) error {
+	id := c.Param("id")
+	err := a.store.RevokeAPIKey(c.Request().Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		return problem.Respond(c, http.StatusNotFound, "key not found")
+	}
+	if err != nil {
+		return storeFailed(c, "RevokeAPIKey", err)
+	}
+	return respond(c, http.StatusOK, map[string]string{"message": "key revoked", "id": id})
+}
+
+// createUser serves POST /api/v1/admin/users
+func (a *API) createUser(c echo.Context) error {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Role     string `json:"role"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return bindFailed(c, err)
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	errs := map[string]string{}
+	if req.Username == "" {
+		errs["username"] = "is required"
+	}
+	if len(req.Password) < 8 {
+		errs["password"] = "must be at least 8 characters"
+	}
+	if !models.ValidRole(req.Role) {
+		errs["role"] = "must be viewer, editor or admin"
+	}
+	if len(errs) > 0 {
+		return validationFailed(c, errs)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		logError(c, "bcrypt", err)
+		return problem.Respond(c, http.StatusInternalServerError, "could not hash password")
+	}
+	doc := models.User{
+		Username:     req.Username,
+		PasswordHash: string(hash),
+		Role:         req.Role,
+		CreatedAt:    time.Now().UTC(),
+	}
+	err = a.store.InsertUser(c.Request().Context(), &doc)
+	if errors.Is(err, store.ErrDuplicate) {
+		return problem.Respond(c, http.StatusConflict, "user already exists: "+req.Username)
+	}
+	if err != nil {
+		return storeFailed(c, "InsertUser", err)
+	}
+	return respond(c, http.StatusCreated, doc)
+}
+
+// listUsers serves GET /api/v1/admin/users
+func (a *API) listUsers(c echo.Context) error {
+	users, err := a.store.ListUsers(c.Request().Context())
+	if err != nil {
+		return storeFailed(c, "ListUsers", err)
+	}
+	return respond(c, http.StatusOK, users)
+}
+
+// updateUser serves PUT /api/v1/admin/users/:username: it assigns a new role
+// and/or password to an existing user
+func (a *API) updateUser(c echo.Context) error {
+	username := c.Param("username")
+	var req struct {
+		Password string `json:"password"`
+		Role     string `json:"role"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return bindFailed(c, err)
+	}
+	errs := map[string]string{}
+	if req.Role != "" && !models.ValidRole(req.Role) {
+		errs["role"] = "must be viewer, editor or admin"
+	}
+	if req.Password != "" && len(req.Password) < 8 {
+		errs["password"] = "must be at least 8 characters"
+	}
+	if len(errs) > 0 {
+		return validationFailed(c, errs)
+	}
+	if req.Role == "" && req.Password == "" {
+		return validationFailed(c, map[string]string{"body": "no fields to update"})
+	}
+	var passwordHash string
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			logError(c, "bcrypt", err)
+			return problem.Respond(c, http.StatusInternalServerError, "could not hash password")
+		}
+		passwordHash = string(hash)
+	}
+
+	err := a.store.UpdateUser(c.Request().Context(), username, req.Role, passwordHash)
+	if errors.Is(err, store.ErrNotFound) {
+		return problem.Respond(c, http.StatusNotFound, "user not found")
+	}
+	if err != nil {
+		return storeFailed(c, "UpdateUser", err)
+	}
+	return respond(c, http.StatusOK, map[string]string{"message": "user updated", "username": username})
+}
+
+// deleteUser serves DELETE /api/v1/admin/users/:username
+func (a *API) deleteUser(c echo.Context) error {
+	username := c.Param("username")
+	err := a.store.DeleteUser(c.Request().Context(), username)
+	if errors.Is(err, store.ErrNotFound) {
+		return problem.Respond(c, http.StatusNotFound, "user not found")
+	}
+	if err != nil {
+		return storeFailed(c, "DeleteUser", err)
+	}
+	return respond(c, http.StatusOK, map[string]string{"message": "user deleted", "username": username})
+}
+
+// createWebhook serves POST /api/v1/admin/webhooks: it registers a URL that
+// receives every book change. The signing secret is only part of this
+// response.
+func (a *API) createWebhook(c echo.Context) error {
+	var req struct {
+		URL string `json:"url"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return bindFailed(c, err)
+	}
+	u, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return validationFailed(c, map[string]string{"url": "must be an absolute http or https URL"})
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		logError(c, "rand.Read", err)
+		return problem.Respond(c, http.StatusInternalServerError, "could not generate secret")
+	}
+	doc := models.Webhook{
+		URL:       u.String(),
+		Secret:    hex.EncodeToString(secret),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := a.store.InsertWebhook(c.Request().Context(), &doc); err != nil {
+		return storeFailed(c, "InsertWebhook", err)
+	}
+	return respond(c, http.StatusCreated, struct {
+		models.Webhook
+		Secret string `json:"secret"`
+	}{doc, doc.Secret})
+}
+
+// listWebhooks serves GET /api/v1/admin/webhooks
+func (a *API) listWebhooks(c echo.Context) error {
+	hooks, err := a.store.ListWebhooks(c.Request().Context())
+	if err != nil {
+		return storeFailed(c, "ListWebhooks", err)
+	}
+	return respond(c, http.StatusOK, hooks)
+}
+
+// deleteWebhook serves DELETE /api/v1/admin/webhooks/:id
+func (a *API) deleteWebhook(c echo.Context) error {
+	id := c.Param("id")
+	err := a.store.DeleteWebhook(c.Request().Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		return problem.Respond(c, http.StatusNotFound, "webhook not found")
+	}
+	if err != nil {
+		return storeFailed(c, "DeleteWebhook", err)
+	}
+	return respond(c, http.StatusOK, map[string]string{"message": "webhook deleted", "id": id})
+}
+
+// Bounds of the number of entries GET /api/v1/admin/audit returns
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// listAudit serves GET /api/v1/admin/audit: the changes of books, newest
+// first, optionally only those of book_id and those made from since up to
+// until, both RFC 3339 times
+func (a *API) listAudit(c echo.Context) error {
+	q := store.AuditQuery{BookID: c.QueryParam("book_id"), Limit: defaultAuditLimit}
+	for name, dst := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		value := c.QueryParam(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return problem.Respond(c, http.StatusBadRequest, name+" must be an RFC 3339 time like 2024-05-01T00:00:00Z")
+		}
+		*dst = t
+	}
+	if limit := c.QueryParam("limit"); limit != "" {
+		n, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			return problem.Respond(c, http.StatusBadRequest, fmt.Sprintf("limit must be an integer between 1 and %d", maxAuditLimit))
+		}
+		q.Limit = n
+	}
+	entries, err := a.store.ListAuditEntries(c.Request().Context(), q)
+	if err != nil {
+		return storeFailed(c, "ListAuditEntries", err)
+	}
+	return respond(c, http.StatusOK, entries)
+}
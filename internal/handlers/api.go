@@ -0,0 +1,143 @@
+// Package handlers implements the REST API of the bookstore. Every API
+// service registers the routes of its HTTP method on a shared API value.
+package handlers
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/cache"
+	"github.com/CAPS-Cloud/exercises/internal/lookup"
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/server"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// Config configures the API
+type Config struct {
+	// JWTSecret signs and verifies the tokens issued by POST /api/v1/login.
+	// When empty, write routes are open and the /admin routes are disabled.
+	JWTSecret string
+	Login     LoginConfig
+	// MaxBooks caps how many books may be stored; 0 means unlimited. The
+	// books are counted before they are inserted, so concurrent creates may
+	// together go a few books past the cap; it guards against runaway
+	// clients rather than being an exact limit.
+	MaxBooks    int64
+	OpenAPISpec []byte
+	Build       BuildInfo
+	// Cache keeps the responses of GET /books and GET /books/:id; nil
+	// disables caching.
+	Cache cache.Cache
+	// OpenLibrary completes books for POST /books/:id/enrich; nil disables
+	// the route.
+	OpenLibrary lookup.Source
+	// GoogleBooks describes the books of POST /books/isbn/:isbn; nil
+	// disables the route.
+	GoogleBooks lookup.Source
+}
+
+// LoginConfig holds the credentials of the built-in admin accepted by
+// POST /api/v1/login and how long the issued tokens stay valid
+type LoginConfig struct {
+	Username string
+	Password string
+	TTL      time.Duration
+}
+
+// BuildInfo is reported by GET /api/v1/version
+type BuildInfo struct {
+	Version   string
+	GitCommit string
+	BuildTime string
+}
+
+// API serves the book API. Each API version registers the handlers it needs
+// on its own route group, so a new version only has to provide the handlers
+// whose behavior changes.
+type API struct {
+	store store.Repository
+	conf  Config
+
+	// closing is closed by CloseStreams to end the event streams
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// New returns the API on top of st
+func New(st store.Repository, conf Config) *API {
+	if conf.JWTSecret == "" {
+		slog.Warn("JWT_SECRET not set, write endpoints are not protected")
+	}
+	return &API{store: st, conf: conf, closing: make(chan struct{})}
+}
+
+// CloseStreams ends the open event streams, e.g. when the service stops
+func (a *API) CloseStreams() {
+	a.closeOnce.Do(func() { close(a.closing) })
+}
+
+// RegisterGet registers the GET routes of /api/v1 on g
+func (a *API) RegisterGet(g *echo.Group) {
+	g.GET("/books", a.list)
+	g.GET("/books/:id", a.get)
+	g.GET("/books/:id/history", a.listHistory)
+	g.GET("/books/:id/cover", a.getCover)
+	g.GET("/books/:id/bibtex", a.bibtex)
+	g.GET("/books/:id/marcxml", a.marcXML)
+	g.GET("/books/:id/dc", a.dublinCoreXML)
+	g.GET("/books/search", a.textSearch)
+	g.GET("/books/export.csv", a.exportCSV)
+	g.GET("/books/export.ndjson", a.exportNDJSON)
+	g.GET("/books/export.bib", a.exportBibTeX)
+	g.GET("/books/stream", a.stream)
+	g.GET("/search", a.search)
+	g.GET("/version", a.buildInfo)
+	g.GET("/cache/stats", a.cacheStats)
+	g.GET("/stats/authors", a.statsAuthors)
+	g.GET("/stats/decades", a.statsDecades)
+	g.GET("/openapi.json", a.openAPI)
+	g.GET("/trash", a.listTrash, a.requireRole(models.RoleAdmin))
+	g.GET("/admin/keys", a.listKeys, a.requireAdmin)
+	g.GET("/admin/users", a.listUsers, a.requireAdmin)
+	g.GET("/admin/webhooks", a.listWebhooks, a.requireAdmin)
+	g.GET("/admin/audit", a.listAudit, a.requireAdmin)
+}
+
+// RegisterPost registers the POST routes of /api/v1 on g
+func (a *API) RegisterPost(g *echo.Group) {
+	g.POST("/login", a.issueToken)
+	g.POST("/books", a.create, a.requireRole(models.RoleEditor), a.idempotent)
+	g.POST("/books/import", a.importBatch, server.BodyLimit(maxBatchBodySize), a.requireRole(models.RoleEditor))
+	g.POST("/books/batch", a.createBatch, server.BodyLimit(maxBatchBodySize), a.requireRole(models.RoleEditor))
+	g.POST("/books/isbn/:isbn", a.createByISBN, a.requireRole(models.RoleEditor))
+	g.POST("/import/goodreads", a.importGoodreads, server.BodyLimit(maxBatchBodySize), a.requireRole(models.RoleEditor))
+	g.POST("/books/bulk-update", a.updateMany, a.requireRole(models.RoleEditor))
+	g.POST("/books/:id/restore", a.restore, a.requireRole(models.RoleAdmin))
+	g.POST("/books/:id/revert/:version", a.revert, a.requireRole(models.RoleEditor))
+	g.POST("/books/:id/enrich", a.enrich, a.requireRole(models.RoleEditor))
+	g.POST("/books/:id/cover", a.uploadCover, server.BodyLimit(maxCoverFormSize), a.requireRole(models.RoleEditor))
+	g.POST("/admin/keys", a.createKey, a.requireAdmin)
+	g.POST("/admin/users", a.createUser, a.requireAdmin)
+	g.POST("/admin/webhooks", a.createWebhook, a.requireAdmin)
+}
+
+// RegisterPut registers the PUT and PATCH routes of /api/v1 on g
+func (a *API) RegisterPut(g *echo.Group) {
+	g.PUT("/books/:id", a.update, a.requireRole(models.RoleEditor))
+	g.PATCH("/books/:id", a.patch, a.requireRole(models.RoleEditor))
+	g.PUT("/admin/users/:username", a.updateUser, a.requireAdmin)
+}
+
+// RegisterDelete registers the DELETE routes of /api/v1 on g
+func (a *API) RegisterDelete(g *echo.Group) {
+	g.DELETE("/books", a.removeMany, a.requireRole(models.RoleAdmin))
+	g.DELETE("/books/:id", a.remove, a.requireRole(models.RoleAdmin))
+	g.DELETE("/trash", a.emptyTrash, a.requireRole(models.RoleAdmin))
+	g.DELETE("/trash/:id", a.purge, a.requireRole(models.RoleAdmin))
+	g.DELETE("/admin/keys/:id", a.revokeKey, a.requireAdmin)
+	g.DELETE("/admin/users/:username", a.deleteUser, a.requireAdmin)
+	g.DELETE("/admin/webhooks/:id", a.deleteWebhook, a.requireAdmin)
+}
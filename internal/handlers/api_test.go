@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/server"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// newTestServer serves the routes of every method on top of st, as the API
+// services do together
+func newTestServer(st store.Repository, conf Config) *echo.Echo {
+	e := server.New(server.Options{})
+	api := New(st, conf)
+	server.MountAPI(e, func(g *echo.Group) {
+		api.RegisterGet(g)
+		api.RegisterPost(g)
+		api.RegisterPut(g)
+		api.RegisterDelete(g)
+	})
+	return e
+}
+
+// serve sends a request to e and returns the response. A body is sent as
+// JSON unless header, given as name and value pairs, sets another
+// Content-Type.
+func serve(e *echo.Echo, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// decode reads the JSON body of rec into v
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("cannot decode %q: %v", rec.Body.String(), err)
+	}
+}
+
+// newMemory returns an in-memory store holding books
+func newMemory(t *testing.T, books ...models.BookStore) *store.Memory {
+	t.Helper()
+	st := store.NewMemory()
+	for _, book := range books {
+		if err := st.CreateBook(context.Background(), book); err != nil {
+			t.Fatalf("CreateBook(%s): %v", book.ID, err)
+		}
+	}
+	return st
+}
+
+// countBooks returns how many books st holds
+func countBooks(t *testing.T, st store.Repository) int64 {
+	t.Helper()
+	n, err := st.CountBooks(context.Background())
+	if err != nil {
+		t.Fatalf("CountBooks: %v", err)
+	}
+	return n
+}
+
+// frankenstein and usher are books the tests start with
+var (
+	frankenstein = models.BookStore{ID: "1", BookName: "Frankenstein", BookAuthor: "Mary Shelley", BookPages: "280", BookYear: "1818"}
+	usher        = models.BookStore{ID: "2", BookName: "The Fall of the House of Usher", BookAuthor: "Edgar Allan Poe", BookPages: "40", BookYear: "1839"}
+)
+
+// wantStatus fails t unless rec has status
+func wantStatus(t *testing.T, rec *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d; body %s", rec.Code, status, rec.Body.String())
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+
+	"github.com/CAPS-Cloud/exercises/internal/audit"
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/golang-jwt/jwt/v5"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+)
+
+// authClaims are the claims of tokens issued by POST /api/v1/login
+type authClaims struct {
+	Role string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// requireToken only lets requests with a bearer JWT signed with the
+// configured secret through
+func (a *API) requireToken() echo.MiddlewareFunc {
+	return echojwt.WithConfig(echojwt.Config{
+		SigningKey:    []byte(a.conf.JWTSecret),
+		NewClaimsFunc: func(c echo.Context) jwt.Claims { return new(authClaims) },
+		ErrorHandler: func(c echo.Context, err error) error {
+			return problem.Respond(c, http.StatusUnauthorized, "missing or invalid token")
+		},
+	})
+}
+
+// tokenClaims returns the claims of the token requireToken accepted
+func tokenClaims(c echo.Context) authClaims {
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return authClaims{}
+	}
+	claims, ok := token.Claims.(*authClaims)
+	if !ok {
+		return authClaims{}
+	}
+	return *claims
+}
+
+// tokenRole returns the role claimed by the token requireToken accepted
+func tokenRole(c echo.Context) string {
+	return tokenClaims(c).Role
+}
+
+// auditAs makes the book changes of c be recorded in the audit log as made
+// by actor from the client of c through its route
+func auditAs(c echo.Context, actor string) {
+	src := audit.Source{Actor: actor, Route: c.Request().Method + " " + c.Path(), ClientIP: c.RealIP()}
+	c.SetRequest(c.Request().WithContext(audit.WithSource(c.Request().Context(), src)))
+}
+
+// forbidden rejects a caller whose role does not grant need
+func forbidden(c echo.Context, need string) error {
+	return problem.Respond(c, http.StatusForbidden, "requires the "+need+" role")
+}
+
+// hashAPIKey returns the digest under which key is stored
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookupAPIKey returns the stored key, whose role is "" if it was never
+// minted or has been revoked. Keys minted before roles existed act as
+// editors.
+func (a *API) lookupAPIKey(ctx context.Context, key string) (models.APIKey, error) {
+	doc, err := a.store.APIKeyByHash(ctx, hashAPIKey(key))
+	if errors.Is(err, store.ErrNotFound) {
+		return models.APIKey{}, nil
+	}
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	if doc.Role == "" {
+		doc.Role = models.RoleEditor
+	}
+	return doc, nil
+}
+
+// requireRole protects a mutating route. Requests must carry either a bearer
+// JWT (see POST /api/v1/login) or an unrevoked X-API-Key, and the role of the
+// token or key must grant need. When JWT_SECRET is not configured,
+// authentication is disabled and the routes stay open. The changes are
+// audited as made by the user of the token or by the key, named key:<name>.
+func (a *API) requireRole(need string) echo.MiddlewareFunc {
+	if a.conf.JWTSecret == "" {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				auditAs(c, "")
+				return next(c)
+			}
+		}
+	}
+	tokenAuth := a.requireToken()
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withToken := tokenAuth(func(c echo.Context) error {
+			claims := tokenClaims(c)
+			if !models.HasRole(claims.Role, need) {
+				return forbidden(c, need)
+			}
+			auditAs(c, claims.Subject)
+			return next(c)
+		})
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get("X-API-Key")
+			if key == "" {
+				return withToken(c)
+			}
+			doc, err := a.lookupAPIKey(c.Request().Context(), key)
+			if err != nil {
+				return storeFailed(c, "APIKeyByHash", err)
+			}
+			if doc.Role == "" {
+				return problem.Respond(c, http.StatusUnauthorized, "invalid API key")
+			}
+			if !models.HasRole(doc.Role, need) {
+				return forbidden(c, need)
+			}
+			c.Set("apiKey", doc)
+			auditAs(c, "key:"+doc.Name)
+			return next(c)
+		}
+	}
+}
+
+// RequireRole guards the writes of other APIs on the same store, like the
+// mutations of GraphQL, the way requireRole guards the REST routes
+func (a *API) RequireRole(need string) echo.MiddlewareFunc {
+	return a.requireRole(need)
+}
+
+// requireAdmin guards the /admin routes. Only tokens of admins are accepted,
+// never API keys, so a leaked key cannot be used to mint further keys.
+func (a *API) requireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+	if a.conf.JWTSecret == "" {
+		return func(c echo.Context) error {
+			return problem.Respond(c, http.StatusNotImplemented, "authentication is not configured")
+		}
+	}
+	return a.requireToken()(func(c echo.Context) error {
+		if !models.HasRole(tokenRole(c), models.RoleAdmin) {
+			return forbidden(c, models.RoleAdmin)
+		}
+		return next(c)
+	})
+}
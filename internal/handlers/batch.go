@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// maxBatchSize is how many books POST /api/v1/books/batch accepts at once
+const maxBatchSize = 1000
+
+// maxBatchBodySize is the largest body of the routes that take up to
+// maxBatchSize books, in bytes
+const maxBatchBodySize = 8 << 20
+
+// Outcomes of the books of a batch
+const (
+	batchCreated   = "created"
+	batchDuplicate = "duplicate"
+	batchInvalid   = "invalid"
+	batchQuota     = "quota_exceeded"
+	batchFailed    = "failed"
+)
+
+// batchResult reports what happened to one book of a batch
+type batchResult struct {
+	Index  int               `json:"index"`
+	ID     string            `json:"id"`
+	Status string            `json:"status"`
+	Errors map[string]string `json:"errors,omitempty"`
+	// DuplicateOf is the ID of the stored book an imported one duplicates
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+}
+
+// createBatch serves POST /api/v1/books/batch. The valid books are stored
+// with one bulk insert; the response lists the outcome of every book in the
+// order they were sent, along with the number created.
+func (a *API) createBatch(c echo.Context) error {
+	var reqs []bookRequest
+	if err := c.Bind(&reqs); err != nil {
+		return bindFailed(c, err)
+	}
+	if len(reqs) == 0 {
+		return problem.Respond(c, http.StatusUnprocessableEntity, "the batch holds no books")
+	}
+	if len(reqs) > maxBatchSize {
+		return problem.Respond(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("a batch holds at most %d books", maxBatchSize))
+	}
+	results := make([]batchResult, len(reqs))
+	for i, req := range reqs {
+		results[i] = batchResult{Index: i, ID: req.ID}
+	}
+	return a.storeBatch(c, reqs, results)
+}
+
+// storeBatch stores the books of reqs whose results have no status yet with
+// one bulk insert, and responds with every result and the number created.
+// Once the MAX_BOOKS quota is reached, the remaining books are not stored.
+func (a *API) storeBatch(c echo.Context, reqs []bookRequest, results []batchResult) error {
+	ctx := c.Request().Context()
+	remaining, err := a.remainingQuota(ctx)
+	if err != nil {
+		return storeFailed(c, "remainingQuota", err)
+	}
+
+	var books []models.BookStore
+	var pending []int // indexes of books, into results
+	for i, req := range reqs {
+		if results[i].Status != "" {
+			continue
+		}
+		if errs := req.validate(); len(errs) > 0 {
+			results[i].Status, results[i].Errors = batchInvalid, errs
+			continue
+		}
+		if remaining >= 0 && int64(len(books)) >= remaining {
+			results[i].Status = batchQuota
+			continue
+		}
+		books = append(books, req.toBook())
+		pending = append(pending, i)
+	}
+
+	created := 0
+	if len(books) > 0 {
+		errs, err := a.store.CreateBooks(ctx, books)
+		if err != nil {
+			return storeFailed(c, "CreateBooks", err)
+		}
+		for j, err := range errs {
+			r := &results[pending[j]]
+			switch {
+			case err == nil:
+				r.Status = batchCreated
+				created++
+			case errors.Is(err, store.ErrDuplicate):
+				r.Status = batchDuplicate
+			case errors.Is(err, store.ErrInvalid):
+				r.Status, r.Errors = batchInvalid, map[string]string{"book": "rejected by the database schema"}
+			default:
+				logError(c, "CreateBooks", err)
+				r.Status = batchFailed
+			}
+		}
+	}
+	return respond(c, http.StatusOK, map[string]interface{}{"created": created, "results": results})
+}
+
+// removeMany serves DELETE /api/v1/books, moving books to the trash. The
+// books to delete are named by the IDs in the body, {"ids": [...]}, by the
+// filters of GET /api/v1/books in the query string, like
+// ?author=...&year=..., or by both, in which case a book must match all of
+// them. Requests naming no books are refused, so a forgotten filter cannot
+// empty the store.
+func (a *API) removeMany(c echo.Context) error {
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return bindFailed(c, err)
+	}
+	q, err := bulkQuery(req.IDs, c.QueryParams())
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, err.Error())
+	}
+	if !namesBooks(q) {
+		return problem.Respond(c, http.StatusUnprocessableEntity, "name the books to delete with ids in the body or with filters")
+	}
+	deleted, err := a.store.DeleteBooks(c.Request().Context(), q)
+	if err != nil {
+		return storeFailed(c, "DeleteBooks", err)
+	}
+	ids := make([]string, len(deleted))
+	for i, book := range deleted {
+		ids[i] = book.ID
+	}
+	return respond(c, http.StatusOK, map[string]interface{}{"message": "books moved to the trash", "deleted": len(ids), "ids": ids})
+}
+
+// bulkFields are the fields POST /api/v1/books/bulk-update may set
+var bulkFields = map[string]bool{"title": true, "author": true, "pages": true, "edition": true, "year": true}
+
+// updateMany serves POST /api/v1/books/bulk-update. The body names the books
+// like DELETE /api/v1/books, with ids and with filters written as the query
+// parameters of GET /api/v1/books, and the values to set:
+//
+//	{"filter": {"author": "Mary Shelly"}, "set": {"author": "Mary Shelley"}}
+//
+// An empty value clears a field. All books are changed in one transaction,
+// which MongoDB only runs on a replica set; the response holds how many books
+// matched and which of them were modified.
+func (a *API) updateMany(c echo.Context) error {
+	var req struct {
+		IDs    []string          `json:"ids"`
+		Filter map[string]string `json:"filter"`
+		Set    map[string]string `json:"set"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return bindFailed(c, err)
+	}
+	params := url.Values{}
+	for key, value := range req.Filter {
+		params.Set(key, value)
+	}
+	q, err := bulkQuery(req.IDs, params)
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, err.Error())
+	}
+	if !namesBooks(q) {
+		return problem.Respond(c, http.StatusUnprocessableEntity, "name the books to update with ids or filter")
+	}
+	if len(req.Set) == 0 {
+		return problem.Respond(c, http.StatusUnprocessableEntity, "no fields to update")
+	}
+	errs := validatePatched(req.Set)
+	for name := range req.Set {
+		if !bulkFields[name] {
+			errs[name] = "cannot be set in bulk"
+		}
+	}
+	if len(errs) > 0 {
+		return validationFailed(c, errs)
+	}
+
+	var matched int64
+	var updated []models.BookStore
+	err = a.store.WithTransaction(c.Request().Context(), func(ctx context.Context) error {
+		var err error
+		matched, updated, err = a.store.UpdateBooks(ctx, q, req.Set)
+		return err
+	})
+	if err != nil {
+		return storeFailed(c, "UpdateBooks", err)
+	}
+	ids := make([]string, len(updated))
+	for i, book := range updated {
+		ids[i] = book.ID
+	}
+	return respond(c, http.StatusOK, map[string]interface{}{"message": "books updated", "matched": matched, "modified": len(ids), "ids": ids})
+}
+
+// bulkQuery selects the books of a bulk operation: those with one of ids,
+// if any are given, that match the filters in params, see parseQueryFilters,
+// and the author and year parameters. Other parameters are refused, since
+// ignoring a mistyped filter would hit more books than intended.
+func bulkQuery(ids []string, params url.Values) (store.BookQuery, error) {
+	for key := range params {
+		if key != "author" && key != "year" && !strings.Contains(key, "_") {
+			return store.BookQuery{}, fmt.Errorf("unknown filter %q", key)
+		}
+	}
+	conds, err := parseQueryFilters(params)
+	if err != nil {
+		return store.BookQuery{}, err
+	}
+	q := store.BookQuery{Conditions: conds, Author: params.Get("author"), Year: params.Get("year")}
+	if len(ids) > 0 {
+		q.IDs = ids
+	}
+	return q, nil
+}
+
+// namesBooks reports whether q restricts the books at all. Bulk operations
+// refuse queries that do not, so a forgotten filter cannot hit every book.
+func namesBooks(q store.BookQuery) bool {
+	return q.IDs != nil || len(q.Conditions) > 0 || q.Author != "" || q.Year != ""
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// bibtexType is the media type of the BibTeX responses
+const bibtexType = "text/x-bibtex; charset=utf-8"
+
+// bibtexEscaper escapes the characters TeX treats specially, so that field
+// values keep their braces balanced and print as stored
+var bibtexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`&`, `\&`,
+	`%`, `\%`,
+	`$`, `\$`,
+	`#`, `\#`,
+	`_`, `\_`,
+	`~`, `\textasciitilde{}`,
+	`^`, `\textasciicircum{}`,
+)
+
+// isbnPattern matches ISBN-10 and ISBN-13 without hyphens. Books often
+// carry their ISBN in the edition field.
+var isbnPattern = regexp.MustCompile(`^(\d{9}[\dXx]|97[89]\d{10})$`)
+
+// isISBN reports whether edition is an ISBN, with or without hyphens
+func isISBN(edition string) bool {
+	return isbnPattern.MatchString(strings.ReplaceAll(edition, "-", ""))
+}
+
+// citeKeyPattern matches the characters a citation key may not contain
+var citeKeyPattern = regexp.MustCompile(`[^A-Za-z0-9_:.-]+`)
+
+// writeBibTeX writes book to w as a @book entry. Its ID, which is unique,
+// is the citation key; empty fields are left out.
+func writeBibTeX(w io.Writer, book models.BookStore) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "@book{%s,\n", citeKeyPattern.ReplaceAllString(book.ID, "_"))
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "  %-9s = {%s},\n", name, bibtexEscaper.Replace(value))
+		}
+	}
+	field("title", book.BookName)
+	field("author", book.BookAuthor)
+	if isISBN(book.BookEdition) {
+		field("isbn", book.BookEdition)
+	} else {
+		field("edition", book.BookEdition)
+	}
+	field("year", book.BookYear)
+	field("pagetotal", book.BookPages)
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// bibtex serves GET /api/v1/books/:id/bibtex: the book as a BibTeX entry,
+// ready to be pasted into a bibliography
+func (a *API) bibtex(c echo.Context) error {
+	book, err := a.store.GetBook(c.Request().Context(), c.Param("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		return problem.Respond(c, http.StatusNotFound, "book not found")
+	}
+	if err != nil {
+		return storeFailed(c, "GetBook", err)
+	}
+	var buf bytes.Buffer
+	writeBibTeX(&buf, book) // writing to a bytes.Buffer does not fail
+	return c.Blob(http.StatusOK, bibtexType, buf.Bytes())
+}
+
+// bibtexEncoder writes books as the entries of a BibTeX file
+type bibtexEncoder struct {
+	buf *bufio.Writer
+	n   int
+}
+
+// newBibTeXEncoder returns an encoder writing to w
+func newBibTeXEncoder(w io.Writer) (bookEncoder, error) {
+	return &bibtexEncoder{buf: bufio.NewWriter(w)}, nil
+}
+
+// Encode writes book, separated from the previous entry by a blank line
+func (e *bibtexEncoder) Encode(book models.BookStore) error {
+	if e.n++; e.n > 1 {
+		if err := e.buf.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return writeBibTeX(e.buf, book)
+}
+
+func (e *bibtexEncoder) Flush() error {
+	return e.buf.Flush()
+}
+
+// exportBibTeX serves GET /api/v1/books/export.bib: the books as a BibTeX
+// file
+func (a *API) exportBibTeX(c echo.Context) error {
+	return a.exportBooks(c, bibtexType, "books.bib", newBibTeXEncoder)
+}
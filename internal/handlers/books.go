@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// textSearchLimit caps the number of results of a full-text search.
+const textSearchLimit = 50
+
+// list serves GET /api/v1/books. Unpaginated queries return the plain list of
+// books, paginated ones a bookPage including the total number of matches.
+func (a *API) list(c echo.Context) error {
+	q, err := parseBookQuery(c.QueryParams())
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, err.Error())
+	}
+	if data, ok := a.cachedList(c); ok {
+		return respondCached(c, data)
+	}
+	books, err := sharedRead(c.Request().Context(), c.Request().URL.RequestURI(), func(ctx context.Context) (interface{}, error) {
+		books, total, err := a.store.ListBooks(ctx, q)
+		if err != nil || q.Page == 0 {
+			return bookMaps(books), err
+		}
+		return bookPage{
+			Books:      bookMaps(books),
+			Page:       q.Page,
+			Limit:      q.Limit,
+			Total:      total,
+			TotalPages: (total + q.Limit - 1) / q.Limit,
+		}, nil
+	})
+	if err != nil {
+		return storeFailed(c, "ListBooks", err)
+	}
+	data, err := json.Marshal(books)
+	if err != nil {
+		logError(c, "Marshal", err)
+		return problem.Respond(c, http.StatusInternalServerError, "internal server error")
+	}
+	a.cacheList(c, data)
+	return respondTagged(c, data)
+}
+
+// get serves GET /api/v1/books/:id
+func (a *API) get(c echo.Context) error {
+	id := c.Param("id")
+	if data, ok := a.cachedBook(c, id); ok {
+		return respondCached(c, data)
+	}
+	result, err := sharedRead(c.Request().Context(), c.Request().URL.RequestURI(), func(ctx context.Context) (models.BookStore, error) {
+		return a.store.GetBook(ctx, id)
+	})
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return problem.Respond(c, http.StatusNotFound, "book not found")
+		}
+		return storeFailed(c, "GetBook", err)
+	}
+	data, err := json.Marshal(result.ToMap())
+	if err != nil {
+		logError(c, "Marshal", err)
+		return problem.Respond(c, http.StatusInternalServerError, "internal server error")
+	}
+	a.cacheBook(c, id, data)
+	return respondTagged(c, data)
+}
+
+// textSearch serves GET /api/v1/books/search: matches are ranked by
+// relevance, each with its text score
+func (a *API) textSearch(c echo.Context) error {
+	q := c.QueryParam("q")
+	if strings.TrimSpace(q) == "" {
+		return problem.Respond(c, http.StatusBadRequest, "query parameter q is required")
+	}
+	books, err := sharedRead(c.Request().Context(), c.Request().URL.RequestURI(), func(ctx context.Context) ([]map[string]interface{}, error) {
+		results, err := a.store.TextSearch(ctx, q, textSearchLimit)
+		if err != nil {
+			return nil, err
+		}
+		ret := make([]map[string]interface{}, 0, len(results))
+		for _, res := range results {
+			book := res.ToMap()
+			book["score"] = res.Score
+			ret = append(ret, book)
+		}
+		return ret, nil
+	})
+	if err != nil {
+		return storeFailed(c, "TextSearch", err)
+	}
+	return respond(c, http.StatusOK, books)
+}
+
+// search serves GET /api/v1/search. A plain search matches titles containing
+// q (ignoring case); a fuzzy search also reports the edit distance of each
+// title to q.
+func (a *API) search(c echo.Context) error {
+	q := c.QueryParam("q")
+	if strings.TrimSpace(q) == "" {
+		return problem.Respond(c, http.StatusBadRequest, "query parameter q is required")
+	}
+	fuzzy := c.QueryParam("fuzzy") == "true"
+	books, err := sharedRead(c.Request().Context(), c.Request().URL.RequestURI(), func(ctx context.Context) ([]map[string]interface{}, error) {
+		if !fuzzy {
+			books, err := a.store.SearchTitles(ctx, q)
+			return bookMaps(books), err
+		}
+		matches, err := a.store.FuzzySearch(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		ret := make([]map[string]interface{}, 0, len(matches))
+		for _, m := range matches {
+			res := m.ToMap()
+			res["distance"] = m.Distance
+			ret = append(ret, res)
+		}
+		return ret, nil
+	})
+	if err != nil {
+		return storeFailed(c, "searchBooks", err)
+	}
+	return respond(c, http.StatusOK, books)
+}
+
+// create serves POST /api/v1/books
+func (a *API) create(c echo.Context) error {
+	var req bookRequest
+	if err := c.Bind(&req); err != nil {
+		return bindFailed(c, err)
+	}
+	if errs := req.validate(); len(errs) > 0 {
+		return validationFailed(c, errs)
+	}
+	remaining, err := a.remainingQuota(c.Request().Context())
+	if err != nil {
+		return storeFailed(c, "remainingQuota", err)
+	}
+	if remaining == 0 {
+		return problem.Respond(c, http.StatusForbidden, errQuotaExceeded.Error())
+	}
+	err = a.store.CreateBook(c.Request().Context(), req.toBook())
+	if errors.Is(err, store.ErrDuplicate) {
+		return problem.Respond(c, http.StatusConflict, "duplicate entry for ID: "+req.ID)
+	}
+	if errors.Is(err, store.ErrInvalid) {
+		return problem.Respond(c, http.StatusUnprocessableEntity, "book rejected by the database schema")
+	}
+	if err != nil {
+		return storeFailed(c, "CreateBook", err)
+	}
+	return respond(c, http.StatusCreated, map[string]string{"message": "book created", "id": req.ID})
+}
+
+// update serves PUT /api/v1/books/:id. Empty fields are left unchanged; see
+// applyUpdate for the required revision. With ?upsert=true a missing book is
+// created instead, see upsert.
+func (a *API) update(c echo.Context) error {
+	id := c.Param("id")
+	var req struct {
+		ID       string `json:"id"`
+		Title    string `json:"title"`
+		Author   string `json:"author"`
+		Pages    string `json:"pages"`
+		Edition  string `json:"edition"`
+		Year     string `json:"year"`
+		Revision int64  `json:"revision"`
+		// Ignored, see bookRequest
+		CreatedAt string          `json:"created_at"`
+		Cover     json.RawMessage `json:"cover"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return bindFailed(c, err)
+	}
+	if req.ID != "" && req.ID != id {
+		return validationFailed(c, map[string]string{"id": "does not match the ID in the URL"})
+	}
+	if c.QueryParam("upsert") == "true" {
+		return a.upsert(c, bookRequest{
+			ID:       id,
+			Title:    req.Title,
+			Author:   req.Author,
+			Pages:    req.Pages,
+			Edition:  req.Edition,
+			Year:     req.Year,
+			Revision: req.Revision,
+		})
+	}
+	fields := bookRequest{Title: req.Title, Author: req.Author, Pages: req.Pages, Edition: req.Edition, Year: req.Year}.fields()
+	if len(fields) == 0 {
+		return problem.Respond(c, http.StatusUnprocessableEntity, "no fields to update")
+	}
+	if errs := models.ValidateFields(fields); len(errs) > 0 {
+		return validationFailed(c, errs)
+	}
+	return a.applyUpdate(c, id, req.Revision, fields)
+}
+
+// applyUpdate sets fields on book id for PUT and PATCH. Clients must show
+// which version of the book they are changing, either by sending the ETag of
+// GET /api/v1/books/:id as If-Match or the revision they read in the body;
+// if the book has changed since, 412 is returned.
+func (a *API) applyUpdate(c echo.Context, id string, revision int64, fields map[string]string) error {
+	if ifMatch := c.Request().Header.Get("If-Match"); ifMatch != "" {
+		current, err := a.store.GetBook(c.Request().Context(), id)
+		if errors.Is(err, store.ErrNotFound) {
+			return problem.Respond(c, http.StatusNotFound, "book not found")
+		}
+		if err != nil {
+			return storeFailed(c, "GetBook", err)
+		}
+		if !revisionMatches(ifMatch, current) {
+			return problem.Respond(c, http.StatusPreconditionFailed, "book has been changed since it was read")
+		}
+		if revision == 0 {
+			// The update must not overwrite changes made after this check.
+			revision = current.Revision
+		}
+	}
+	if revision == 0 {
+		return problem.Respond(c, http.StatusPreconditionRequired, "If-Match header or revision is required")
+	}
+	return a.writeUpdate(c, id, revision, fields)
+}
+
+// writeUpdate sets fields on book id if it is at revision, or whatever its
+// revision if that is 0, and answers with the new revision
+func (a *API) writeUpdate(c echo.Context, id string, revision int64, fields map[string]string) error {
+	book, err := a.store.UpdateBook(c.Request().Context(), id, revision, fields)
+	if errors.Is(err, store.ErrNotFound) {
+		return problem.Respond(c, http.StatusNotFound, "book not found")
+	}
+	if errors.Is(err, store.ErrConflict) {
+		return problem.Respond(c, http.StatusPreconditionFailed, "book has been changed since it was read")
+	}
+	if errors.Is(err, store.ErrInvalid) {
+		return problem.Respond(c, http.StatusUnprocessableEntity, "book rejected by the database schema")
+	}
+	if err != nil {
+		return storeFailed(c, "UpdateBook", err)
+	}
+	return respond(c, http.StatusOK, map[string]interface{}{"message": "book updated", "id": id, "revision": book.Revision})
+}
+
+// upsert serves PUT /api/v1/books/:id?upsert=true for sync jobs that do not
+// know whether a book exists yet. A missing book is created from req and
+// answered with 201; an existing one is updated like a plain PUT and
+// answered with 200. If-Match and revision are checked when given, but not
+// required, so a sync job may overwrite the book.
+func (a *API) upsert(c echo.Context, req bookRequest) error {
+	ctx := c.Request().Context()
+	ifMatch := c.Request().Header.Get("If-Match")
+	exists, err := a.store.BookExists(ctx, req.ID)
+	if err != nil {
+		return storeFailed(c, "BookExists", err)
+	}
+	if !exists {
+		if ifMatch != "" || req.Revision != 0 {
+			return problem.Respond(c, http.StatusPreconditionFailed, "book does not exist")
+		}
+		if errs := req.validate(); len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+		remaining, err := a.remainingQuota(ctx)
+		if err != nil {
+			return storeFailed(c, "remainingQuota", err)
+		}
+		if remaining == 0 {
+			return problem.Respond(c, http.StatusForbidden, errQuotaExceeded.Error())
+		}
+		err = a.store.CreateBook(ctx, req.toBook())
+		if err == nil {
+			return respond(c, http.StatusCreated, map[string]interface{}{"message": "book created", "id": req.ID, "revision": 1})
+		}
+		if errors.Is(err, store.ErrInvalid) {
+			return problem.Respond(c, http.StatusUnprocessableEntity, "book rejected by the database schema")
+		}
+		if !errors.Is(err, store.ErrDuplicate) {
+			return storeFailed(c, "CreateBook", err)
+		}
+		// Created concurrently; update it like any existing book.
+	}
+	fields := req.fields()
+	if len(fields) == 0 {
+		return problem.Respond(c, http.StatusUnprocessableEntity, "no fields to update")
+	}
+	if errs := models.ValidateFields(fields); len(errs) > 0 {
+		return validationFailed(c, errs)
+	}
+	if ifMatch == "" && req.Revision == 0 {
+		return a.writeUpdate(c, req.ID, 0, fields)
+	}
+	return a.applyUpdate(c, req.ID, req.Revision, fields)
+}
+
+// remove serves DELETE /api/v1/books/:id. The book is moved to the trash,
+// see listTrash.
+func (a *API) remove(c echo.Context) error {
+	id := c.Param("id")
+	err := a.store.DeleteBook(c.Request().Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		return problem.Respond(c, http.StatusNotFound, "book not found")
+	}
+	if err != nil {
+		return storeFailed(c, "DeleteBook", err)
+	}
+	return respond(c, http.StatusOK, map[string]string{"message": "book moved to the trash", "id": id})
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestCreateOverQuota(t *testing.T) {
+	st := newMemory(t, frankenstein)
+	e := newTestServer(st, Config{MaxBooks: 2})
+
+	rec := serve(e, http.MethodPost, "/api/v1/books", `{"id": "10", "title": "Dracula", "author": "Bram Stoker"}`)
+	wantStatus(t, rec, http.StatusCreated)
+	rec = serve(e, http.MethodPost, "/api/v1/books", `{"id": "11", "title": "Carmilla", "author": "Sheridan Le Fanu"}`)
+	wantStatus(t, rec, http.StatusForbidden)
+	if n := countBooks(t, st); n != 2 {
+		t.Errorf("%d books stored, want 2", n)
+	}
+
+	rec = serve(e, http.MethodPut, "/api/v1/books/11?upsert=true", `{"title": "Carmilla", "author": "Sheridan Le Fanu"}`)
+	wantStatus(t, rec, http.StatusForbidden)
+
+	// Books in the trash do not count.
+	rec = serve(e, http.MethodDelete, "/api/v1/books/"+frankenstein.ID, "")
+	wantStatus(t, rec, http.StatusOK)
+	rec = serve(e, http.MethodPost, "/api/v1/books", `{"id": "11", "title": "Carmilla", "author": "Sheridan Le Fanu"}`)
+	wantStatus(t, rec, http.StatusCreated)
+}
+
+func TestIdempotencyKeyPerCaller(t *testing.T) {
+	const secret = "test-secret"
+	st := newMemory(t)
+	e := newTestServer(st, Config{JWTSecret: secret})
+	bearer := func(user string) string {
+		claims := jwt.MapClaims{"sub": user, "role": models.RoleEditor, "exp": time.Now().Add(time.Hour).Unix()}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + token
+	}
+	body := `{"id": "10", "title": "Dracula", "author": "Bram Stoker"}`
+
+	rec := serve(e, http.MethodPost, "/api/v1/books", body, "Authorization", bearer("alice"), "Idempotency-Key", "k1")
+	wantStatus(t, rec, http.StatusCreated)
+	rec = serve(e, http.MethodPost, "/api/v1/books", body, "Authorization", bearer("alice"), "Idempotency-Key", "k1")
+	wantStatus(t, rec, http.StatusCreated)
+	if rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("retry of the same caller was not replayed")
+	}
+
+	// Another caller with the same key runs its own request.
+	rec = serve(e, http.MethodPost, "/api/v1/books", body, "Authorization", bearer("bob"), "Idempotency-Key", "k1")
+	wantStatus(t, rec, http.StatusConflict)
+	if rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("response of another caller was replayed")
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/labstack/echo/v4"
+)
+
+// cacheHeader tells clients whether a cacheable response was served from
+// the cache (HIT) or from the database (MISS)
+const cacheHeader = "X-Cache"
+
+// listCacheKey identifies a list query independently of the order of its
+// parameters
+func listCacheKey(c echo.Context) string {
+	return c.QueryParams().Encode()
+}
+
+// respondCached answers with data taken from the cache
+func respondCached(c echo.Context, data []byte) error {
+	c.Response().Header().Set(cacheHeader, "HIT")
+	return respondTagged(c, data)
+}
+
+// cachedList returns the cached response of the list query of c
+func (a *API) cachedList(c echo.Context) ([]byte, bool) {
+	if a.conf.Cache == nil {
+		return nil, false
+	}
+	return a.conf.Cache.GetList(c.Request().Context(), listCacheKey(c))
+}
+
+// cacheList stores data, the encoded response of the list query of c
+func (a *API) cacheList(c echo.Context, data []byte) {
+	if a.conf.Cache != nil {
+		c.Response().Header().Set(cacheHeader, "MISS")
+		a.conf.Cache.SetList(c.Request().Context(), listCacheKey(c), data)
+	}
+}
+
+// cachedBook returns the cached response of book id
+func (a *API) cachedBook(c echo.Context, id string) ([]byte, bool) {
+	if a.conf.Cache == nil {
+		return nil, false
+	}
+	return a.conf.Cache.GetBook(c.Request().Context(), id)
+}
+
+// cacheBook stores data, the encoded response of book id
+func (a *API) cacheBook(c echo.Context, id string, data []byte) {
+	if a.conf.Cache != nil {
+		c.Response().Header().Set(cacheHeader, "MISS")
+		a.conf.Cache.SetBook(c.Request().Context(), id, data)
+	}
+}
+
+// cacheStats serves GET /api/v1/cache/stats: the hits, misses and hit rate
+// of the response cache of this process
+func (a *API) cacheStats(c echo.Context) error {
+	if a.conf.Cache == nil {
+		return problem.Respond(c, http.StatusNotFound, "response cache is disabled")
+	}
+	return respond(c, http.StatusOK, a.conf.Cache.Stats())
+}
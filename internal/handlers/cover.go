@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// maxCoverSize is the largest cover image accepted, in bytes
+const maxCoverSize = 5 << 20
+
+// maxCoverFormSize is the largest form with a cover accepted, leaving room
+// for the rest of the form
+const maxCoverFormSize = maxCoverSize + 64<<10
+
+// coverTypes are the image formats accepted as covers, which browsers can
+// display
+var coverTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// uploadCover serves POST /api/v1/books/:id/cover, which sets the cover of
+// the book to the image in the file field of a multipart form. The format
+// is told by the content of the file, not by the type the client declares.
+// The thumbnails of the cover are made here, so that serving them costs no
+// more than serving the image.
+func (a *API) uploadCover(c echo.Context) error {
+	fh, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || (fh != nil && fh.Size > maxCoverSize) {
+		return problem.Respond(c, http.StatusRequestEntityTooLarge, "the cover may be at most "+strconv.Itoa(maxCoverSize>>20)+" MiB")
+	}
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "the form has no file")
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "the file cannot be read")
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, "the file cannot be read")
+	}
+	contentType := http.DetectContentType(data)
+	if !coverTypes[contentType] {
+		return problem.Respond(c, http.StatusUnsupportedMediaType, "the cover must be a JPEG, PNG, GIF or WebP image")
+	}
+
+	thumbnails, err := coverThumbnails(data)
+	if errors.Is(err, errCoverDimensions) {
+		return problem.Respond(c, http.StatusRequestEntityTooLarge, "the cover may have at most "+strconv.Itoa(maxCoverPixels/1_000_000)+" million pixels")
+	}
+	if err != nil {
+		return problem.Respond(c, http.StatusUnprocessableEntity, "the image cannot be decoded")
+	}
+
+	cover := models.Cover{ContentType: contentType, Size: int64(len(data)), UploadedAt: time.Now().UTC()}
+	book, err := a.store.SetCover(c.Request().Context(), c.Param("id"), cover, data, thumbnails)
+	if errors.Is(err, store.ErrNotFound) {
+		return problem.Respond(c, http.StatusNotFound, "book not found")
+	}
+	if err != nil {
+		return storeFailed(c, "SetCover", err)
+	}
+	return respond(c, http.StatusOK, map[string]interface{}{"message": "cover uploaded", "id": book.ID, "cover": book.ToMap()["cover"]})
+}
+
+// getCover serves GET /api/v1/books/:id/cover: the cover image of the book,
+// or with ?size= one of its thumbnails. Each upload gets a new ETag, so
+// browsers may keep the image until the cover changes.
+func (a *API) getCover(c echo.Context) error {
+	size := c.QueryParam("size")
+	if _, ok := models.CoverSizes[size]; size != "" && !ok {
+		return problem.Respond(c, http.StatusBadRequest, "size must be thumb or medium")
+	}
+	cover, img, err := a.store.OpenCover(c.Request().Context(), c.Param("id"), size)
+	if errors.Is(err, store.ErrNotFound) {
+		return problem.Respond(c, http.StatusNotFound, "cover not found")
+	}
+	if err != nil {
+		return storeFailed(c, "OpenCover", err)
+	}
+	defer img.Close()
+	etag := `"` + cover.FileID + `"`
+	h := c.Response().Header()
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Last-Modified", cover.UploadedAt.UTC().Format(http.TimeFormat))
+	if inm := c.Request().Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	h.Set(echo.HeaderContentLength, strconv.FormatInt(cover.Size, 10))
+	return c.Stream(http.StatusOK, cover.ContentType, img)
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/CAPS-Cloud/exercises/internal/lookup"
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// enrichment returns the fields found that book should get: the pages and
+// year it lacks, and the title as the catalog spells it. Values the API
+// would not accept are left out.
+func enrichment(book models.BookStore, found lookup.Book) map[string]string {
+	changes := map[string]string{}
+	if book.BookPages == "" && found.Pages != "" {
+		changes["pages"] = found.Pages
+	}
+	if book.BookYear == "" && found.Year != "" {
+		changes["year"] = found.Year
+	}
+	if found.Title != "" && found.Title != book.BookName {
+		changes["title"] = found.Title
+	}
+	for name := range models.ValidateFields(changes) {
+		delete(changes, name)
+	}
+	return changes
+}
+
+// enrich serves POST /api/v1/books/:id/enrich, which looks up the ISBN in
+// the edition of the book on OpenLibrary and fills in what the book lacks.
+// With ?dry_run=true the changes are only reported. The book is updated at
+// the revision it was read, and If-Match is checked when given.
+func (a *API) enrich(c echo.Context) error {
+	if a.conf.OpenLibrary == nil {
+		return problem.Respond(c, http.StatusNotImplemented, "metadata lookup is not configured")
+	}
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	book, err := a.store.GetBook(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return problem.Respond(c, http.StatusNotFound, "book not found")
+	}
+	if err != nil {
+		return storeFailed(c, "GetBook", err)
+	}
+	if ifMatch := c.Request().Header.Get("If-Match"); ifMatch != "" && !revisionMatches(ifMatch, book) {
+		return problem.Respond(c, http.StatusPreconditionFailed, "book has been changed since it was read")
+	}
+	if !isISBN(book.BookEdition) {
+		return problem.Respond(c, http.StatusUnprocessableEntity, "the edition of the book is not an ISBN")
+	}
+	isbn := strings.ReplaceAll(book.BookEdition, "-", "")
+
+	found, err := a.conf.OpenLibrary.LookupISBN(ctx, isbn)
+	if errors.Is(err, lookup.ErrNotFound) {
+		return problem.Respond(c, http.StatusNotFound, "ISBN not found on OpenLibrary")
+	}
+	if err != nil {
+		logError(c, "LookupISBN", err)
+		return problem.Respond(c, http.StatusBadGateway, "OpenLibrary lookup failed")
+	}
+	changes := enrichment(book, found)
+	dryRun := c.QueryParam("dry_run") == "true"
+	revision := book.Revision
+	if !dryRun && len(changes) > 0 {
+		updated, err := a.store.UpdateBook(ctx, id, book.Revision, changes)
+		if err != nil {
+			return storeFailed(c, "UpdateBook", err)
+		}
+		revision = updated.Revision
+	}
+	return respond(c, http.StatusOK, map[string]interface{}{
+		"id":       id,
+		"isbn":     isbn,
+		"dry_run":  dryRun,
+		"changes":  changes,
+		"revision": revision,
+	})
+}
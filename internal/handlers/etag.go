@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+// etagOf returns the entity tag of an encoded payload. The tag is weak
+// because the payload may be sent with or without the envelope.
+func etagOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether the If-None-Match header lists etag. Tags are
+// compared weakly, as RFC 9110 requires for If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// respondTagged answers with data, the encoded payload, and its ETag. A
+// client already holding the payload, as told by If-None-Match, gets 304
+// without a body.
+func respondTagged(c echo.Context, data []byte) error {
+	etag := etagOf(data)
+	c.Response().Header().Set("ETag", etag)
+	if inm := c.Request().Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return respond(c, http.StatusOK, json.RawMessage(data))
+}
+
+// revisionMatches reports whether the If-Match header of a write names the
+// current version of book: its ETag as served by GET /api/v1/books/:id, or
+// "*". The served tags are weak only because of the optional envelope, so
+// they are compared weakly too.
+func revisionMatches(ifMatch string, book models.BookStore) bool {
+	data, err := json.Marshal(book.ToMap())
+	if err != nil {
+		return false
+	}
+	return etagMatches(ifMatch, etagOf(data))
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// exportFlushEvery is after how many books an export is flushed to the
+// client
+const exportFlushEvery = 100
+
+// bookEncoder writes the books of an export in some format
+type bookEncoder interface {
+	Encode(book models.BookStore) error
+	// Flush writes what is buffered to the underlying writer
+	Flush() error
+}
+
+// exportBooks serves an export of every book, or those matching the
+// filters of GET /api/v1/books, as the attachment filename. The books are
+// read from the store and encoded one at a time, so the export is neither
+// held in memory nor capped by MAX_RESULTS, and sent in chunks.
+func (a *API) exportBooks(c echo.Context, contentType, filename string, newEncoder func(io.Writer) (bookEncoder, error)) error {
+	q, err := parseBookQuery(c.QueryParams())
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, err.Error())
+	}
+	q.Page, q.Limit = 0, 0
+	ctx := c.Request().Context()
+	w := c.Response()
+	var enc bookEncoder
+	begin := func() error {
+		w.Header().Set(echo.HeaderContentType, contentType)
+		w.Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+		w.Header().Set("X-Accel-Buffering", "no") // let nginx pass on the chunks
+		w.WriteHeader(http.StatusOK)
+		var err error
+		enc, err = newEncoder(w)
+		return err
+	}
+
+	n := 0
+	err = a.store.EachBook(ctx, q, func(book models.BookStore) error {
+		if enc == nil {
+			if err := begin(); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(book); err != nil {
+			return err
+		}
+		if n++; n%exportFlushEvery == 0 {
+			if err := enc.Flush(); err != nil {
+				return err
+			}
+			w.Flush()
+		}
+		return nil
+	})
+	if err != nil && !w.Committed {
+		return storeFailed(c, "EachBook", err)
+	}
+	if err == nil && enc == nil {
+		err = begin() // no book matched
+	}
+	if err == nil {
+		err = enc.Flush()
+	}
+	if err != nil && ctx.Err() == nil {
+		// The status is sent already; a truncated file is all the client
+		// can be told.
+		logError(c, "EachBook", err)
+	}
+	return nil
+}
+
+// csvColumns are the columns of GET /api/v1/books/export.csv
+var csvColumns = []string{"id", "title", "author", "edition", "pages", "year"}
+
+// csvEncoder writes books as the rows of a CSV file
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+// newCSVEncoder returns an encoder writing to w, starting with the header row
+func newCSVEncoder(w io.Writer) (bookEncoder, error) {
+	enc := csvEncoder{csv.NewWriter(w)}
+	return enc, enc.w.Write(csvColumns)
+}
+
+func (e csvEncoder) Encode(book models.BookStore) error {
+	return e.w.Write(csvRow(book))
+}
+
+func (e csvEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// csvRow returns the cells of book in the order of csvColumns. Cells that
+// spreadsheets would run as formulas are prefixed with a quote.
+func csvRow(book models.BookStore) []string {
+	row := []string{book.ID, book.BookName, book.BookAuthor, book.BookEdition, book.BookPages, book.BookYear}
+	for i, cell := range row {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			row[i] = "'" + cell
+		}
+	}
+	return row
+}
+
+// exportCSV serves GET /api/v1/books/export.csv: the books as a CSV file
+// with a header row, for spreadsheets
+func (a *API) exportCSV(c echo.Context) error {
+	return a.exportBooks(c, "text/csv; charset=utf-8", "books.csv", newCSVEncoder)
+}
+
+// ndjsonEncoder writes books as newline-delimited JSON
+type ndjsonEncoder struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+// newNDJSONEncoder returns an encoder writing to w
+func newNDJSONEncoder(w io.Writer) (bookEncoder, error) {
+	buf := bufio.NewWriter(w)
+	return ndjsonEncoder{buf, json.NewEncoder(buf)}, nil
+}
+
+// Encode writes book as served by GET /api/v1/books/:id, on one line
+func (e ndjsonEncoder) Encode(book models.BookStore) error {
+	return e.enc.Encode(book.ToMap())
+}
+
+func (e ndjsonEncoder) Flush() error {
+	return e.buf.Flush()
+}
+
+// exportEncoders are the formats WriteBooks writes, by name
+var exportEncoders = map[string]func(io.Writer) (bookEncoder, error){
+	"csv":    newCSVEncoder,
+	"ndjson": newNDJSONEncoder,
+}
+
+// WriteBooks writes every book in st to w in format, csv or ndjson, as the
+// export routes serve them, for exports made without the HTTP server
+func WriteBooks(ctx context.Context, st store.BookRepository, w io.Writer, format string) error {
+	newEncoder, ok := exportEncoders[format]
+	if !ok {
+		return fmt.Errorf("unknown export format %q: use csv or ndjson", format)
+	}
+	enc, err := newEncoder(w)
+	if err != nil {
+		return err
+	}
+	err = st.EachBook(ctx, store.BookQuery{}, enc.Encode)
+	if err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+// exportNDJSON serves GET /api/v1/books/export.ndjson: one JSON object per
+// book and line, for catalogs too large to fetch as one JSON array
+func (a *API) exportNDJSON(c echo.Context) error {
+	return a.exportBooks(c, "application/x-ndjson", "books.ndjson", newNDJSONEncoder)
+}
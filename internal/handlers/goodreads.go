@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// goodreadsRow is a book read from a Goodreads export
+type goodreadsRow struct {
+	BookID, Title, Author, ISBN, ISBN13, Pages, Year, OriginalYear string
+}
+
+// goodreadsColumns maps the columns of a Goodreads export that are imported
+// to the fields of goodreadsRow
+var goodreadsColumns = map[string]func(*goodreadsRow) *string{
+	"Book Id":                   func(r *goodreadsRow) *string { return &r.BookID },
+	"Title":                     func(r *goodreadsRow) *string { return &r.Title },
+	"Author":                    func(r *goodreadsRow) *string { return &r.Author },
+	"ISBN":                      func(r *goodreadsRow) *string { return &r.ISBN },
+	"ISBN13":                    func(r *goodreadsRow) *string { return &r.ISBN13 },
+	"Number of Pages":           func(r *goodreadsRow) *string { return &r.Pages },
+	"Year Published":            func(r *goodreadsRow) *string { return &r.Year },
+	"Original Publication Year": func(r *goodreadsRow) *string { return &r.OriginalYear },
+}
+
+// goodreadsValue returns a cell without the ="..." Goodreads wraps ISBNs in
+// to keep spreadsheets from reading them as numbers
+func goodreadsValue(cell string) string {
+	cell = strings.TrimSpace(cell)
+	if strings.HasPrefix(cell, `="`) && strings.HasSuffix(cell, `"`) && len(cell) >= 3 {
+		cell = cell[2 : len(cell)-1]
+	}
+	return cell
+}
+
+// toRequest maps the row to a new book. The ISBN is both its ID and its
+// edition; rows without one are identified by their Goodreads book ID.
+func (r goodreadsRow) toRequest() bookRequest {
+	req := bookRequest{
+		Title:   r.Title,
+		Author:  r.Author,
+		Pages:   r.Pages,
+		Year:    r.Year,
+		Edition: r.ISBN13,
+	}
+	if req.Edition == "" {
+		req.Edition = r.ISBN
+	}
+	if req.Year == "" {
+		req.Year = r.OriginalYear
+	}
+	switch {
+	case req.Edition != "":
+		req.ID = req.Edition
+	case r.BookID != "":
+		req.ID = "goodreads-" + r.BookID
+	}
+	return req
+}
+
+var (
+	// errNotGoodreads is returned for CSV files without the columns of a
+	// Goodreads export
+	errNotGoodreads = errors.New("not a Goodreads export")
+	// errTooManyRows is returned for imports of more than maxBatchSize books
+	errTooManyRows = fmt.Errorf("an import holds at most %d books", maxBatchSize)
+)
+
+// readGoodreads reads the rows of the Goodreads export r, at most limit
+// of them
+func readGoodreads(r io.Reader, limit int) ([]goodreadsRow, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	header[0] = strings.TrimPrefix(header[0], "\ufeff") // written by Excel
+	fields := make([]func(*goodreadsRow) *string, len(header))
+	present := map[string]bool{}
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		fields[i] = goodreadsColumns[name]
+		present[name] = true
+	}
+	for _, name := range []string{"Title", "Author"} {
+		if !present[name] {
+			return nil, fmt.Errorf("%w: no %s column", errNotGoodreads, name)
+		}
+	}
+
+	var rows []goodreadsRow
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == limit {
+			return nil, errTooManyRows
+		}
+		var row goodreadsRow
+		for i, cell := range record {
+			if fields[i] != nil {
+				*fields[i](&row) = goodreadsValue(cell)
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// dedupKeys returns the keys under which book is found when looking for
+// duplicates: its ISBN and its title together with its author, both
+// ignoring case and hyphens
+func dedupKeys(b models.BookStore) []string {
+	keys := []string{"work:" + strings.ToLower(strings.TrimSpace(b.BookName)) + "\x00" + strings.ToLower(strings.TrimSpace(b.BookAuthor))}
+	if isISBN(b.BookEdition) {
+		keys = append(keys, "isbn:"+strings.ToUpper(strings.ReplaceAll(b.BookEdition, "-", "")))
+	}
+	return keys
+}
+
+// importGoodreads serves POST /api/v1/import/goodreads, which imports the
+// "My Books" CSV export of Goodreads, sent as the body or as the file of a
+// multipart form. Title, Author, ISBN13 (or ISBN) as the edition, Year
+// Published (or Original Publication Year) and Number of Pages are mapped
+// onto new books. Books already in the catalog, or earlier in the file,
+// with the same ISBN or the same title and author are reported as
+// duplicates instead of stored again.
+func (a *API) importGoodreads(c echo.Context) error {
+	body := io.Reader(c.Request().Body)
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		fh, err := c.FormFile("file")
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return problem.Respond(c, http.StatusRequestEntityTooLarge, "the file is too large")
+		}
+		if err != nil {
+			return problem.Respond(c, http.StatusBadRequest, "the form has no file")
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return problem.Respond(c, http.StatusBadRequest, "the file cannot be read")
+		}
+		defer f.Close()
+		body = f
+	}
+	rows, err := readGoodreads(body, maxBatchSize)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, errTooManyRows):
+		return problem.Respond(c, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.As(err, &tooLarge):
+		return problem.Respond(c, http.StatusRequestEntityTooLarge, "the file is too large")
+	case errors.Is(err, errNotGoodreads):
+		return problem.Respond(c, http.StatusUnprocessableEntity, err.Error())
+	case err != nil:
+		return problem.Respond(c, http.StatusBadRequest, "malformed CSV: "+err.Error())
+	case len(rows) == 0:
+		return problem.Respond(c, http.StatusUnprocessableEntity, "the file holds no books")
+	}
+
+	ctx := c.Request().Context()
+	known := map[string]string{} // dedupKeys to book IDs
+	err = a.store.EachBook(ctx, store.BookQuery{}, func(book models.BookStore) error {
+		for _, key := range dedupKeys(book) {
+			known[key] = book.ID
+		}
+		return nil
+	})
+	if err != nil {
+		return storeFailed(c, "EachBook", err)
+	}
+
+	reqs := make([]bookRequest, len(rows))
+	results := make([]batchResult, len(rows))
+	for i, row := range rows {
+		req := row.toRequest()
+		reqs[i], results[i] = req, batchResult{Index: i, ID: req.ID}
+		if req.ID == "" {
+			results[i].Status = batchInvalid
+			results[i].Errors = map[string]string{"id": "cannot be derived without ISBN13, ISBN or Book Id"}
+			continue
+		}
+		if errs := req.validate(); len(errs) > 0 {
+			results[i].Status, results[i].Errors = batchInvalid, errs
+			continue
+		}
+		keys := dedupKeys(req.toBook())
+		for _, key := range keys {
+			if id, ok := known[key]; ok {
+				results[i].Status, results[i].DuplicateOf = batchDuplicate, id
+				break
+			}
+		}
+		if results[i].Status == "" {
+			for _, key := range keys {
+				known[key] = req.ID
+			}
+		}
+	}
+	return a.storeBatch(c, reqs, results)
+}
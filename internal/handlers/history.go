@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// listHistory serves GET /api/v1/books/:id/history: the current revision of
+// the book and the versions it replaced, newest first. Each version is
+// numbered by the revision the book had.
+func (a *API) listHistory(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	book, err := a.store.GetBook(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return problem.Respond(c, http.StatusNotFound, "book not found")
+	}
+	if err != nil {
+		return storeFailed(c, "GetBook", err)
+	}
+	versions, err := a.store.ListBookVersions(ctx, id)
+	if err != nil {
+		return storeFailed(c, "ListBookVersions", err)
+	}
+	return respond(c, http.StatusOK, map[string]interface{}{"id": id, "revision": book.Revision, "versions": versions})
+}
+
+// revert serves POST /api/v1/books/:id/revert/:version, which sets the
+// fields of the book back to those of a previous version. The revert is an
+// update like any other, so it can be reverted in turn, and its
+// precondition is that of PUT: If-Match or the revision in the body,
+// {"revision": 3}.
+func (a *API) revert(c echo.Context) error {
+	var req struct {
+		Revision int64 `json:"revision"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return bindFailed(c, err)
+	}
+	version, err := strconv.ParseInt(c.Param("version"), 10, 64)
+	if err != nil || version < 1 {
+		return problem.Respond(c, http.StatusBadRequest, "version must be a positive integer")
+	}
+	id := c.Param("id")
+	v, err := a.store.GetBookVersion(c.Request().Context(), id, version)
+	if errors.Is(err, store.ErrNotFound) {
+		return problem.Respond(c, http.StatusNotFound, "version not found")
+	}
+	if err != nil {
+		return storeFailed(c, "GetBookVersion", err)
+	}
+	return a.applyUpdate(c, id, req.Revision, v.Fields())
+}
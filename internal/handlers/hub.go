@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// wsWriteTimeout bounds how long a message may take to reach a client.
+	wsWriteTimeout = 10 * time.Second
+	// wsPingInterval is how often idle clients are pinged; a client that
+	// does not answer within wsPongTimeout is dropped.
+	wsPingInterval = 30 * time.Second
+	wsPongTimeout  = 2 * wsPingInterval
+	// wsClientBuffer is how many notifications a client may fall behind
+	// before it is disconnected.
+	wsClientBuffer = 64
+)
+
+// upgrader keeps gorilla's check that a browser opens the socket from a page
+// of the same host, so that other sites cannot read the changes with the
+// visitor's cookies. nginx passes the Host the browser asked for to /ws.
+var upgrader = websocket.Upgrader{}
+
+// wsClient is one connected WebSocket
+type wsClient struct {
+	conn *websocket.Conn
+	send chan map[string]interface{}
+}
+
+// Hub broadcasts the changes of books to all connected WebSocket clients.
+// A single goroutine, Run, owns the set of clients; connections register and
+// unregister through channels.
+type Hub struct {
+	register   chan *wsClient
+	unregister chan *wsClient
+	started    atomic.Bool
+	done       chan struct{} // closed when Run returns
+}
+
+// NewHub returns a hub; it serves clients once Run has been started
+func NewHub() *Hub {
+	return &Hub{
+		register:   make(chan *wsClient),
+		unregister: make(chan *wsClient),
+		done:       make(chan struct{}),
+	}
+}
+
+// Run sends every event to the connected clients until events is closed
+func (h *Hub) Run(events <-chan store.BookEvent) {
+	h.started.Store(true)
+	defer close(h.done)
+
+	clients := map[*wsClient]bool{}
+	drop := func(cl *wsClient) {
+		if clients[cl] {
+			delete(clients, cl)
+			close(cl.send)
+		}
+	}
+	defer func() {
+		for cl := range clients {
+			drop(cl)
+		}
+	}()
+	for {
+		select {
+		case cl := <-h.register:
+			clients[cl] = true
+		case cl := <-h.unregister:
+			drop(cl)
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			msg := eventPayload(ev)
+			for cl := range clients {
+				select {
+				case cl.send <- msg:
+				default:
+					slog.Warn("WebSocket client is too slow, disconnecting it")
+					drop(cl)
+				}
+			}
+		}
+	}
+}
+
+// Serve serves GET /ws. The connection receives a JSON message like
+// {"type": "update", "id": ..., "book": {...}} for every change; messages
+// sent by the client are ignored.
+func (h *Hub) Serve(c echo.Context) error {
+	if !h.started.Load() {
+		return problem.Respond(c, http.StatusNotImplemented, "live updates require MongoDB to run as a replica set")
+	}
+	conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// The upgrader has already answered the request.
+		return nil
+	}
+	cl := &wsClient{conn: conn, send: make(chan map[string]interface{}, wsClientBuffer)}
+	select {
+	case h.register <- cl:
+	case <-h.done:
+		conn.Close()
+		return nil
+	}
+	go cl.writeLoop()
+	cl.readLoop()
+	select {
+	case h.unregister <- cl:
+	case <-h.done:
+	}
+	return nil
+}
+
+// readLoop discards incoming messages and answers pongs until the
+// connection breaks
+func (cl *wsClient) readLoop() {
+	cl.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	cl.conn.SetPongHandler(func(string) error {
+		return cl.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+	for {
+		if _, _, err := cl.conn.NextReader(); err != nil {
+			return
+		}
+	}
+}
+
+// writeLoop sends the queued messages and pings, and closes the connection
+// once the hub drops the client
+func (cl *wsClient) writeLoop() {
+	ping := time.NewTicker(wsPingInterval)
+	defer func() {
+		ping.Stop()
+		cl.conn.Close()
+	}()
+	for {
+		select {
+		case msg, ok := <-cl.send:
+			cl.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if !ok {
+				cl.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+				return
+			}
+			if err := cl.conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ping.C:
+			cl.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := cl.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
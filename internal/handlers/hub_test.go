@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+func TestWebSocketOrigin(t *testing.T) {
+	hub := NewHub()
+	events := make(chan store.BookEvent)
+	go hub.Run(events)
+	defer close(events)
+	for !hub.started.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	e := echo.New()
+	e.GET("/ws", hub.Serve)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": {srv.URL}})
+	if err != nil {
+		t.Fatalf("dial from the same origin: %v", err)
+	}
+	conn.Close()
+
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": {"https://evil.example"}})
+	if err == nil {
+		t.Fatal("dial from another origin succeeded")
+	}
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("dial from another origin = %v, want 403", resp)
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+	// maxIdempotencyKeyLength keeps clients from storing arbitrary data as keys
+	maxIdempotencyKeyLength = 255
+	// idempotencyLockTimeout is how long a claimed key waits for the response
+	// of its first request. A claim that is older belongs to a service that
+	// died while handling it, so the request may run again.
+	idempotencyLockTimeout = time.Minute
+)
+
+// bodyRecorder passes a response through and keeps a copy of its body
+type bodyRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *bodyRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// idempotent lets clients retry a POST safely. A request with an
+// Idempotency-Key header runs once; retries with the same key and body get
+// the stored response, marked with Idempotent-Replayed: true, for
+// store.IdempotencyTTL. Keys are kept per caller, see idempotencyActor, so
+// one client cannot replay the response of another. Reusing a key for another body is rejected with 422,
+// and a retry while the first request still runs with 409. Server errors are
+// not stored, so the request can be retried.
+func (a *API) idempotent(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		header := c.Request().Header.Get(idempotencyHeader)
+		if header == "" {
+			return next(c)
+		}
+		if len(header) > maxIdempotencyKeyLength {
+			return problem.Respond(c, http.StatusBadRequest, "Idempotency-Key is too long")
+		}
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return problem.Respond(c, http.StatusBadRequest, "invalid request body")
+		}
+		c.Request().Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		ctx := c.Request().Context()
+
+		// The /api alias and /api/v1 share their keys.
+		key := idempotencyActor(c) + " " + c.Request().Method + " " + trimAPIPrefix(c.Path()) + " " + header
+		rec := models.IdempotencyRecord{Key: key, Fingerprint: hex.EncodeToString(sum[:]), CreatedAt: time.Now().UTC()}
+		stored, err := a.store.ClaimIdempotencyKey(ctx, rec)
+		if errors.Is(err, store.ErrDuplicate) && stored.Status == 0 && time.Since(stored.CreatedAt) > idempotencyLockTimeout {
+			if err := a.store.ReleaseIdempotencyKey(ctx, key); err != nil {
+				logError(c, "ReleaseIdempotencyKey", err)
+			}
+			stored, err = a.store.ClaimIdempotencyKey(ctx, rec)
+		}
+		switch {
+		case errors.Is(err, store.ErrDuplicate) && stored.Fingerprint != rec.Fingerprint:
+			return problem.Respond(c, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+		case errors.Is(err, store.ErrDuplicate) && stored.Status == 0:
+			return problem.Respond(c, http.StatusConflict, "a request with this Idempotency-Key is still being processed")
+		case errors.Is(err, store.ErrDuplicate):
+			c.Response().Header().Set("Idempotent-Replayed", "true")
+			contentType := echo.MIMEApplicationJSON
+			if stored.Status >= http.StatusBadRequest {
+				contentType = problem.ContentType
+			}
+			return c.Blob(stored.Status, contentType, stored.Body)
+		case err != nil:
+			return storeFailed(c, "ClaimIdempotencyKey", err)
+		}
+
+		recorder := &bodyRecorder{ResponseWriter: c.Response().Writer}
+		c.Response().Writer = recorder
+		if err := next(c); err != nil {
+			c.Error(err)
+		}
+		// The response is stored even if the client has gone away meanwhile;
+		// that is when it will retry.
+		ctx = context.WithoutCancel(ctx)
+		if status := c.Response().Status; status >= http.StatusInternalServerError {
+			err = a.store.ReleaseIdempotencyKey(ctx, key)
+		} else {
+			err = a.store.CompleteIdempotencyKey(ctx, key, status, recorder.body.Bytes())
+		}
+		if err != nil {
+			logError(c, "storing the Idempotency-Key response", err)
+		}
+		return nil
+	}
+}
+
+// idempotencyActor names the caller that requireRole accepted: the subject
+// of its token, the ID of its API key, or its address when authentication
+// is disabled
+func idempotencyActor(c echo.Context) string {
+	if doc, ok := c.Get("apiKey").(models.APIKey); ok {
+		return "key:" + doc.ID.Hex()
+	}
+	if _, ok := c.Get("user").(*jwt.Token); ok {
+		return "user:" + tokenClaims(c).Subject
+	}
+	return "ip:" + c.RealIP()
+}
+
+// trimAPIPrefix returns a route path without its /api/v1 or /api prefix
+func trimAPIPrefix(path string) string {
+	if rest, ok := strings.CutPrefix(path, "/api/v1"); ok {
+		return rest
+	}
+	return strings.TrimPrefix(path, "/api")
+}
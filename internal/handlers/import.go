@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// errQuotaExceeded is returned when an insert would exceed MaxBooks
+var errQuotaExceeded = errors.New("book quota exceeded")
+
+// remainingQuota returns how many more books may be stored, or -1 if
+// unlimited. It is not reserved for the caller, see Config.MaxBooks.
+func (a *API) remainingQuota(ctx context.Context) (int64, error) {
+	return store.RemainingQuota(ctx, a.store, a.conf.MaxBooks)
+}
+
+// importFailure describes a record of an import that was not stored
+type importFailure struct {
+	Index int    `json:"index"`
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// importBatch serves POST /api/v1/books/import
+func (a *API) importBatch(c echo.Context) error {
+	var reqs []bookRequest
+	if err := c.Bind(&reqs); err != nil {
+		return bindFailed(c, err)
+	}
+	if c.QueryParam("atomic") == "true" {
+		return a.importBooksAtomic(c, reqs)
+	}
+	return a.importBooks(c, reqs)
+}
+
+// importBooks inserts every valid record independently and reports the ones
+// that were skipped. A failure in the middle leaves the earlier records stored.
+// Once the MAX_BOOKS quota is reached the remaining valid records are skipped
+// and counted as skipped_quota; invalid ones are still reported as failed.
+func (a *API) importBooks(c echo.Context, reqs []bookRequest) error {
+	remaining, err := a.remainingQuota(c.Request().Context())
+	if err != nil {
+		return storeFailed(c, "remainingQuota", err)
+	}
+	inserted := []string{}
+	failed := []importFailure{}
+	skippedQuota := 0
+	for i, req := range reqs {
+		if msg := validateImport(req); msg != "" {
+			failed = append(failed, importFailure{i, req.ID, msg})
+			continue
+		}
+		if remaining == 0 {
+			skippedQuota++
+			continue
+		}
+		err := a.store.CreateBook(c.Request().Context(), req.toBook())
+		if errors.Is(err, store.ErrDuplicate) {
+			failed = append(failed, importFailure{i, req.ID, "duplicate entry for ID: " + req.ID})
+			continue
+		}
+		if errors.Is(err, store.ErrInvalid) {
+			failed = append(failed, importFailure{i, req.ID, "rejected by the database schema"})
+			continue
+		}
+		if err != nil {
+			logError(c, "CreateBook", err)
+			failed = append(failed, importFailure{i, req.ID, "db error inserting book"})
+			continue
+		}
+		inserted = append(inserted, req.ID)
+		if remaining > 0 {
+			remaining--
+		}
+	}
+	return respond(c, http.StatusOK, map[string]interface{}{
+		"inserted":      inserted,
+		"failed":        failed,
+		"skipped_quota": skippedQuota,
+	})
+}
+
+// errImportRejected aborts an atomic import because one of its records is
+// invalid, with 400, or was refused by the store, with 422
+type errImportRejected struct {
+	importFailure
+	status int
+}
+
+func (e errImportRejected) Error() string {
+	return fmt.Sprintf("record %d (%s): %s", e.Index, e.ID, e.importFailure.Error)
+}
+
+// importBooksAtomic inserts all records inside one transaction, so either the
+// whole batch is stored or nothing is. On a standalone server, which cannot
+// run transactions, the import is refused.
+func (a *API) importBooksAtomic(c echo.Context, reqs []bookRequest) error {
+	err := a.store.WithTransaction(c.Request().Context(), func(ctx context.Context) error {
+		remaining, err := a.remainingQuota(ctx)
+		if err != nil {
+			return err
+		}
+		if remaining >= 0 && int64(len(reqs)) > remaining {
+			return errQuotaExceeded
+		}
+		for i, req := range reqs {
+			if msg := validateImport(req); msg != "" {
+				return errImportRejected{importFailure{i, req.ID, msg}, http.StatusBadRequest}
+			}
+			err := a.store.CreateBook(ctx, req.toBook())
+			if errors.Is(err, store.ErrDuplicate) {
+				return errImportRejected{importFailure{i, req.ID, "duplicate entry for ID: " + req.ID}, http.StatusUnprocessableEntity}
+			}
+			if errors.Is(err, store.ErrInvalid) {
+				return errImportRejected{importFailure{i, req.ID, "rejected by the database schema"}, http.StatusUnprocessableEntity}
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	var rejected errImportRejected
+	switch {
+	case err == nil:
+		return respond(c, http.StatusCreated, map[string]interface{}{"message": "books imported", "inserted": len(reqs)})
+	case errors.Is(err, errQuotaExceeded):
+		return problem.Respond(c, http.StatusForbidden, errQuotaExceeded.Error())
+	case errors.As(err, &rejected):
+		p := problem.New(c, rejected.status, "import rolled back, no books were stored")
+		p.Extra = map[string]interface{}{"failed": []importFailure{rejected.importFailure}}
+		return p.Write(c)
+	case errors.Is(err, store.ErrTransactionsUnsupported):
+		return problem.Respond(c, http.StatusNotImplemented, "atomic import requires MongoDB to run as a replica set")
+	default:
+		return storeFailed(c, "WithTransaction", err)
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/CAPS-Cloud/exercises/internal/store"
+)
+
+func TestAtomicImportRollsBackOnInvalidRecord(t *testing.T) {
+	st := newMemory(t, frankenstein)
+	e := newTestServer(st, Config{})
+	body := `[
+		{"id": "10", "title": "Dracula", "author": "Bram Stoker"},
+		{"id": "11", "author": "Anonymous"},
+		{"id": "12", "title": "Carmilla", "author": "Sheridan Le Fanu"}
+	]`
+	rec := serve(e, http.MethodPost, "/api/v1/books/import?atomic=true", body)
+	wantStatus(t, rec, http.StatusBadRequest)
+	var p struct {
+		Failed []importFailure `json:"failed"`
+	}
+	decode(t, rec, &p)
+	if len(p.Failed) != 1 || p.Failed[0].Index != 1 || p.Failed[0].ID != "11" {
+		t.Errorf("failed = %+v, want record 1 (11)", p.Failed)
+	}
+	if n := countBooks(t, st); n != 1 {
+		t.Errorf("%d books stored after the rolled back import, want 1", n)
+	}
+}
+
+func TestAtomicImportRollsBackInsertedRecords(t *testing.T) {
+	st := newMemory(t, frankenstein)
+	e := newTestServer(st, Config{})
+	body := `[
+		{"id": "10", "title": "Dracula", "author": "Bram Stoker"},
+		{"id": "12", "title": "Carmilla", "author": "Sheridan Le Fanu"},
+		{"id": "10", "title": "The Vampyre", "author": "John Polidori"}
+	]`
+	rec := serve(e, http.MethodPost, "/api/v1/books/import?atomic=true", body)
+	wantStatus(t, rec, http.StatusUnprocessableEntity)
+	var p struct {
+		Failed []importFailure `json:"failed"`
+	}
+	decode(t, rec, &p)
+	if len(p.Failed) != 1 || p.Failed[0].Index != 2 || p.Failed[0].ID != "10" {
+		t.Errorf("failed = %+v, want record 2 (10)", p.Failed)
+	}
+	for _, id := range []string{"10", "12"} {
+		if _, err := st.GetBook(context.Background(), id); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("book %s after the rolled back import: %v, want %v", id, err, store.ErrNotFound)
+		}
+	}
+}
+
+func TestAtomicImportStoresWholeBatch(t *testing.T) {
+	st := newMemory(t)
+	e := newTestServer(st, Config{})
+	body := `[{"id": "10", "title": "Dracula", "author": "Bram Stoker"}, {"id": "12", "title": "Carmilla", "author": "Sheridan Le Fanu"}]`
+	rec := serve(e, http.MethodPost, "/api/v1/books/import?atomic=true", body)
+	wantStatus(t, rec, http.StatusCreated)
+	if n := countBooks(t, st); n != 2 {
+		t.Errorf("%d books stored, want 2", n)
+	}
+}
+
+// noTransactions is a store that cannot run transactions, like a
+// standalone MongoDB server
+type noTransactions struct {
+	store.Repository
+}
+
+func (noTransactions) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return store.ErrTransactionsUnsupported
+}
+
+func TestAtomicImportWithoutTransactions(t *testing.T) {
+	st := noTransactions{newMemory(t)}
+	e := newTestServer(st, Config{})
+	rec := serve(e, http.MethodPost, "/api/v1/books/import?atomic=true", `[{"id": "10", "title": "Dracula", "author": "Bram Stoker"}]`)
+	wantStatus(t, rec, http.StatusNotImplemented)
+	if n := countBooks(t, st); n != 0 {
+		t.Errorf("%d books stored, want none", n)
+	}
+}
+
+func TestImportSkipsValidRecordsOverQuota(t *testing.T) {
+	st := newMemory(t, frankenstein)
+	e := newTestServer(st, Config{MaxBooks: 2})
+	body := `[
+		{"id": "10", "title": "Dracula", "author": "Bram Stoker"},
+		{"id": "11", "author": "Anonymous"},
+		{"id": "12", "title": "Carmilla", "author": "Sheridan Le Fanu"},
+		{"id": "13", "title": "The Vampyre", "author": "John Polidori"}
+	]`
+	rec := serve(e, http.MethodPost, "/api/v1/books/import", body)
+	wantStatus(t, rec, http.StatusOK)
+	var res struct {
+		Inserted     []string        `json:"inserted"`
+		Failed       []importFailure `json:"failed"`
+		SkippedQuota int             `json:"skipped_quota"`
+	}
+	decode(t, rec, &res)
+	if len(res.Inserted) != 1 || res.Inserted[0] != "10" {
+		t.Errorf("inserted = %v, want [10]", res.Inserted)
+	}
+	// The invalid record is reported as such, not as skipped.
+	if len(res.Failed) != 1 || res.Failed[0].ID != "11" {
+		t.Errorf("failed = %+v, want 11", res.Failed)
+	}
+	if res.SkippedQuota != 2 {
+		t.Errorf("skipped_quota = %d, want 2", res.SkippedQuota)
+	}
+	if n := countBooks(t, st); n != 2 {
+		t.Errorf("%d books stored, want 2", n)
+	}
+}
+
+func TestAtomicImportOverQuota(t *testing.T) {
+	st := newMemory(t, frankenstein)
+	e := newTestServer(st, Config{MaxBooks: 2})
+	body := `[{"id": "10", "title": "Dracula", "author": "Bram Stoker"}, {"id": "12", "title": "Carmilla", "author": "Sheridan Le Fanu"}]`
+	rec := serve(e, http.MethodPost, "/api/v1/books/import?atomic=true", body)
+	wantStatus(t, rec, http.StatusForbidden)
+	if n := countBooks(t, st); n != 1 {
+		t.Errorf("%d books stored, want 1", n)
+	}
+}
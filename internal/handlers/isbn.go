@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/CAPS-Cloud/exercises/internal/lookup"
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// createByISBN serves POST /api/v1/books/isbn/:isbn, which creates a book
+// from what Google Books knows about the ISBN, so that scanning the barcode
+// is enough to add a book. The ISBN, without hyphens, is both the ID and
+// the edition of the new book.
+func (a *API) createByISBN(c echo.Context) error {
+	if a.conf.GoogleBooks == nil {
+		return problem.Respond(c, http.StatusNotImplemented, "metadata lookup is not configured")
+	}
+	if !isISBN(c.Param("isbn")) {
+		return problem.Respond(c, http.StatusBadRequest, "not an ISBN-10 or ISBN-13")
+	}
+	isbn := strings.ToUpper(strings.ReplaceAll(c.Param("isbn"), "-", ""))
+	ctx := c.Request().Context()
+	// Known books and a full store are refused before the lookup, which
+	// uses up the quota of the API.
+	exists, err := a.store.BookExists(ctx, isbn)
+	if err != nil {
+		return storeFailed(c, "BookExists", err)
+	}
+	if exists {
+		return problem.Respond(c, http.StatusConflict, "duplicate entry for ID: "+isbn)
+	}
+	remaining, err := a.remainingQuota(ctx)
+	if err != nil {
+		return storeFailed(c, "remainingQuota", err)
+	}
+	if remaining == 0 {
+		return problem.Respond(c, http.StatusForbidden, errQuotaExceeded.Error())
+	}
+
+	found, err := a.conf.GoogleBooks.LookupISBN(ctx, isbn)
+	if errors.Is(err, lookup.ErrNotFound) {
+		return problem.Respond(c, http.StatusNotFound, "ISBN not found on Google Books")
+	}
+	if err != nil {
+		logError(c, "LookupISBN", err)
+		return problem.Respond(c, http.StatusBadGateway, "Google Books lookup failed")
+	}
+	req := bookRequest{
+		ID:      isbn,
+		Title:   found.Title,
+		Author:  found.Author,
+		Pages:   found.Pages,
+		Edition: isbn,
+		Year:    found.Year,
+	}
+	if errs := req.validate(); len(errs) > 0 {
+		// Google Books lacks the title or author, or has values the API
+		// does not accept; the book has to be entered by hand.
+		return validationFailed(c, errs)
+	}
+	err = a.store.CreateBook(ctx, req.toBook())
+	if errors.Is(err, store.ErrDuplicate) {
+		return problem.Respond(c, http.StatusConflict, "duplicate entry for ID: "+isbn)
+	}
+	if errors.Is(err, store.ErrInvalid) {
+		return problem.Respond(c, http.StatusUnprocessableEntity, "book rejected by the database schema")
+	}
+	if err != nil {
+		return storeFailed(c, "CreateBook", err)
+	}
+	// The fields are returned so that a scanner can show what was added.
+	return respond(c, http.StatusCreated, map[string]interface{}{"message": "book created", "id": isbn, "fields": req.fields()})
+}
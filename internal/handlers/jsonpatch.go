@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// jsonPatchAttempts is how often a JSON Patch is applied to a fresh copy of
+// the book when other writers change it in between
+const jsonPatchAttempts = 3
+
+// patchError is a JSON Patch that cannot be applied, answered with status
+type patchError struct {
+	status int
+	msg    string
+}
+
+func (e *patchError) Error() string { return e.msg }
+
+// patchOp is one operation of a JSON Patch
+type patchOp struct {
+	Op    string
+	Path  string
+	From  string
+	Value interface{}
+	// HasValue tells a null value from a missing one
+	HasValue bool
+}
+
+// jsonPatch applies a JSON Patch to the stored book: the operations run in
+// order on its JSON document, as served by GET /api/v1/books/:id, and the
+// result is validated and written only if the book has not changed in the
+// meantime; otherwise the patch is applied again to the new version. A
+// failed test operation is answered with 409, so tests on /revision or
+// If-Match guard against overwriting changes the client has not seen.
+func (a *API) jsonPatch(c echo.Context) error {
+	var raw []map[string]json.RawMessage
+	if err := c.Echo().JSONSerializer.Deserialize(c, &raw); err != nil {
+		return bindFailed(c, err)
+	}
+	ops, err := parsePatchOps(raw)
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, err.Error())
+	}
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	for attempt := 0; attempt < jsonPatchAttempts; attempt++ {
+		current, err := a.store.GetBook(ctx, id)
+		if errors.Is(err, store.ErrNotFound) {
+			return problem.Respond(c, http.StatusNotFound, "book not found")
+		}
+		if err != nil {
+			return storeFailed(c, "GetBook", err)
+		}
+		if ifMatch := c.Request().Header.Get("If-Match"); ifMatch != "" && !revisionMatches(ifMatch, current) {
+			return problem.Respond(c, http.StatusPreconditionFailed, "book has been changed since it was read")
+		}
+		fields, errs, err := applyJSONPatch(current, ops)
+		var pe *patchError
+		if errors.As(err, &pe) {
+			return problem.Respond(c, pe.status, pe.msg)
+		}
+		if err != nil {
+			return storeFailed(c, "applyJSONPatch", err)
+		}
+		if len(errs) > 0 {
+			return validationFailed(c, errs)
+		}
+		if len(fields) == 0 {
+			return respond(c, http.StatusOK, map[string]interface{}{"message": "book unchanged", "id": id, "revision": current.Revision})
+		}
+		book, err := a.store.UpdateBook(ctx, id, current.Revision, fields)
+		if errors.Is(err, store.ErrConflict) {
+			continue
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			return problem.Respond(c, http.StatusNotFound, "book not found")
+		}
+		if errors.Is(err, store.ErrInvalid) {
+			return problem.Respond(c, http.StatusUnprocessableEntity, "book rejected by the database schema")
+		}
+		if err != nil {
+			return storeFailed(c, "UpdateBook", err)
+		}
+		return respond(c, http.StatusOK, map[string]interface{}{"message": "book updated", "id": id, "revision": book.Revision})
+	}
+	return problem.Respond(c, http.StatusConflict, "book kept changing while the patch was applied, try again")
+}
+
+// parsePatchOps checks the members of the operations of a JSON Patch.
+// Members the RFC does not define are ignored.
+func parsePatchOps(raw []map[string]json.RawMessage) ([]patchOp, error) {
+	ops := make([]patchOp, 0, len(raw))
+	for i, members := range raw {
+		var op patchOp
+		for name, dst := range map[string]*string{"op": &op.Op, "path": &op.Path, "from": &op.From} {
+			value, ok := members[name]
+			if !ok {
+				continue
+			}
+			if err := json.Unmarshal(value, dst); err != nil {
+				return nil, fmt.Errorf("operation %d: %q must be a string", i, name)
+			}
+		}
+		if value, ok := members["value"]; ok {
+			op.HasValue = true
+			if err := json.Unmarshal(value, &op.Value); err != nil {
+				return nil, fmt.Errorf("operation %d: invalid value", i)
+			}
+		}
+		if _, ok := members["path"]; !ok {
+			return nil, fmt.Errorf("operation %d: path is required", i)
+		}
+		switch op.Op {
+		case "add", "replace", "test":
+			if !op.HasValue {
+				return nil, fmt.Errorf("operation %d: %s requires a value", i, op.Op)
+			}
+		case "move", "copy":
+			if _, ok := members["from"]; !ok {
+				return nil, fmt.Errorf("operation %d: %s requires from", i, op.Op)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("operation %d: unknown op %q", i, op.Op)
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// applyJSONPatch runs ops on the JSON document of book and returns the
+// fields that changed, with "" for removed ones, or the per-field problems
+// of the result
+func applyJSONPatch(book models.BookStore, ops []patchOp) (map[string]string, map[string]string, error) {
+	data, err := json.Marshal(book.ToMap())
+	if err != nil {
+		return nil, nil, err
+	}
+	var original, doc map[string]interface{}
+	if err := json.Unmarshal(data, &original); err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	for i, op := range ops {
+		if err := applyPatchOp(doc, op); err != nil {
+			return nil, nil, &patchError{err.status, fmt.Sprintf("operation %d: %s", i, err.msg)}
+		}
+	}
+
+	fields, errs := map[string]string{}, map[string]string{}
+	for _, name := range []string{"id", "revision"} {
+		if !reflect.DeepEqual(doc[name], original[name]) {
+			errs[name] = "cannot be changed"
+		}
+	}
+	for _, name := range []string{"title", "author", "pages", "edition", "year"} {
+		value, ok := doc[name]
+		if !ok {
+			value = ""
+		}
+		s, ok := value.(string)
+		if !ok {
+			errs[name] = "must be a string"
+			continue
+		}
+		if s != original[name] {
+			fields[name] = s
+		}
+	}
+	for name, msg := range validatePatched(fields) {
+		errs[name] = msg
+	}
+	return fields, errs, nil
+}
+
+// applyPatchOp runs one operation on doc
+func applyPatchOp(doc map[string]interface{}, op patchOp) *patchError {
+	path, err := patchMember(op.Path)
+	if err != nil {
+		return err
+	}
+	switch op.Op {
+	case "add":
+		doc[path] = op.Value
+	case "remove", "replace", "test":
+		current, ok := doc[path]
+		if !ok {
+			return &patchError{http.StatusUnprocessableEntity, fmt.Sprintf("path %q does not exist", op.Path)}
+		}
+		switch op.Op {
+		case "remove":
+			delete(doc, path)
+		case "replace":
+			doc[path] = op.Value
+		case "test":
+			if !reflect.DeepEqual(current, op.Value) {
+				return &patchError{http.StatusConflict, fmt.Sprintf("test of %q failed", op.Path)}
+			}
+		}
+	case "move", "copy":
+		from, err := patchMember(op.From)
+		if err != nil {
+			return err
+		}
+		value, ok := doc[from]
+		if !ok {
+			return &patchError{http.StatusUnprocessableEntity, fmt.Sprintf("from %q does not exist", op.From)}
+		}
+		if op.Op == "move" {
+			delete(doc, from)
+		}
+		doc[path] = value
+	}
+	return nil
+}
+
+// patchMember returns the member of the book document that the JSON
+// Pointer pointer names. Books are flat, so only pointers like /title are
+// valid.
+func patchMember(pointer string) (string, *patchError) {
+	name, ok := strings.CutPrefix(pointer, "/")
+	if ok {
+		name = strings.NewReplacer("~1", "/", "~0", "~").Replace(name)
+	}
+	if !ok || !isBookField(name) {
+		return "", &patchError{http.StatusUnprocessableEntity, fmt.Sprintf("path %q does not name a field of the book", pointer)}
+	}
+	return name, nil
+}
+
+// isBookField reports whether name is a field of the JSON document of a book
+func isBookField(name string) bool {
+	if name == "revision" {
+		return true
+	}
+	for _, field := range models.BookFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
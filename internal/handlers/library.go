@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// Media types of the representations for library systems
+const (
+	marcXMLType = "application/marcxml+xml; charset=utf-8" // RFC 6207
+	dcXMLType   = "application/xml; charset=utf-8"
+)
+
+// marcRecord is a MARC 21 bibliographic record in MARCXML
+type marcRecord struct {
+	XMLName       xml.Name           `xml:"http://www.loc.gov/MARC21/slim record"`
+	Leader        string             `xml:"leader"`
+	ControlFields []marcControlField `xml:"controlfield"`
+	DataFields    []marcDataField    `xml:"datafield"`
+}
+
+type marcControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type marcDataField struct {
+	Tag       string         `xml:"tag,attr"`
+	Ind1      string         `xml:"ind1,attr"`
+	Ind2      string         `xml:"ind2,attr"`
+	Subfields []marcSubfield `xml:"subfield"`
+}
+
+type marcSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// marcLeader describes a new record of a monograph in Unicode whose length
+// and base address are left for the importing system to compute
+const marcLeader = "00000nam a2200000   4500"
+
+// marcHeading returns author as the heading of field 100 and its first
+// indicator: personal names are inverted to "Surname, Forenames", as
+// catalogs expect; names that already hold a comma are kept.
+func marcHeading(author string) (string, string) {
+	if strings.Contains(author, ",") {
+		return author, "1"
+	}
+	i := strings.LastIndex(author, " ")
+	if i < 0 {
+		return author, "0" // forename only
+	}
+	return author[i+1:] + ", " + author[:i], "1"
+}
+
+// marcFixedFields returns field 008 for book: the date the record was
+// entered, a single known date of publication and undetermined language
+func marcFixedFields(book models.BookStore) string {
+	entered := time.Now()
+	if book.CreatedAt != nil {
+		entered = *book.CreatedAt
+	}
+	year := book.BookYear
+	if len(year) != 4 {
+		year = "uuuu"
+	}
+	// positions 18-34 hold the material specific elements, left blank
+	return entered.UTC().Format("060102") + "s" + year + "    xx " + strings.Repeat(" ", 17) + "und d"
+}
+
+// toMARC converts book into a MARC record. Its ID is the control number,
+// an edition that is an ISBN goes into field 020 and others into 250.
+func toMARC(book models.BookStore) marcRecord {
+	rec := marcRecord{
+		Leader: marcLeader,
+		ControlFields: []marcControlField{
+			{Tag: "001", Value: book.ID},
+			{Tag: "008", Value: marcFixedFields(book)},
+		},
+	}
+	field := func(tag, ind1, ind2, code, value string) {
+		if value != "" {
+			rec.DataFields = append(rec.DataFields, marcDataField{tag, ind1, ind2, []marcSubfield{{code, value}}})
+		}
+	}
+	if isISBN(book.BookEdition) {
+		field("020", " ", " ", "a", book.BookEdition)
+	}
+	heading, ind1 := marcHeading(book.BookAuthor)
+	field("100", ind1, " ", "a", heading)
+	field("245", "1", "0", "a", book.BookName)
+	if !isISBN(book.BookEdition) {
+		field("250", " ", " ", "a", book.BookEdition)
+	}
+	field("264", " ", "1", "c", book.BookYear)
+	if book.BookPages != "" {
+		field("300", " ", " ", "a", book.BookPages+" pages")
+	}
+	return rec
+}
+
+// dublinCore is a book in the Dublin Core format of OAI-PMH, oai_dc
+type dublinCore struct {
+	XMLName        xml.Name `xml:"oai_dc:dc"`
+	NSOAI          string   `xml:"xmlns:oai_dc,attr"`
+	NSDC           string   `xml:"xmlns:dc,attr"`
+	NSXSI          string   `xml:"xmlns:xsi,attr"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+	Title          string   `xml:"dc:title"`
+	Creator        string   `xml:"dc:creator"`
+	Date           string   `xml:"dc:date,omitempty"`
+	Type           string   `xml:"dc:type"`
+	Format         string   `xml:"dc:format,omitempty"`
+	Description    string   `xml:"dc:description,omitempty"`
+	Identifiers    []string `xml:"dc:identifier"`
+}
+
+// toDublinCore converts book into Dublin Core. An edition that is an ISBN
+// becomes an identifier, others are described.
+func toDublinCore(book models.BookStore) dublinCore {
+	dc := dublinCore{
+		NSOAI:          "http://www.openarchives.org/OAI/2.0/oai_dc/",
+		NSDC:           "http://purl.org/dc/elements/1.1/",
+		NSXSI:          "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: "http://www.openarchives.org/OAI/2.0/oai_dc/ http://www.openarchives.org/OAI/2.0/oai_dc.xsd",
+		Title:          book.BookName,
+		Creator:        book.BookAuthor,
+		Date:           book.BookYear,
+		Type:           "Text",
+		Identifiers:    []string{book.ID},
+	}
+	if book.BookPages != "" {
+		dc.Format = book.BookPages + " pages"
+	}
+	if isISBN(book.BookEdition) {
+		dc.Identifiers = append(dc.Identifiers, "urn:isbn:"+strings.ReplaceAll(book.BookEdition, "-", ""))
+	} else if book.BookEdition != "" {
+		dc.Description = fmt.Sprintf("Edition: %s", book.BookEdition)
+	}
+	return dc
+}
+
+// respondXML answers c with doc, with an XML declaration
+func respondXML(c echo.Context, contentType string, doc interface{}) error {
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		logError(c, "MarshalIndent", err)
+		return problem.Respond(c, http.StatusInternalServerError, "internal server error")
+	}
+	return c.Blob(http.StatusOK, contentType, append([]byte(xml.Header), data...))
+}
+
+// marcXML serves GET /api/v1/books/:id/marcxml: the book as a MARC 21
+// record, for import into library systems
+func (a *API) marcXML(c echo.Context) error {
+	book, err := a.store.GetBook(c.Request().Context(), c.Param("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		return problem.Respond(c, http.StatusNotFound, "book not found")
+	}
+	if err != nil {
+		return storeFailed(c, "GetBook", err)
+	}
+	return respondXML(c, marcXMLType, toMARC(book))
+}
+
+// dublinCoreXML serves GET /api/v1/books/:id/dc: the book as Dublin Core,
+// as harvested from repositories over OAI-PMH
+func (a *API) dublinCoreXML(c echo.Context) error {
+	book, err := a.store.GetBook(c.Request().Context(), c.Param("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		return problem.Respond(c, http.StatusNotFound, "book not found")
+	}
+	if err != nil {
+		return storeFailed(c, "GetBook", err)
+	}
+	return respondXML(c, dcXMLType, toDublinCore(book))
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// buildInfo serves GET /api/v1/version
+func (a *API) buildInfo(c echo.Context) error {
+	return respond(c, http.StatusOK, map[string]string{
+		"version":    a.conf.Build.Version,
+		"git_commit": a.conf.Build.GitCommit,
+		"build_time": a.conf.Build.BuildTime,
+	})
+}
+
+// openAPI serves GET /api/v1/openapi.json
+func (a *API) openAPI(c echo.Context) error {
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, a.conf.OpenAPISpec)
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBuildInfo(t *testing.T) {
+	build := BuildInfo{Version: "1.4.0", GitCommit: "f43327c", BuildTime: "2026-10-16T09:30:00Z"}
+	e := newTestServer(newMemory(t), Config{Build: build})
+	// The deprecated unversioned route answers the same.
+	for _, target := range []string{"/api/v1/version", "/api/version"} {
+		rec := serve(e, http.MethodGet, target, "")
+		wantStatus(t, rec, http.StatusOK)
+		var got map[string]string
+		decode(t, rec, &got)
+		if got["version"] != build.Version || got["git_commit"] != build.GitCommit || got["build_time"] != build.BuildTime {
+			t.Errorf("GET %s = %v, want %+v", target, got, build)
+		}
+	}
+}
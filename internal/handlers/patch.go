@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/labstack/echo/v4"
+)
+
+// Media types of the patch documents accepted by PATCH /api/v1/books/:id
+const (
+	mergePatchType = "application/merge-patch+json" // RFC 7386
+	jsonPatchType  = "application/json-patch+json"  // RFC 6902
+)
+
+// patch serves PATCH /api/v1/books/:id. Depending on its Content-Type the
+// body is a JSON Patch, see jsonPatch, or a JSON Merge Patch, see
+// mergePatch; plain JSON is taken as a merge patch.
+func (a *API) patch(c echo.Context) error {
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	switch mediaType {
+	case jsonPatchType:
+		return a.jsonPatch(c)
+	case mergePatchType, echo.MIMEApplicationJSON:
+		return a.mergePatch(c)
+	}
+	c.Response().Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+	return problem.Respond(c, http.StatusUnsupportedMediaType, "Content-Type must be "+mergePatchType+" or "+jsonPatchType)
+}
+
+// mergePatch applies a JSON Merge Patch: members set to a string change the
+// field, members set to null clear it and absent members are left
+// unchanged. Title and author cannot be cleared, and the ID cannot be
+// changed. The precondition is that of PUT; see applyUpdate.
+func (a *API) mergePatch(c echo.Context) error {
+	var doc map[string]json.RawMessage
+	if err := c.Echo().JSONSerializer.Deserialize(c, &doc); err != nil {
+		return bindFailed(c, err)
+	}
+	fields, revision, err := mergePatchFields(doc)
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, err.Error())
+	}
+	if len(fields) == 0 {
+		return problem.Respond(c, http.StatusUnprocessableEntity, "no fields to update")
+	}
+	errs := validatePatched(fields)
+	if _, ok := doc["id"]; ok {
+		errs["id"] = "cannot be changed"
+	}
+	if len(errs) > 0 {
+		return validationFailed(c, errs)
+	}
+	return a.applyUpdate(c, c.Param("id"), revision, fields)
+}
+
+// mergePatchFields converts a merge patch into the fields to set, with ""
+// for the cleared ones, and the revision it is based on, if any
+func mergePatchFields(doc map[string]json.RawMessage) (map[string]string, int64, error) {
+	fields := map[string]string{}
+	var revision int64
+	for name, raw := range doc {
+		switch name {
+		case "id":
+			// Rejected by the caller as a validation error
+		case "created_at", "cover":
+			// Set by the store and by uploads; ignored like in PUT
+		case "revision":
+			if err := json.Unmarshal(raw, &revision); err != nil {
+				return nil, 0, fmt.Errorf("field %q must be an integer", name)
+			}
+		case "title", "author", "pages", "edition", "year":
+			if bytes.Equal(raw, []byte("null")) {
+				fields[name] = ""
+				continue
+			}
+			var value string
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return nil, 0, fmt.Errorf("field %q must be a string or null", name)
+			}
+			fields[name] = value
+		default:
+			return nil, 0, fmt.Errorf("unknown field %q", name)
+		}
+	}
+	return fields, revision, nil
+}
+
+// validatePatched returns the problems of the fields a patch sets, where ""
+// clears a field
+func validatePatched(fields map[string]string) map[string]string {
+	errs := models.ValidateFields(fields)
+	for _, name := range []string{"title", "author"} {
+		if value, ok := fields[name]; ok && value == "" {
+			errs[name] = "is required and cannot be removed"
+		}
+	}
+	return errs
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"golang.org/x/sync/singleflight"
+)
+
+// Pagination bounds for GET /api/books?page=&limit=
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// sortFields are the API field names accepted by ?sort=
+var sortFields = map[string]bool{"title": true, "author": true, "year": true, "pages": true}
+
+// bookPage is one page of a paginated book listing
+type bookPage struct {
+	Books      []map[string]interface{} `json:"books"`
+	Page       int64                    `json:"page"`
+	Limit      int64                    `json:"limit"`
+	Total      int64                    `json:"total"`
+	TotalPages int64                    `json:"total_pages"`
+}
+
+// parseQueryFilters turns query parameters of the form <field>_<op> (e.g.
+// title_contains=vortex, year_gte=1900) into conditions that are combined
+// with AND. Supported operators are eq, contains, gte and lte; gte and lte
+// only apply to the numeric fields pages and year. Parameters without an
+// underscore are not filters and are ignored.
+func parseQueryFilters(params url.Values) ([]store.Condition, error) {
+	var conds []store.Condition
+	for key, values := range params {
+		i := strings.LastIndex(key, "_")
+		if i < 0 {
+			continue
+		}
+		name, op := key[:i], key[i+1:]
+		if !slices.Contains(models.BookFields, name) {
+			return nil, fmt.Errorf("unknown filter field %q", name)
+		}
+		for _, value := range values {
+			switch op {
+			case "eq", "contains":
+			case "gte", "lte":
+				if !models.NumericFields[name] {
+					return nil, fmt.Errorf("operator %q is only supported on pages and year", op)
+				}
+				if _, err := strconv.Atoi(value); err != nil {
+					return nil, fmt.Errorf("%s must be an integer", key)
+				}
+			default:
+				return nil, fmt.Errorf("unknown filter operator %q", op)
+			}
+			conds = append(conds, store.Condition{Field: name, Op: op, Value: value})
+		}
+	}
+	return conds, nil
+}
+
+// parseBookQuery reads the filters (see parseQueryFilters), the
+// case-insensitive author and exact year filters, the sort order and the
+// page/limit parameters of a listing.
+func parseBookQuery(params url.Values) (store.BookQuery, error) {
+	conds, err := parseQueryFilters(params)
+	if err != nil {
+		return store.BookQuery{}, err
+	}
+	q := store.BookQuery{Conditions: conds, Author: params.Get("author"), Year: params.Get("year")}
+
+	if field, order := params.Get("sort"), params.Get("order"); field != "" || order != "" {
+		if field == "" {
+			field = "title"
+		}
+		if !sortFields[field] {
+			return store.BookQuery{}, fmt.Errorf("cannot sort by %q, use one of title, author, year, pages", field)
+		}
+		q.Sort = field
+		switch order {
+		case "", "asc":
+		case "desc":
+			q.Desc = true
+		default:
+			return store.BookQuery{}, errors.New("order must be asc or desc")
+		}
+	}
+
+	page, limit := params.Get("page"), params.Get("limit")
+	if page == "" && limit == "" {
+		return q, nil
+	}
+	q.Page, q.Limit = 1, defaultPageLimit
+	if page != "" {
+		if q.Page, err = strconv.ParseInt(page, 10, 64); err != nil || q.Page < 1 {
+			return store.BookQuery{}, errors.New("page must be a positive integer")
+		}
+	}
+	if limit != "" {
+		if q.Limit, err = strconv.ParseInt(limit, 10, 64); err != nil || q.Limit < 1 || q.Limit > maxPageLimit {
+			return store.BookQuery{}, fmt.Errorf("limit must be an integer between 1 and %d", maxPageLimit)
+		}
+	}
+	return q, nil
+}
+
+// bookMaps converts stored books into the JSON shape used by the API
+func bookMaps(books []models.BookStore) []map[string]interface{} {
+	ret := make([]map[string]interface{}, 0, len(books))
+	for _, book := range books {
+		ret = append(ret, book.ToMap())
+	}
+	return ret
+}
+
+// readGroup collapses concurrent identical reads (same request URI) into a
+// single database query whose result is shared by all waiting requests.
+var readGroup singleflight.Group
+
+// sharedRead runs load once for all concurrent callers using the same key.
+// The returned value is shared and must not be modified. load keeps the
+// deadline of ctx but is not cancelled with it, since other callers may
+// still wait for its result; a cancelled caller stops waiting.
+func sharedRead[T any](ctx context.Context, key string, load func(ctx context.Context) (T, error)) (T, error) {
+	ch := readGroup.DoChan(key, func() (interface{}, error) {
+		shared := context.WithoutCancel(ctx)
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			shared, cancel = context.WithDeadline(shared, deadline)
+			defer cancel()
+		}
+		return load(shared)
+	})
+	var zero T
+	select {
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return zero, res.Err
+		}
+		return res.Val.(T), nil
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// countingStore counts the listings that reach the database and holds each
+// of them until release is closed
+type countingStore struct {
+	store.Repository
+	lists   atomic.Int32
+	release chan struct{}
+}
+
+func (s *countingStore) ListBooks(ctx context.Context, q store.BookQuery) ([]models.BookStore, int64, error) {
+	s.lists.Add(1)
+	<-s.release
+	return s.Repository.ListBooks(ctx, q)
+}
+
+func TestConcurrentListsShareOneQuery(t *testing.T) {
+	const requests = 20
+	st := &countingStore{Repository: newMemory(t, frankenstein, usher), release: make(chan struct{})}
+	e := newTestServer(st, Config{})
+	var arrived sync.WaitGroup
+	arrived.Add(requests)
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			arrived.Done()
+			return next(c)
+		}
+	})
+
+	var done sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, requests)
+	for i := range recs {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			recs[i] = serve(e, http.MethodGet, "/api/v1/books?author=Mary+Shelley", "")
+		}()
+	}
+	// The first listing is held until every request is waiting for it.
+	arrived.Wait()
+	time.Sleep(50 * time.Millisecond)
+	close(st.release)
+	done.Wait()
+
+	if n := st.lists.Load(); n != 1 {
+		t.Errorf("%d requests listed the books %d times, want once", requests, n)
+	}
+	for _, rec := range recs {
+		wantStatus(t, rec, http.StatusOK)
+		var books []map[string]interface{}
+		decode(t, rec, &books)
+		if len(books) != 1 || books[0]["id"] != frankenstein.ID {
+			t.Errorf("books = %v, want Frankenstein", books)
+		}
+	}
+}
+
+func TestParseQueryFilters(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    []store.Condition
+		wantErr string
+	}{
+		{query: "title_eq=Frankenstein", want: []store.Condition{{Field: "title", Op: "eq", Value: "Frankenstein"}}},
+		{query: "author_contains=shell", want: []store.Condition{{Field: "author", Op: "contains", Value: "shell"}}},
+		{query: "year_gte=1800", want: []store.Condition{{Field: "year", Op: "gte", Value: "1800"}}},
+		{query: "pages_lte=300", want: []store.Condition{{Field: "pages", Op: "lte", Value: "300"}}},
+		{query: "year_gte=1800&year_lte=1899", want: []store.Condition{
+			{Field: "year", Op: "gte", Value: "1800"},
+			{Field: "year", Op: "lte", Value: "1899"},
+		}},
+		// Parameters without an operator are not filters.
+		{query: "author=Mary+Shelley&page=2", want: nil},
+		{query: "isbn_eq=123", wantErr: `unknown filter field "isbn"`},
+		{query: "title_like=Frank", wantErr: `unknown filter operator "like"`},
+		{query: "title_gte=F", wantErr: `operator "gte" is only supported on pages and year`},
+		{query: "year_lte=soon", wantErr: "year_lte must be an integer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			params, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseQueryFilters(params)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// Parameters are read from a map, in no particular order.
+			slices.SortFunc(got, func(a, b store.Condition) int { return strings.Compare(a.Op, b.Op) })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("conditions = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmptyListingIsEmptyArray(t *testing.T) {
+	e := newTestServer(newMemory(t, frankenstein, usher), Config{})
+	for _, target := range []string{"/api/v1/books?title_eq=Dracula", "/api/v1/books?author=Bram+Stoker", "/api/v1/books?year_gte=1900"} {
+		rec := serve(e, http.MethodGet, target, "")
+		wantStatus(t, rec, http.StatusOK)
+		if body := strings.TrimSpace(rec.Body.String()); body != "[]" {
+			t.Errorf("GET %s = %s, want []", target, body)
+		}
+	}
+	if books := bookMaps(nil); books == nil {
+		t.Error("bookMaps(nil) = nil, want an empty slice")
+	}
+}
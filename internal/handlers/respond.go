@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// apiVersion is reported in the meta block of enveloped responses.
+const apiVersion = "1"
+
+// respond writes data as JSON; errors are answered with problem.Respond. Clients that send "X-Envelope: true" get
+// successful payloads wrapped as {"data": ..., "meta": {"timestamp": ..., "api_version": ...}};
+// everyone else gets the bare payload as before.
+func respond(c echo.Context, status int, data interface{}) error {
+	if status < http.StatusBadRequest && c.Request().Header.Get("X-Envelope") == "true" {
+		return c.JSON(status, map[string]interface{}{
+			"data": data,
+			"meta": map[string]string{
+				"timestamp":   time.Now().UTC().Format(time.RFC3339),
+				"api_version": apiVersion,
+			},
+		})
+	}
+	return c.JSON(status, data)
+}
+
+// validationFailed answers with 422 and the per-field errors. It is used for
+// bodies that are well-formed but semantically invalid; unparsable bodies get 400.
+func validationFailed(c echo.Context, errs map[string]string) error {
+	p := problem.New(c, http.StatusUnprocessableEntity, "validation failed")
+	p.Fields = errs
+	return p.Write(c)
+}
+
+// bindFailed answers a body that c.Bind could not decode with 400, or with
+// the status the binder chose, and the binder's description of the problem,
+// like the unknown or mistyped field.
+func bindFailed(c echo.Context, err error) error {
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		if msg, ok := he.Message.(string); ok {
+			return problem.Respond(c, he.Code, msg)
+		}
+	}
+	return problem.Respond(c, http.StatusBadRequest, "invalid request body")
+}
+
+// logError logs that the operation op failed while handling c
+func logError(c echo.Context, op string, err error) {
+	slog.ErrorContext(c.Request().Context(), "request failed",
+		"method", c.Request().Method, "route", c.Path(), "op", op, "error", err)
+}
+
+// storeFailed translates the error of the store operation op into a problem.
+// Errors the client can act on get their own status; anything else is logged
+// and reported as 500 without the internals of the database.
+func storeFailed(c echo.Context, op string, err error) error {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return problem.Respond(c, http.StatusNotFound, "not found")
+	case errors.Is(err, store.ErrDuplicate):
+		return problem.Respond(c, http.StatusConflict, "already exists")
+	case errors.Is(err, store.ErrConflict):
+		return problem.Respond(c, http.StatusPreconditionFailed, "changed since it was read")
+	case errors.Is(err, store.ErrInvalid):
+		return problem.Respond(c, http.StatusUnprocessableEntity, "rejected by the database schema")
+	case errors.Is(err, store.ErrTransactionsUnsupported), errors.Is(err, store.ErrWatchUnsupported):
+		return problem.Respond(c, http.StatusNotImplemented, err.Error())
+	}
+	logError(c, op, err)
+	return problem.Respond(c, http.StatusInternalServerError, "database error")
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// bodyRoutes are the routes that take a book in the body
+var bodyRoutes = []struct{ method, target string }{
+	{http.MethodPost, "/api/v1/books"},
+	{http.MethodPut, "/api/v1/books/1"},
+	{http.MethodPatch, "/api/v1/books/1"},
+}
+
+func TestMalformedBodyIsBadRequest(t *testing.T) {
+	e := newTestServer(newMemory(t, frankenstein), Config{})
+	for _, r := range bodyRoutes {
+		for _, body := range []string{`{"title": "Dracula"`, `{"title": 42}`, `{"auther": "Bram Stoker"}`} {
+			rec := serve(e, r.method, r.target, body)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("%s %s %s: status = %d, want 400", r.method, r.target, body, rec.Code)
+			}
+		}
+	}
+}
+
+func TestInvalidFieldsAreUnprocessable(t *testing.T) {
+	e := newTestServer(newMemory(t, frankenstein), Config{})
+	for _, r := range bodyRoutes {
+		// PATCH also refuses to change the ID; pages and year are wrong everywhere.
+		rec := serve(e, r.method, r.target, `{"id": "1", "title": "Frankenstein", "author": "Mary Shelley", "pages": "-3", "year": "soon", "revision": 1}`)
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s %s: status = %d, want 422; body %s", r.method, r.target, rec.Code, rec.Body.String())
+			continue
+		}
+		var p struct {
+			Fields map[string]string `json:"fields"`
+		}
+		decode(t, rec, &p)
+		if p.Fields["pages"] == "" || p.Fields["year"] == "" {
+			t.Errorf("%s %s: fields = %v, want pages and year", r.method, r.target, p.Fields)
+		}
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	e := newTestServer(newMemory(t, frankenstein), Config{})
+
+	rec := serve(e, http.MethodGet, "/api/v1/books/1", "")
+	wantStatus(t, rec, http.StatusOK)
+	var plain map[string]interface{}
+	decode(t, rec, &plain)
+	if plain["id"] != "1" || plain["title"] != "Frankenstein" || plain["data"] != nil {
+		t.Errorf("plain book = %v, want the bare book", plain)
+	}
+
+	rec = serve(e, http.MethodGet, "/api/v1/books/1", "", "X-Envelope", "true")
+	wantStatus(t, rec, http.StatusOK)
+	var wrapped struct {
+		Data map[string]interface{} `json:"data"`
+		Meta struct {
+			Timestamp  string `json:"timestamp"`
+			APIVersion string `json:"api_version"`
+		} `json:"meta"`
+	}
+	decode(t, rec, &wrapped)
+	if wrapped.Data["id"] != "1" || wrapped.Data["title"] != "Frankenstein" {
+		t.Errorf("data = %v, want the book", wrapped.Data)
+	}
+	if _, err := time.Parse(time.RFC3339, wrapped.Meta.Timestamp); err != nil {
+		t.Errorf("meta.timestamp %q: %v", wrapped.Meta.Timestamp, err)
+	}
+	if wrapped.Meta.APIVersion != apiVersion {
+		t.Errorf("meta.api_version = %q, want %q", wrapped.Meta.APIVersion, apiVersion)
+	}
+
+	// Errors are problem details either way.
+	rec = serve(e, http.MethodGet, "/api/v1/books/404", "", "X-Envelope", "true")
+	wantStatus(t, rec, http.StatusNotFound)
+	var p map[string]interface{}
+	decode(t, rec, &p)
+	if p["data"] != nil || p["status"] == nil {
+		t.Errorf("problem = %v, want it unwrapped", p)
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// authorStats is an entry of GET /api/v1/stats/authors
+type authorStats struct {
+	Author string `json:"author"`
+	Books  int64  `json:"books"`
+}
+
+// statsAuthors serves GET /api/v1/stats/authors: how many books each author
+// has in the catalog, the most prolific first. The database counts them, so
+// the books themselves are not read.
+func (a *API) statsAuthors(c echo.Context) error {
+	counts, err := a.store.BooksPerAuthor(c.Request().Context())
+	if err != nil {
+		return storeFailed(c, "BooksPerAuthor", err)
+	}
+	ret := make([]authorStats, 0, len(counts))
+	for _, ac := range counts {
+		ret = append(ret, authorStats{Author: ac.Author, Books: ac.Books})
+	}
+	return respond(c, http.StatusOK, ret)
+}
+
+// decadeStats is an entry of GET /api/v1/stats/decades
+type decadeStats struct {
+	Decade int64 `json:"decade"`
+	Books  int64 `json:"books"`
+}
+
+// statsDecades serves GET /api/v1/stats/decades: how many books were
+// published in each decade, the earliest first, for histograms. The
+// database parses the years and counts the books.
+func (a *API) statsDecades(c echo.Context) error {
+	counts, err := a.store.BooksPerDecade(c.Request().Context())
+	if err != nil {
+		return storeFailed(c, "BooksPerDecade", err)
+	}
+	ret := make([]decadeStats, 0, len(counts))
+	for _, dc := range counts {
+		ret = append(ret, decadeStats{Decade: dc.Decade, Books: dc.Books})
+	}
+	return respond(c, http.StatusOK, ret)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// streamHeartbeat is how often an idle event stream sends a comment so that
+// proxies do not close the connection.
+const streamHeartbeat = 15 * time.Second
+
+// eventPayload is the JSON data of a book event. Book is omitted for deletes
+// whose book the backend no longer knows.
+func eventPayload(ev store.BookEvent) map[string]interface{} {
+	payload := map[string]interface{}{"type": ev.Op}
+	if ev.Book.ID != "" {
+		payload["id"] = ev.Book.ID
+		payload["book"] = ev.Book.ToMap()
+	}
+	return payload
+}
+
+// stream serves GET /api/v1/books/stream. Every insert, update and delete
+// is pushed as a Server-Sent Event named after the operation, until the
+// client disconnects.
+func (a *API) stream(c echo.Context) error {
+	ctx := c.Request().Context()
+	events, err := a.store.WatchBooks(ctx)
+	if errors.Is(err, store.ErrWatchUnsupported) {
+		return problem.Respond(c, http.StatusNotImplemented, "live updates require MongoDB to run as a replica set")
+	}
+	if err != nil {
+		return storeFailed(c, "WatchBooks", err)
+	}
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set(echo.HeaderConnection, "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // keep nginx from buffering events
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-a.closing:
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			data, err := json.Marshal(eventPayload(ev))
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Op, data); err != nil {
+				return nil
+			}
+		}
+		w.Flush()
+	}
+}
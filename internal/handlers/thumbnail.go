@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif" // decoders of the formats in coverTypes
+	"image/jpeg"
+	_ "image/png"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// maxCoverPixels bounds the width times height of covers, since a small
+// file may decode into an image too large to hold in memory
+const maxCoverPixels = 40_000_000
+
+// thumbnailQuality is the JPEG quality of the thumbnails
+const thumbnailQuality = 85
+
+// errCoverDimensions is returned for covers with more than maxCoverPixels
+var errCoverDimensions = errors.New("the image has too many pixels")
+
+// coverThumbnails decodes the cover in data and scales it down to each of
+// models.CoverSizes, encoded as JPEG. Only the first frame of an animated
+// GIF is used.
+func coverThumbnails(data []byte) (map[string][]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxCoverPixels {
+		return nil, errCoverDimensions
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	thumbnails := map[string][]byte{}
+	for size, side := range models.CoverSizes {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, scaleDown(img, side), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+			return nil, err
+		}
+		thumbnails[size] = buf.Bytes()
+	}
+	return thumbnails, nil
+}
+
+// scaleDown returns img scaled so that its longer side is at most side
+// pixels, keeping its aspect ratio; smaller images keep their size. It is
+// drawn over white, since JPEG has no transparency.
+func scaleDown(img image.Image, side int) image.Image {
+	src := img.Bounds()
+	w, h := src.Dx(), src.Dy()
+	if w > side || h > side {
+		if w >= h {
+			w, h = side, max(1, h*side/w)
+		} else {
+			w, h = max(1, w*side/h), side
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Over, nil)
+	return dst
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// listTrash serves GET /api/v1/trash with the filters, order and pagination
+// of GET /api/v1/books. Deleted books stay in the trash, keeping their ID,
+// until they are restored or purged; each carries the time it was deleted.
+func (a *API) listTrash(c echo.Context) error {
+	q, err := parseBookQuery(c.QueryParams())
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, err.Error())
+	}
+	q.Deleted = true
+	books, total, err := a.store.ListBooks(c.Request().Context(), q)
+	if err != nil {
+		return storeFailed(c, "ListBooks", err)
+	}
+	if q.Page == 0 {
+		return respond(c, http.StatusOK, bookMaps(books))
+	}
+	return respond(c, http.StatusOK, bookPage{
+		Books:      bookMaps(books),
+		Page:       q.Page,
+		Limit:      q.Limit,
+		Total:      total,
+		TotalPages: (total + q.Limit - 1) / q.Limit,
+	})
+}
+
+// restore serves POST /api/v1/books/:id/restore. A restored book counts
+// towards the MAX_BOOKS quota again.
+func (a *API) restore(c echo.Context) error {
+	ctx := c.Request().Context()
+	remaining, err := a.remainingQuota(ctx)
+	if err != nil {
+		return storeFailed(c, "remainingQuota", err)
+	}
+	if remaining == 0 {
+		return problem.Respond(c, http.StatusForbidden, errQuotaExceeded.Error())
+	}
+	id := c.Param("id")
+	book, err := a.store.RestoreBook(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return problem.Respond(c, http.StatusNotFound, "book not in the trash")
+	}
+	if err != nil {
+		return storeFailed(c, "RestoreBook", err)
+	}
+	return respond(c, http.StatusOK, map[string]interface{}{"message": "book restored", "id": id, "revision": book.Revision})
+}
+
+// purge serves DELETE /api/v1/trash/:id, which removes a book in the trash
+// for good
+func (a *API) purge(c echo.Context) error {
+	id := c.Param("id")
+	purged, err := a.store.PurgeBooks(c.Request().Context(), store.BookQuery{IDs: []string{id}})
+	if err != nil {
+		return storeFailed(c, "PurgeBooks", err)
+	}
+	if len(purged) == 0 {
+		return problem.Respond(c, http.StatusNotFound, "book not in the trash")
+	}
+	return respond(c, http.StatusOK, map[string]string{"message": "book purged", "id": id})
+}
+
+// emptyTrash serves DELETE /api/v1/trash. Without filters in the query
+// string, see bulkQuery, every book in the trash is purged.
+func (a *API) emptyTrash(c echo.Context) error {
+	q, err := bulkQuery(nil, c.QueryParams())
+	if err != nil {
+		return problem.Respond(c, http.StatusBadRequest, err.Error())
+	}
+	purged, err := a.store.PurgeBooks(c.Request().Context(), q)
+	if err != nil {
+		return storeFailed(c, "PurgeBooks", err)
+	}
+	ids := make([]string, len(purged))
+	for i, book := range purged {
+		ids[i] = book.ID
+	}
+	return respond(c, http.StatusOK, map[string]interface{}{"message": "books purged", "purged": len(ids), "ids": ids})
+}
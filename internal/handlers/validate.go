@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+)
+
+// bookRequest is the body accepted for a single book, either as JSON or as
+// form values posted by the /create page
+type bookRequest struct {
+	ID      string `json:"id" form:"id"`
+	Title   string `json:"title" form:"title"`
+	Author  string `json:"author" form:"author"`
+	Pages   string `json:"pages" form:"pages"`
+	Edition string `json:"edition" form:"edition"`
+	Year    string `json:"year" form:"year"`
+	// Revision is accepted so that books read from the API can be posted
+	// back as they are; new books always start at revision 1.
+	Revision int64 `json:"revision" form:"-"`
+	// CreatedAt is accepted for the same reason and ignored; the store
+	// dates new books itself.
+	CreatedAt string `json:"created_at" form:"-"`
+	// Cover is accepted and ignored too; covers are uploaded to
+	// /books/:id/cover.
+	Cover json.RawMessage `json:"cover" form:"-"`
+}
+
+// toBook converts the request into the stored model
+func (r bookRequest) toBook() models.BookStore {
+	return models.BookStore{
+		ID:          r.ID,
+		BookName:    r.Title,
+		BookAuthor:  r.Author,
+		BookPages:   r.Pages,
+		BookEdition: r.Edition,
+		BookYear:    r.Year,
+	}
+}
+
+// fields returns the non-empty fields of the request other than the ID,
+// keyed by JSON field name, as set by an update
+func (r bookRequest) fields() map[string]string {
+	fields := map[string]string{}
+	for name, value := range map[string]string{
+		"title":   r.Title,
+		"author":  r.Author,
+		"pages":   r.Pages,
+		"edition": r.Edition,
+		"year":    r.Year,
+	} {
+		if value != "" {
+			fields[name] = value
+		}
+	}
+	return fields
+}
+
+// validate returns the per-field problems of a new book, keyed by JSON field
+// name; the map is empty when the book can be stored.
+func (r bookRequest) validate() map[string]string {
+	return r.toBook().Validate()
+}
+
+// validateImport reports why an imported record cannot be stored, or "" if it can
+func validateImport(r bookRequest) string {
+	return models.DescribeProblems(r.validate())
+}
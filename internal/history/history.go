@@ -0,0 +1,109 @@
+// Package history keeps the previous versions of books. Wrap decorates a
+// store.Repository so that every update first saves the version it
+// replaces, which lets bad edits be rolled back whichever API made them.
+package history
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// pinAttempts is how often an update without a revision is tried against
+// a fresh read of the book when other writers change it in between
+const pinAttempts = 3
+
+// repository keeps the versions replaced through the embedded Repository
+type repository struct {
+	store.Repository
+}
+
+// Wrap returns r keeping the previous versions of updated books and
+// dropping them when a book is purged
+func Wrap(r store.Repository) store.Repository {
+	return &repository{r}
+}
+
+// save stores book as the version replaced by an update. A failure is
+// logged but does not undo the update.
+func (r *repository) save(ctx context.Context, book models.BookStore, replacedAt time.Time) {
+	v := models.NewBookVersion(book, replacedAt)
+	err := r.Repository.InsertBookVersion(ctx, &v)
+	if err != nil && !errors.Is(err, store.ErrDuplicate) {
+		slog.ErrorContext(ctx, "cannot save book version", "book", book.ID, "version", book.Revision, "error", err)
+	}
+}
+
+// UpdateBook updates a book and saves the version it replaces. The book is
+// read first; updates without a revision are made at the revision read, so
+// the saved version is exactly the one replaced, and retried if it changes
+// in between.
+func (r *repository) UpdateBook(ctx context.Context, id string, revision int64, fields map[string]string) (models.BookStore, error) {
+	for attempt := 1; ; attempt++ {
+		before, err := r.Repository.GetBook(ctx, id)
+		if err != nil {
+			return before, err
+		}
+		pinned := revision
+		if pinned == 0 {
+			pinned = before.Revision
+		}
+		book, err := r.Repository.UpdateBook(ctx, id, pinned, fields)
+		if errors.Is(err, store.ErrConflict) && revision == 0 && attempt < pinAttempts {
+			continue
+		}
+		if err != nil {
+			return book, err
+		}
+		before.ID = book.ID // follow a changed ID
+		r.save(ctx, before, time.Now().UTC())
+		return book, nil
+	}
+}
+
+// UpdateBooks updates the books matching q and saves the versions replaced
+// in the changed ones
+func (r *repository) UpdateBooks(ctx context.Context, q store.BookQuery, fields map[string]string) (int64, []models.BookStore, error) {
+	q.Page = 0
+	matching, _, err := r.Repository.ListBooks(ctx, q)
+	if err != nil {
+		return 0, nil, err
+	}
+	matched, books, err := r.Repository.UpdateBooks(ctx, q, fields)
+	if err != nil {
+		return matched, books, err
+	}
+	byOID := make(map[primitive.ObjectID]models.BookStore, len(matching))
+	for _, book := range matching {
+		byOID[book.MongoID] = book
+	}
+	now := time.Now().UTC()
+	for _, book := range books {
+		if before, ok := byOID[book.MongoID]; ok {
+			before.ID = book.ID
+			r.save(ctx, before, now)
+		}
+	}
+	return matched, books, nil
+}
+
+// PurgeBooks removes books in the trash for good, with their versions
+func (r *repository) PurgeBooks(ctx context.Context, q store.BookQuery) ([]models.BookStore, error) {
+	books, err := r.Repository.PurgeBooks(ctx, q)
+	if err != nil || len(books) == 0 {
+		return books, err
+	}
+	ids := make([]string, len(books))
+	for i, book := range books {
+		ids[i] = book.ID
+	}
+	if err := r.Repository.DeleteBookVersions(ctx, ids); err != nil {
+		slog.ErrorContext(ctx, "cannot delete versions of purged books", "books", ids, "error", err)
+	}
+	return books, nil
+}
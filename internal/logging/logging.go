@@ -0,0 +1,42 @@
+// Package logging sets up the structured logger shared by the services.
+// Code logs through log/slog; lines written with the log package, e.g. by
+// libraries, end up in the same output.
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Setup makes the default slog logger write the lines of service to stderr,
+// as text or as JSON objects depending on format (default text), and drop
+// lines below level (debug, info, warn or error; default info). Lines
+// logged with the context of a request include its ID.
+func Setup(service, level, format string) error {
+	var minLevel slog.Level
+	if level != "" {
+		if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("invalid log level %q: use debug, info, warn or error", level)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: minLevel}
+	var h slog.Handler
+	switch format = strings.ToLower(format); format {
+	case "", "text":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %q: use text or json", format)
+	}
+	slog.SetDefault(slog.New(requestIDHandler{h}).With("service", service))
+	return nil
+}
+
+// Fatal logs msg with args as an error and exits
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,66 @@
+package lookup
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// GoogleBooksURL is the address of the Google Books API
+const GoogleBooksURL = "https://www.googleapis.com/books/v1"
+
+// GoogleBooks looks up books in the volumes of the Google Books API
+type GoogleBooks struct {
+	client  *Client
+	baseURL string
+	apiKey  string
+}
+
+// NewGoogleBooks returns a source querying the Google Books API at baseURL
+// through client. Without an API key, requests share the quota of the
+// server's IP address.
+func NewGoogleBooks(client *Client, baseURL, apiKey string) *GoogleBooks {
+	return &GoogleBooks{client: client, baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey}
+}
+
+// googleVolumes is the part of a volume search result that is used
+type googleVolumes struct {
+	Items []struct {
+		VolumeInfo struct {
+			Title         string   `json:"title"`
+			Authors       []string `json:"authors"`
+			PublishedDate string   `json:"publishedDate"`
+			PageCount     int      `json:"pageCount"`
+		} `json:"volumeInfo"`
+	} `json:"items"`
+}
+
+// LookupISBN returns the first volume Google Books finds for isbn
+func (g *GoogleBooks) LookupISBN(ctx context.Context, isbn string) (Book, error) {
+	q := url.Values{"q": {"isbn:" + isbn}}
+	header := http.Header{}
+	if g.apiKey != "" {
+		// Unlike the key parameter, the header is not part of the URLs
+		// that end up in error messages.
+		header.Set("X-Goog-Api-Key", g.apiKey)
+	}
+	var res googleVolumes
+	if err := g.client.getJSON(ctx, g.baseURL+"/volumes?"+q.Encode(), header, &res); err != nil {
+		return Book{}, err
+	}
+	if len(res.Items) == 0 {
+		return Book{}, ErrNotFound
+	}
+	info := res.Items[0].VolumeInfo
+	book := Book{
+		Title:  info.Title,
+		Author: strings.Join(info.Authors, ", "),
+		Year:   year(info.PublishedDate),
+	}
+	if info.PageCount > 0 {
+		book.Pages = strconv.Itoa(info.PageCount)
+	}
+	return book, nil
+}
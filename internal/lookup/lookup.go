@@ -0,0 +1,117 @@
+// Package lookup fetches the metadata of books by ISBN from public catalogs,
+// to complete the books of the store.
+package lookup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrNotFound is returned for ISBNs the catalog does not know
+var ErrNotFound = errors.New("ISBN not found")
+
+// requestTimeout bounds every request to a catalog
+const requestTimeout = 10 * time.Second
+
+// userAgent identifies the lookups, as the public catalogs ask clients to
+const userAgent = "cc-bookstore (+https://github.com/CAPS-Cloud/exercises)"
+
+// Book is what a catalog knows about an ISBN; fields it does not know are
+// empty.
+type Book struct {
+	Title  string
+	Author string
+	Pages  string
+	Year   string
+}
+
+// Source looks up books by ISBN
+type Source interface {
+	// LookupISBN returns the book with isbn, given without hyphens, or
+	// ErrNotFound
+	LookupISBN(ctx context.Context, isbn string) (Book, error)
+}
+
+// Client is an HTTP client making at most a fixed number of requests per
+// second. Requests over the limit wait for their turn, as long as their
+// context allows.
+type Client struct {
+	http    *http.Client
+	limiter *rate.Limiter
+}
+
+// NewClient returns a client making at most limit requests per second
+func NewClient(limit float64) *Client {
+	return &Client{
+		http:    &http.Client{Timeout: requestTimeout},
+		limiter: rate.NewLimiter(rate.Limit(limit), 1),
+	}
+}
+
+// ClientFromEnv returns a client making LOOKUP_RATE requests per second,
+// by default 1, which the public catalogs tolerate without an API key
+func ClientFromEnv() (*Client, error) {
+	limit := 1.0
+	if v := os.Getenv("LOOKUP_RATE"); v != "" {
+		var err error
+		limit, err = strconv.ParseFloat(v, 64)
+		if err != nil || limit <= 0 || math.IsInf(limit, 0) {
+			return nil, fmt.Errorf("invalid LOOKUP_RATE %q: must be a positive number of requests per second", v)
+		}
+	}
+	return NewClient(limit), nil
+}
+
+// StatusError is a request the catalog answered with a non-2xx status
+type StatusError int
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("catalog answered %d %s", int(e), http.StatusText(int(e)))
+}
+
+// getJSON fetches url with the additional header and decodes the JSON
+// response into v. A 404 is returned as ErrNotFound.
+func (c *Client) getJSON(ctx context.Context, url string, header http.Header, v interface{}) error {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return StatusError(resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// yearPattern finds the year in a free-form date like "September 14, 2008"
+var yearPattern = regexp.MustCompile(`\b\d{4}\b`)
+
+// year returns the year of date, or "" if it has none
+func year(date string) string {
+	return yearPattern.FindString(date)
+}
@@ -0,0 +1,57 @@
+package lookup
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// OpenLibraryURL is the address of the public OpenLibrary API
+const OpenLibraryURL = "https://openlibrary.org"
+
+// OpenLibrary looks up books in the Books API of OpenLibrary
+type OpenLibrary struct {
+	client  *Client
+	baseURL string
+}
+
+// NewOpenLibrary returns a source querying the OpenLibrary API at baseURL
+// through client
+func NewOpenLibrary(client *Client, baseURL string) *OpenLibrary {
+	return &OpenLibrary{client: client, baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// openLibraryBook is the part of a record of the Books API that is used
+type openLibraryBook struct {
+	Title   string `json:"title"`
+	Authors []struct {
+		Name string `json:"name"`
+	} `json:"authors"`
+	Pages       int    `json:"number_of_pages"`
+	PublishDate string `json:"publish_date"`
+}
+
+// LookupISBN returns what OpenLibrary records for the edition with isbn
+func (o *OpenLibrary) LookupISBN(ctx context.Context, isbn string) (Book, error) {
+	key := "ISBN:" + isbn
+	q := url.Values{"bibkeys": {key}, "format": {"json"}, "jscmd": {"data"}}
+	var records map[string]openLibraryBook
+	if err := o.client.getJSON(ctx, o.baseURL+"/api/books?"+q.Encode(), nil, &records); err != nil {
+		return Book{}, err
+	}
+	rec, ok := records[key]
+	if !ok {
+		return Book{}, ErrNotFound // the API answers unknown keys with {}
+	}
+	book := Book{Title: rec.Title, Year: year(rec.PublishDate)}
+	var authors []string
+	for _, a := range rec.Authors {
+		authors = append(authors, a.Name)
+	}
+	book.Author = strings.Join(authors, ", ")
+	if rec.Pages > 0 {
+		book.Pages = strconv.Itoa(rec.Pages)
+	}
+	return book, nil
+}
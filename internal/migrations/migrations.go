@@ -0,0 +1,133 @@
+// Package migrations changes the shape of stored documents in versioned
+// steps. Every service applies the pending migrations when it connects to
+// MongoDB; the migrations collection records which versions ran, so each
+// migration is applied exactly once per database.
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// collection records the applied migrations
+const collection = "migrations"
+
+// Migration is one versioned change of the stored data. Up must leave the
+// data usable by services that do not know the migration yet, because they
+// keep running until they are redeployed. It is given the collection of the
+// books, whose name is configurable, next to the database.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database, books *mongo.Collection) error
+}
+
+// record is the document stored for an applied migration
+type record struct {
+	Version     int        `bson:"_id"`
+	Description string     `bson:"description"`
+	StartedAt   time.Time  `bson:"started_at"`
+	AppliedAt   *time.Time `bson:"applied_at,omitempty"`
+}
+
+// All are the migrations of the bookstore in the order they are applied.
+// Append new migrations with the next version; never change applied ones.
+var All = []Migration{
+	{
+		Version:     1,
+		Description: "backfill missing book fields with empty strings",
+		Up:          backfillBookFields,
+	},
+	{
+		Version:     2,
+		Description: "attach the book schema validator",
+		Up:          attachBookValidator,
+	},
+	{
+		Version:     3,
+		Description: "start the revision of existing books at 1",
+		Up:          backfillBookRevisions,
+	},
+	{
+		Version:     4,
+		Description: "date existing books by the time in their ObjectID",
+		Up:          backfillBookCreatedAt,
+	},
+}
+
+// Apply runs the migrations that are not recorded in db yet, in order, on
+// db and its collection of books. A
+// migration is claimed by recording it before it runs, so services starting
+// at the same time do not apply it twice. If it fails, the claim is removed
+// again and the migration is retried on the next start.
+func Apply(ctx context.Context, db *mongo.Database, books *mongo.Collection, migrations []Migration) error {
+	coll := db.Collection(collection)
+	for _, m := range migrations {
+		_, err := coll.InsertOne(ctx, record{Version: m.Version, Description: m.Description, StartedAt: time.Now().UTC()})
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		slog.Info("applying migration", "version", m.Version, "description", m.Description)
+		if err := m.Up(ctx, db, books); err != nil {
+			if _, delErr := coll.DeleteOne(ctx, bson.M{"_id": m.Version}); delErr != nil {
+				slog.Error("cannot release migration", "version", m.Version, "error", delErr)
+			}
+			return fmt.Errorf("migration %d: %w", m.Version, err)
+		}
+		if _, err := coll.UpdateByID(ctx, m.Version, bson.M{"$set": bson.M{"applied_at": time.Now().UTC()}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillBookFields sets the optional fields of books created without them,
+// so that filters on an empty edition, pages or year also find those books.
+func backfillBookFields(ctx context.Context, _ *mongo.Database, books *mongo.Collection) error {
+	for _, field := range []string{"BookEdition", "BookPages", "BookYear"} {
+		_, err := books.UpdateMany(ctx, bson.M{field: bson.M{"$exists": false}}, bson.M{"$set": bson.M{field: ""}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachBookValidator adds models.BookSchema to a books collection created
+// before it existed. Existing documents that break the schema stay readable
+// and updatable; only new and valid documents are checked.
+func attachBookValidator(ctx context.Context, db *mongo.Database, books *mongo.Collection) error {
+	return db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: books.Name()},
+		{Key: "validator", Value: bson.M{"$jsonSchema": models.BookSchema}},
+		{Key: "validationLevel", Value: "moderate"},
+	}).Err()
+}
+
+// backfillBookRevisions gives books created before revisions existed the
+// first revision, so that they can be updated with If-Match.
+func backfillBookRevisions(ctx context.Context, _ *mongo.Database, books *mongo.Collection) error {
+	_, err := books.UpdateMany(ctx,
+		bson.M{"Revision": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"Revision": int64(1)}})
+	return err
+}
+
+// backfillBookCreatedAt sets CreatedAt on books inserted before it existed
+// to the time their ObjectID was generated, which is when they were
+// inserted by the services.
+func backfillBookCreatedAt(ctx context.Context, _ *mongo.Database, books *mongo.Collection) error {
+	_, err := books.UpdateMany(ctx,
+		bson.M{"CreatedAt": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"CreatedAt": bson.M{"$toDate": "$_id"}}}}})
+	return err
+}
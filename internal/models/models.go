@@ -0,0 +1,229 @@
+// Package models holds the documents shared by the bookstore services.
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BookStore model
+type BookStore struct {
+	MongoID     primitive.ObjectID `bson:"_id,omitempty"`
+	ID          string             `bson:"ID"`
+	BookName    string             `bson:"BookName"`
+	BookAuthor  string             `bson:"BookAuthor"`
+	BookEdition string             `bson:"BookEdition"`
+	BookPages   string             `bson:"BookPages"`
+	BookYear    string             `bson:"BookYear"`
+	// Revision starts at 1 and is bumped by every update, so that writers
+	// can detect changes made since they read the book.
+	Revision int64 `bson:"Revision"`
+	// DeletedAt is set when the book is moved to the trash. Trashed books
+	// are left out of every listing and lookup until they are restored.
+	DeletedAt *time.Time `bson:"DeletedAt,omitempty"`
+	// CreatedAt is set by the store when the book is inserted. Books stored
+	// in a SQL database before it existed have none.
+	CreatedAt *time.Time `bson:"CreatedAt,omitempty"`
+	// Cover refers to the cover image, which the store keeps apart from
+	// the book; nil if none was uploaded.
+	Cover *Cover `bson:"Cover,omitempty"`
+}
+
+// Cover describes the cover image of a book
+type Cover struct {
+	// FileID names the stored image: the GridFS file in MongoDB, a row of
+	// book_covers in SQL. A new upload gets a new ID.
+	FileID      string    `bson:"file_id"`
+	ContentType string    `bson:"content_type"`
+	Size        int64     `bson:"size"`
+	UploadedAt  time.Time `bson:"uploaded_at"`
+}
+
+// CoverSizes are the thumbnails made of every uploaded cover, by the name
+// clients ask for, with the length in pixels their longer side is scaled
+// down to
+var CoverSizes = map[string]int{"thumb": 160, "medium": 480}
+
+// ThumbnailType is the format of the thumbnails of covers
+const ThumbnailType = "image/jpeg"
+
+// ThumbnailID returns the file ID of the thumbnail of the cover in size,
+// which is stored next to the image under that ID
+func (c Cover) ThumbnailID(size string) string {
+	return c.FileID + "-" + size
+}
+
+// ToMap converts a stored book into the JSON shape used by the API
+func (b BookStore) ToMap() map[string]interface{} {
+	m := map[string]interface{}{
+		"id":       b.ID,
+		"title":    b.BookName,
+		"author":   b.BookAuthor,
+		"pages":    b.BookPages,
+		"edition":  b.BookEdition,
+		"year":     b.BookYear,
+		"revision": b.Revision,
+	}
+	if b.CreatedAt != nil {
+		m["created_at"] = b.CreatedAt.UTC().Format(time.RFC3339)
+	}
+	if b.DeletedAt != nil {
+		m["deleted_at"] = b.DeletedAt.UTC().Format(time.RFC3339)
+	}
+	if b.Cover != nil {
+		m["cover"] = map[string]interface{}{
+			"content_type": b.Cover.ContentType,
+			"size":         b.Cover.Size,
+			"uploaded_at":  b.Cover.UploadedAt.UTC().Format(time.RFC3339),
+		}
+	}
+	return m
+}
+
+// BookSchema is the $jsonSchema validator of the books collection. It
+// rejects documents without ID, title or author and pages or years that are
+// not made of digits, even when they are written by other tools than the
+// bookstore services.
+var BookSchema = bson.M{
+	"bsonType": "object",
+	"required": bson.A{"ID", "BookName", "BookAuthor"},
+	"properties": bson.M{
+		"ID":          bson.M{"bsonType": "string", "minLength": 1},
+		"BookName":    bson.M{"bsonType": "string", "minLength": 1},
+		"BookAuthor":  bson.M{"bsonType": "string", "minLength": 1},
+		"BookEdition": bson.M{"bsonType": "string"},
+		"BookPages":   bson.M{"bsonType": "string", "pattern": "^[0-9]*$"},
+		"BookYear":    bson.M{"bsonType": "string", "pattern": "^[0-9]*$"},
+	},
+}
+
+// BookFields are the API names of the fields of a book
+var BookFields = []string{"id", "title", "author", "pages", "edition", "year"}
+
+// NumericFields are stored as strings but hold integers
+var NumericFields = map[string]bool{"pages": true, "year": true}
+
+// Roles of users and API keys. Each role includes the rights of the roles
+// before it: viewers may only read, editors may also create and update books,
+// and admins may additionally delete books and manage users and keys.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+var roleRank = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleAdmin: 3}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	return roleRank[role] > 0
+}
+
+// HasRole reports whether role grants the rights of need
+func HasRole(role, need string) bool {
+	return ValidRole(role) && roleRank[role] >= roleRank[need]
+}
+
+// APIKey is a key minted through POST /api/v1/admin/keys so that external
+// scripts can write without admin credentials. Only the SHA-256 hash of the
+// key is stored.
+type APIKey struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name      string             `bson:"name" json:"name"`
+	Role      string             `bson:"role" json:"role"`
+	Prefix    string             `bson:"prefix" json:"prefix"`
+	Hash      string             `bson:"hash" json:"-"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	RevokedAt *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
+
+// User is an account that can log in through POST /api/v1/login. Passwords
+// are stored as bcrypt hashes.
+type User struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Username     string             `bson:"username" json:"username"`
+	PasswordHash string             `bson:"password_hash" json:"-"`
+	Role         string             `bson:"role" json:"role"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// Webhook is a URL registered through POST /api/v1/admin/webhooks that gets
+// a JSON POST for every created, updated or deleted book. Deliveries are
+// signed with an HMAC-SHA256 of the body keyed with Secret.
+type Webhook struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	URL       string             `bson:"url" json:"url"`
+	Secret    string             `bson:"secret" json:"-"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// IdempotencyRecord remembers the response to a POST sent with an
+// Idempotency-Key header, so that a retry gets the same response instead of
+// repeating the write
+type IdempotencyRecord struct {
+	Key         string    `bson:"_id"`         // the header, scoped to the route
+	Fingerprint string    `bson:"fingerprint"` // SHA-256 of the request body
+	Status      int       `bson:"status"`      // 0 while the first request runs
+	Body        []byte    `bson:"body"`
+	CreatedAt   time.Time `bson:"created_at"`
+}
+
+// AuditEntry records a change of a book: who made it, when, through which
+// route and the fields that changed, keyed by API field name, with their
+// values before and after. Created books have no Before, deleted ones no
+// After.
+type AuditEntry struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	BookID    string             `bson:"book_id" json:"book_id"`
+	Action    string             `bson:"action" json:"action"` // create, update, delete, restore or purge
+	Actor     string             `bson:"actor" json:"actor"`
+	Route     string             `bson:"route" json:"route"`
+	ClientIP  string             `bson:"client_ip,omitempty" json:"client_ip,omitempty"`
+	RequestID string             `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	Time      time.Time          `bson:"time" json:"time"`
+	Before    map[string]string  `bson:"before,omitempty" json:"before,omitempty"`
+	After     map[string]string  `bson:"after,omitempty" json:"after,omitempty"`
+}
+
+// BookVersion is a previous version of a book, kept when the book is
+// updated so that the update can be rolled back. Version is the revision
+// the book had.
+type BookVersion struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	BookID     string             `bson:"book_id" json:"-"`
+	Version    int64              `bson:"version" json:"version"`
+	Title      string             `bson:"title" json:"title"`
+	Author     string             `bson:"author" json:"author"`
+	Pages      string             `bson:"pages" json:"pages,omitempty"`
+	Edition    string             `bson:"edition" json:"edition,omitempty"`
+	Year       string             `bson:"year" json:"year,omitempty"`
+	ReplacedAt time.Time          `bson:"replaced_at" json:"replaced_at"`
+}
+
+// NewBookVersion returns the version b is at, replaced at t
+func NewBookVersion(b BookStore, t time.Time) BookVersion {
+	return BookVersion{
+		BookID:     b.ID,
+		Version:    b.Revision,
+		Title:      b.BookName,
+		Author:     b.BookAuthor,
+		Pages:      b.BookPages,
+		Edition:    b.BookEdition,
+		Year:       b.BookYear,
+		ReplacedAt: t,
+	}
+}
+
+// Fields returns the fields of the version keyed by API field name, as
+// taken by UpdateBook
+func (v BookVersion) Fields() map[string]string {
+	return map[string]string{
+		"title":   v.Title,
+		"author":  v.Author,
+		"pages":   v.Pages,
+		"edition": v.Edition,
+		"year":    v.Year,
+	}
+}
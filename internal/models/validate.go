@@ -0,0 +1,140 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MaxTextLength bounds the titles, authors and editions of books
+	MaxTextLength = 500
+	// MaxPages is the most pages a book is believed to have
+	MaxPages = 100000
+)
+
+// isbnLike matches editions written as an ISBN (digits, hyphens and a final X)
+var isbnLike = regexp.MustCompile(`^[0-9][0-9-]*[0-9Xx]$`)
+
+// Validate returns the per-field problems of a new book, keyed by API field
+// name; the map is empty when the book can be stored.
+func (b BookStore) Validate() map[string]string {
+	errs := ValidateFields(map[string]string{
+		"title":   b.BookName,
+		"author":  b.BookAuthor,
+		"pages":   b.BookPages,
+		"edition": b.BookEdition,
+		"year":    b.BookYear,
+	})
+	if strings.TrimSpace(b.ID) == "" {
+		errs["id"] = "is required"
+	} else if utf8.RuneCountInString(b.ID) > MaxTextLength || hasControl(b.ID) {
+		errs["id"] = fmt.Sprintf("must be at most %d printable characters", MaxTextLength)
+	}
+	if b.BookName == "" {
+		errs["title"] = "is required"
+	}
+	if b.BookAuthor == "" {
+		errs["author"] = "is required"
+	}
+	return errs
+}
+
+// ValidateFields returns the problems of the book fields an update sets,
+// keyed by API field name. Empty pages, editions and years are not checked;
+// titles and authors must not be blank.
+func ValidateFields(fields map[string]string) map[string]string {
+	errs := map[string]string{}
+	for _, name := range []string{"title", "author"} {
+		value, ok := fields[name]
+		if !ok || value == "" {
+			continue
+		}
+		if strings.TrimSpace(value) == "" {
+			errs[name] = "must not be blank"
+		} else if utf8.RuneCountInString(value) > MaxTextLength || hasControl(value) {
+			errs[name] = fmt.Sprintf("must be at most %d printable characters", MaxTextLength)
+		}
+	}
+	if pages := fields["pages"]; pages != "" {
+		if n, err := strconv.Atoi(pages); err != nil || n < 1 || n > MaxPages {
+			errs["pages"] = fmt.Sprintf("must be a positive number up to %d", MaxPages)
+		}
+	}
+	if edition := fields["edition"]; edition != "" {
+		switch {
+		case isbnLike.MatchString(edition) && !ValidISBN(edition):
+			errs["edition"] = "not a valid ISBN-10 or ISBN-13"
+		case utf8.RuneCountInString(edition) > MaxTextLength || hasControl(edition):
+			errs["edition"] = fmt.Sprintf("must be at most %d printable characters", MaxTextLength)
+		}
+	}
+	if year := fields["year"]; year != "" {
+		maxYear := time.Now().Year() + 1
+		if y, err := strconv.Atoi(year); err != nil || y < 1 || y > maxYear {
+			errs["year"] = fmt.Sprintf("must be a year between 1 and %d", maxYear)
+		}
+	}
+	return errs
+}
+
+// DescribeProblems joins the problems returned by Validate into one
+// message like "pages must be a positive number; title is required"
+func DescribeProblems(errs map[string]string) string {
+	fields := make([]string, 0, len(errs))
+	for field := range errs {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	msgs := make([]string, 0, len(fields))
+	for _, field := range fields {
+		msgs = append(msgs, field+" "+errs[field])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ValidISBN checks the checksum of an ISBN-10 or ISBN-13 (hyphens allowed)
+func ValidISBN(s string) bool {
+	digits := strings.ToUpper(strings.ReplaceAll(s, "-", ""))
+	switch len(digits) {
+	case 10:
+		sum := 0
+		for i, r := range digits {
+			var d int
+			switch {
+			case r == 'X' && i == 9:
+				d = 10
+			case r >= '0' && r <= '9':
+				d = int(r - '0')
+			default:
+				return false
+			}
+			sum += (10 - i) * d
+		}
+		return sum%11 == 0
+	case 13:
+		sum := 0
+		for i, r := range digits {
+			if r < '0' || r > '9' {
+				return false
+			}
+			weight := 1
+			if i%2 == 1 {
+				weight = 3
+			}
+			sum += weight * int(r-'0')
+		}
+		return sum%10 == 0
+	}
+	return false
+}
+
+// hasControl reports whether s holds control characters like newlines
+func hasControl(s string) bool {
+	return strings.IndexFunc(s, unicode.IsControl) >= 0
+}
@@ -0,0 +1,72 @@
+// Package problem writes error responses as problem details of RFC 7807:
+//
+//	{"type": "about:blank", "title": "Not Found", "status": 404,
+//	 "detail": "book not found", "instance": "/api/v1/books/42",
+//	 "request_id": "..."}
+//
+// served as application/problem+json. Extension members carry what a client
+// needs to fix the request, like the invalid fields.
+package problem
+
+import (
+	"net/http"
+
+	"github.com/CAPS-Cloud/exercises/internal/logging"
+	"github.com/labstack/echo/v4"
+)
+
+// ContentType is the media type of problem details
+const ContentType = "application/problem+json"
+
+// Details describes an error. Type is about:blank for all problems of the
+// bookstore, since the status says all about their kind.
+type Details struct {
+	Type      string
+	Title     string
+	Status    int
+	Detail    string
+	Instance  string
+	RequestID string
+
+	// Fields maps invalid fields of the request to their problem
+	Fields map[string]string
+	// Extra holds further members specific to the endpoint
+	Extra map[string]interface{}
+}
+
+// New returns the problem of status described by detail, which occurred
+// while serving c
+func New(c echo.Context, status int, detail string) *Details {
+	return &Details{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  c.Request().URL.Path,
+		RequestID: logging.RequestID(c.Request().Context()),
+	}
+}
+
+// Respond answers c with the problem of status described by detail
+func Respond(c echo.Context, status int, detail string) error {
+	return New(c, status, detail).Write(c)
+}
+
+// Write answers c with p
+func (p *Details) Write(c echo.Context) error {
+	body := map[string]interface{}{}
+	for k, v := range p.Extra {
+		body[k] = v
+	}
+	body["type"], body["title"], body["status"] = p.Type, p.Title, p.Status
+	for k, v := range map[string]string{"detail": p.Detail, "instance": p.Instance, "request_id": p.RequestID} {
+		if v != "" {
+			body[k] = v
+		}
+	}
+	if len(p.Fields) > 0 {
+		body["fields"] = p.Fields
+	}
+	c.Response().Header().Set(echo.HeaderContentType, ContentType)
+	return c.JSON(p.Status, body)
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/labstack/echo/v4"
+)
+
+// strictJSON decodes request bodies like echo's default serializer, but
+// rejects fields the target does not know and data after the first value.
+// Its errors name the offending field, so that a typo like "auther" fails
+// with 400 instead of storing a book without author.
+type strictJSON struct {
+	echo.DefaultJSONSerializer
+}
+
+// Deserialize reads the JSON body of c into i
+func (strictJSON) Deserialize(c echo.Context, i interface{}) error {
+	dec := json.NewDecoder(c.Request().Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(i); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, tooLargeMessage(tooLarge)).SetInternal(err)
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, decodeProblem(err)).SetInternal(err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return echo.NewHTTPError(http.StatusBadRequest, "request body must hold a single JSON value")
+	}
+	return nil
+}
+
+// decodeProblem describes an error of the JSON decoder for clients
+func decodeProblem(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return "request body must be " + jsonType(typeErr.Type)
+		}
+		return fmt.Sprintf("field %q must be %s", typeErr.Field, jsonType(typeErr.Type))
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("malformed JSON at offset %d: %v", syntaxErr.Offset, syntaxErr)
+	case errors.Is(err, io.EOF):
+		return "request body is empty"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "malformed JSON: unexpected end of request body"
+	}
+	// The decoder reports unknown fields as `json: unknown field "name"`.
+	var field string
+	if _, scanErr := fmt.Sscanf(err.Error(), "json: unknown field %q", &field); scanErr == nil {
+		return fmt.Sprintf("unknown field %q", field)
+	}
+	return "invalid request body"
+}
+
+// jsonType names the JSON type a Go value of type t is decoded from
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Pointer:
+		return jsonType(t.Elem())
+	}
+	return "a JSON value"
+}
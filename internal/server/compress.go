@@ -0,0 +1,223 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// DefaultCompressionLevel trades size for speed unless configured
+	// otherwise; both gzip and Brotli take levels 1 to 9
+	DefaultCompressionLevel = 5
+	// compressMinLength is the size below which responses are sent as they
+	// are, since compressing them saves less than the headers cost
+	compressMinLength = 1024
+)
+
+// compressible reports whether responses of contentType are worth
+// compressing: JSON, HTML, CSS, CSV, feeds and other text. Images and
+// archives are compressed already, and event streams must reach the client
+// as soon as they are written.
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "text/event-stream" {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "xml") || mediaType == "application/javascript"
+}
+
+// acceptedEncoding returns the encoding of the response to a request with
+// the Accept-Encoding header accept: Brotli if the client takes it, gzip
+// otherwise, "" if it takes neither
+func acceptedEncoding(accept string) string {
+	var gzipOK bool
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "br":
+			return "br"
+		case "gzip":
+			gzipOK = true
+		}
+	}
+	if gzipOK {
+		return "gzip"
+	}
+	return ""
+}
+
+// encoderPool reuses the compressors of one encoding and level
+type encoderPool struct {
+	sync.Pool
+	reset func(enc io.WriteCloser, w io.Writer)
+}
+
+// get returns a compressor writing to w
+func (p *encoderPool) get(w io.Writer) io.WriteCloser {
+	enc := p.Get().(io.WriteCloser)
+	p.reset(enc, w)
+	return enc
+}
+
+// mountCompression compresses the responses New serves, with Brotli or gzip
+// as the client accepts, at opts.CompressionLevel from 1, the fastest, to 9,
+// the smallest; 0 turns compression off. Only compressible responses of at
+// least compressMinLength bytes are compressed, and WebSockets not at all.
+func mountCompression(e *echo.Echo, opts Options) {
+	level := opts.CompressionLevel
+	if level == 0 {
+		return
+	}
+	pools := map[string]*encoderPool{
+		"br": {
+			Pool:  sync.Pool{New: func() any { return brotli.NewWriterLevel(nil, level) }},
+			reset: func(enc io.WriteCloser, w io.Writer) { enc.(*brotli.Writer).Reset(w) },
+		},
+		"gzip": {
+			Pool: sync.Pool{New: func() any {
+				enc, _ := gzip.NewWriterLevel(nil, level) // level is valid
+				return enc
+			}},
+			reset: func(enc io.WriteCloser, w io.Writer) { enc.(*gzip.Writer).Reset(w) },
+		},
+	}
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			encoding := acceptedEncoding(c.Request().Header.Get(echo.HeaderAcceptEncoding))
+			if encoding == "" || c.IsWebSocket() {
+				return next(c)
+			}
+			res := c.Response()
+			w := &compressWriter{ResponseWriter: res.Writer, encoding: encoding, pool: pools[encoding]}
+			res.Writer = w
+			err := next(c)
+			if err != nil {
+				// The error page is written before the compressor is closed.
+				c.Error(err)
+			}
+			w.Close()
+			return err
+		}
+	})
+}
+
+// compressWriter compresses a response once it knows it is worth it: when
+// compressMinLength bytes have been written or the response is flushed, it
+// decides by the headers set by then. Until then, the status and the body
+// are held back.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	pool     *encoderPool
+	status   int
+	buf      []byte
+	decided  bool
+	enc      io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		if len(w.buf)+len(p) < compressMinLength {
+			w.buf = append(w.buf, p...)
+			return len(p), nil
+		}
+		if err := w.decide(false, p); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide sends the headers, what has been held back and then rest,
+// compressed if the response is compressible and, if it is complete, not
+// too short
+func (w *compressWriter) decide(complete bool, rest []byte) error {
+	w.decided = true
+	h := w.Header()
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if h.Get(echo.HeaderContentType) == "" && len(w.buf)+len(rest) > 0 {
+		h.Set(echo.HeaderContentType, http.DetectContentType(append(w.buf, rest...)))
+	}
+	if compressible(h.Get(echo.HeaderContentType)) {
+		h.Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+		// Ranges of static files count the bytes as they are.
+		whole := w.status != http.StatusNoContent && w.status != http.StatusNotModified && w.status != http.StatusPartialContent
+		if h.Get(echo.HeaderContentEncoding) == "" && whole && (!complete || len(w.buf) >= compressMinLength) {
+			h.Del(echo.HeaderContentLength)
+			h.Set(echo.HeaderContentEncoding, w.encoding)
+			w.enc = w.pool.get(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	out := io.Writer(w.ResponseWriter)
+	if w.enc != nil {
+		out = w.enc
+	}
+	for _, p := range [][]byte{w.buf, rest} {
+		if len(p) > 0 {
+			if _, err := out.Write(p); err != nil {
+				return err
+			}
+		}
+	}
+	w.buf = nil
+	return nil
+}
+
+// Flush sends what has been written so far, for responses like exports
+// that are written bit by bit
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(false, nil)
+	}
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Close sends the rest of the response and returns the compressor to its
+// pool
+func (w *compressWriter) Close() {
+	if !w.decided && (w.status != 0 || len(w.buf) > 0) {
+		w.decide(true, nil)
+	}
+	if w.enc != nil {
+		w.enc.Close()
+		w.pool.Put(w.enc)
+		w.enc = nil
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
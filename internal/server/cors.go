@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// defaultCORSHeaders are the request headers of the API that pages on other
+// origins may send unless Options.CORSHeaders names others
+var defaultCORSHeaders = []string{
+	echo.HeaderAuthorization, echo.HeaderContentType, "If-Match", "If-None-Match",
+	"Idempotency-Key", "X-API-Key", echo.HeaderXRequestID,
+}
+
+// corsExposedHeaders are the response headers of the API that pages on
+// other origins may read
+var corsExposedHeaders = []string{
+	"ETag", echo.HeaderLocation, "Link", "Deprecation", echo.HeaderRetryAfter,
+	echo.HeaderXRequestID, "X-Cache", "Idempotent-Replayed",
+}
+
+// corsMaxAge is how long, in seconds, browsers may reuse the answer to a
+// preflight request
+const corsMaxAge = 600
+
+// mountCORS lets the pages of opts.CORSOrigins, such as
+// https://books.example.com or * for every origin, call the API routes with
+// opts.CORSMethods and the headers in opts.CORSHeaders. Without origins the
+// API stays closed to other origins. It is added to e rather than to the API
+// groups because echo answers preflight requests without running the
+// middleware of groups; the other routes are skipped.
+func mountCORS(e *echo.Echo, opts Options) {
+	origins := opts.CORSOrigins
+	if len(origins) == 0 {
+		return
+	}
+	methods := opts.CORSMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+	headers := opts.CORSHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		Skipper: func(c echo.Context) bool {
+			path := c.Request().URL.Path
+			return path != "/api" && !strings.HasPrefix(path, "/api/")
+		},
+		AllowOrigins:  origins,
+		AllowMethods:  methods,
+		AllowHeaders:  headers,
+		ExposeHeaders: corsExposedHeaders,
+		MaxAge:        corsMaxAge,
+	}))
+}
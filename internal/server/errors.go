@@ -0,0 +1,72 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/labstack/echo/v4"
+)
+
+// ErrorPage renders the page shown to browsers for an error of status
+type ErrorPage func(c echo.Context, status int, message string) error
+
+// ErrorPages makes e answer the errors of browser routes with page. Requests
+// under /api and clients that do not accept HTML still get problem details.
+func ErrorPages(e *echo.Echo, page ErrorPage) {
+	e.HTTPErrorHandler = errorHandler(page)
+}
+
+// errorHandler answers the errors that handlers and middleware return
+// instead of writing a response, like unknown routes or a missing token.
+// The request logger has logged them already.
+func errorHandler(page ErrorPage) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+		status, message := http.StatusInternalServerError, "internal server error"
+		var he *echo.HTTPError
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &he):
+			status = he.Code
+			message = http.StatusText(status)
+			if m, ok := he.Message.(string); ok {
+				message = m
+			}
+		case errors.As(err, &tooLarge):
+			status, message = http.StatusRequestEntityTooLarge, tooLargeMessage(tooLarge)
+		}
+		if c.Request().Method == http.MethodHead {
+			c.NoContent(status)
+			return
+		}
+		if page != nil && wantsPage(c) {
+			err := page(c, status, message)
+			if err == nil {
+				return
+			}
+			slog.ErrorContext(c.Request().Context(), "cannot render error page", "error", err)
+			if c.Response().Committed {
+				return
+			}
+		}
+		if err := problem.Respond(c, status, message); err != nil {
+			slog.ErrorContext(c.Request().Context(), "cannot answer error", "error", err)
+		}
+	}
+}
+
+// wantsPage reports whether c comes from a browser visiting a page rather
+// than a client of the API
+func wantsPage(c echo.Context) bool {
+	path := c.Request().URL.Path
+	if path == "/api" || strings.HasPrefix(path, "/api/") {
+		return false
+	}
+	return strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMETextHTML) ||
+		c.Request().Header.Get("HX-Request") == "true"
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// healthCheckTimeout bounds the checks of a single GET /readyz
+const healthCheckTimeout = 2 * time.Second
+
+// Check reports whether a dependency of a service can be reached
+type Check func(ctx context.Context) error
+
+// MountHealth serves the probes of orchestrators: GET /healthz answers 200
+// as long as the process serves requests, GET /readyz runs checks, keyed by
+// the name of the dependency, and answers 503 unless all of them pass.
+func MountHealth(e *echo.Echo, checks map[string]Check) {
+	e.GET("/healthz", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+	})
+	e.GET("/readyz", func(c echo.Context) error {
+		ctx, cancel := context.WithTimeout(c.Request().Context(), healthCheckTimeout)
+		defer cancel()
+		status, overall := http.StatusOK, "ok"
+		results := map[string]string{}
+		for name, check := range checks {
+			results[name] = "ok"
+			if err := check(ctx); err != nil {
+				status, overall = http.StatusServiceUnavailable, "unavailable"
+				results[name] = err.Error()
+			}
+		}
+		return c.JSON(status, map[string]interface{}{"status": overall, "checks": results})
+	})
+}
+
+// isProbe reports whether c is a request of MountHealth
+func isProbe(c echo.Context) bool {
+	return c.Path() == "/healthz" || c.Path() == "/readyz"
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/bytes"
+)
+
+// DefaultBodyLimit is the largest request body accepted unless configured
+// otherwise or the route takes more, see BodyLimit
+const DefaultBodyLimit = 1 << 20
+
+// limitedBody is a request body that fails with *http.MaxBytesError once
+// more than limit bytes are read, or at once if the request announces a
+// longer one. The limit applies from the first read, so that the
+// middleware of a route can change it before.
+type limitedBody struct {
+	io.ReadCloser
+	w      http.ResponseWriter
+	length int64
+	limit  int64
+	reader io.Reader
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.reader == nil {
+		if b.length > b.limit {
+			return 0, &http.MaxBytesError{Limit: b.limit}
+		}
+		b.reader = http.MaxBytesReader(b.w, b.ReadCloser, b.limit)
+	}
+	return b.reader.Read(p)
+}
+
+// mountBodyLimit rejects request bodies larger than opts.BodyLimit, or
+// DefaultBodyLimit if it is 0, with 413, so that a client cannot make the
+// service hold a body of any size in memory.
+func mountBodyLimit(e *echo.Echo, opts Options) {
+	limit := opts.BodyLimit
+	if limit == 0 {
+		limit = DefaultBodyLimit
+	}
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.Body != nil && req.Body != http.NoBody {
+				req.Body = &limitedBody{ReadCloser: req.Body, w: c.Response(), length: req.ContentLength, limit: limit}
+			}
+			return next(c)
+		}
+	})
+}
+
+// BodyLimit lets a route, like an upload, take bodies of up to limit bytes
+// instead of Options.BodyLimit
+func BodyLimit(limit int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if b, ok := c.Request().Body.(*limitedBody); ok {
+				b.limit = limit
+			}
+			return next(c)
+		}
+	}
+}
+
+// tooLargeMessage tells the client how large its request body may be
+func tooLargeMessage(err *http.MaxBytesError) string {
+	return "request body may be at most " + bytes.Format(err.Limit)
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net"
+	"os"
+)
+
+// Listener says where and how a service serves: on the Unix domain socket
+// at Socket if it is set, for a reverse proxy on the same host, and on Port
+// of Host otherwise. An empty Host listens on every interface; port 0 on a
+// free port the system picks. With CertFile and KeyFile the service serves
+// TLS with that certificate, with Autocert with certificates it obtains
+// itself, see TLSConfig.
+type Listener struct {
+	Host     string
+	Port     string
+	Socket   string
+	CertFile string
+	KeyFile  string
+	Autocert Autocert
+}
+
+// addr returns the address l listens on, for messages
+func (l Listener) addr() string {
+	if l.Socket != "" {
+		return "unix:" + l.Socket
+	}
+	return net.JoinHostPort(l.Host, l.Port)
+}
+
+// Listen opens the socket l describes. A Unix socket left behind by a
+// service that did not stop cleanly is removed first; other files at its
+// path are not.
+func (l Listener) Listen() (net.Listener, error) {
+	if l.Socket == "" {
+		return net.Listen("tcp", net.JoinHostPort(l.Host, l.Port))
+	}
+	if fi, err := os.Lstat(l.Socket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(l.Socket); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", l.Socket)
+}
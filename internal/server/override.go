@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// overridable are the methods a POST may be turned into
+var overridable = map[string]bool{
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// MethodOverride returns middleware that lets HTML forms, which can only
+// send GET and POST, reach PUT, PATCH and DELETE routes: a POST is routed as
+// the method in its X-HTTP-Method-Override header or its _method form
+// field. Other methods named there are ignored. Routes are chosen before
+// the middleware added with Use runs, so it must be added with Pre.
+func MethodOverride() echo.MiddlewareFunc {
+	return middleware.MethodOverrideWithConfig(middleware.MethodOverrideConfig{
+		Getter: func(c echo.Context) string {
+			method := c.Request().Header.Get(echo.HeaderXHTTPMethodOverride)
+			if method == "" {
+				method = c.FormValue("_method")
+			}
+			method = strings.ToUpper(method)
+			if !overridable[method] {
+				return ""
+			}
+			return method
+		},
+	})
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"github.com/labstack/echo/v4"
+)
+
+// mountIPExtractor makes c.RealIP(), and with it the request log and the
+// rate limit, return the address of the client rather than that of a proxy
+// in front of the service. The X-Forwarded-For header is only believed when
+// the request comes from a proxy in opts.TrustedProxies. Without any,
+// proxies on loopback, link-local and private addresses are trusted, like
+// nginx in a compose network; opts.TrustNoProxy trusts none and takes the
+// address of the connection.
+func mountIPExtractor(e *echo.Echo, opts Options) {
+	switch {
+	case opts.TrustNoProxy:
+		e.IPExtractor = echo.ExtractIPDirect()
+		return
+	case len(opts.TrustedProxies) == 0:
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+		return
+	}
+	trust := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, ipNet := range opts.TrustedProxies {
+		trust = append(trust, echo.TrustIPRange(ipNet))
+	}
+	e.IPExtractor = echo.ExtractIPFromXFFHeader(trust...)
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
+)
+
+// RateLimitFromEnv returns middleware that lets every client IP make
+// RATE_LIMIT requests per second, with bursts of up to RATE_BURST requests
+// (default: twice the rate, at least 1). Rejected requests get 429 with a
+// Retry-After header; health probes are not limited. It returns nil if RATE_LIMIT is unset or 0.
+func RateLimitFromEnv() (echo.MiddlewareFunc, error) {
+	v := os.Getenv("RATE_LIMIT")
+	if v == "" {
+		return nil, nil
+	}
+	limit, err := strconv.ParseFloat(v, 64)
+	if err != nil || limit < 0 || math.IsInf(limit, 0) {
+		return nil, fmt.Errorf("invalid RATE_LIMIT %q: must be a non-negative number of requests per second", v)
+	}
+	if limit == 0 {
+		return nil, nil
+	}
+	burst := max(int(math.Ceil(2*limit)), 1)
+	if v := os.Getenv("RATE_BURST"); v != "" {
+		burst, err = strconv.Atoi(v)
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("invalid RATE_BURST %q: must be a positive integer", v)
+		}
+	}
+	return RateLimit(limit, burst), nil
+}
+
+// RateLimit returns middleware that lets every client IP make limit requests
+// per second, with bursts of up to burst requests
+func RateLimit(limit float64, burst int) echo.MiddlewareFunc {
+	// A client that ran out of requests gets the next one after 1/limit
+	// seconds.
+	retryAfter := strconv.Itoa(int(math.Ceil(1 / limit)))
+	return middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		// Probes must not use up the requests of the orchestrator's IP.
+		Skipper: isProbe,
+		Store: middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+			Rate:      rate.Limit(limit),
+			Burst:     burst,
+			ExpiresIn: 3 * time.Minute,
+		}),
+		IdentifierExtractor: func(c echo.Context) (string, error) {
+			return c.RealIP(), nil
+		},
+		DenyHandler: func(c echo.Context, identifier string, err error) error {
+			c.Response().Header().Set("Retry-After", retryAfter)
+			return problem.Respond(c, http.StatusTooManyRequests, "too many requests, retry later")
+		},
+	})
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// apiContentSecurityPolicy forbids a browser to load or run anything for a
+// response, which suits the JSON of the APIs. Services serving pages replace
+// it with ContentSecurityPolicy.
+const apiContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+
+// DefaultHSTSMaxAge is how long browsers stick to HTTPS unless configured
+// otherwise
+const DefaultHSTSMaxAge = 365 * 24 * time.Hour
+
+// mountSecurity sends the security headers with every response. The
+// Strict-Transport-Security header is only sent with responses over HTTPS,
+// directly or through a proxy setting X-Forwarded-Proto, so that browsers
+// are not told to use HTTPS for a service on localhost; an HSTSMaxAge of 0
+// stops it altogether. With HTTPSRedirect, requests over plain HTTP are
+// redirected to HTTPS, except those of the health probes.
+func mountSecurity(e *echo.Echo, opts Options) {
+	if opts.HTTPSRedirect {
+		e.Use(middleware.HTTPSRedirectWithConfig(middleware.RedirectConfig{Skipper: isProbe}))
+	}
+	e.Use(middleware.SecureWithConfig(middleware.SecureConfig{
+		ContentTypeNosniff:    "nosniff",
+		XFrameOptions:         "DENY",
+		HSTSMaxAge:            int(opts.HSTSMaxAge.Seconds()),
+		ContentSecurityPolicy: apiContentSecurityPolicy,
+		ReferrerPolicy:        "strict-origin-when-cross-origin",
+	}))
+}
+
+// ContentSecurityPolicy replaces the Content-Security-Policy that New sends
+// by policy
+func ContentSecurityPolicy(policy string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Response().Header().Set(echo.HeaderContentSecurityPolicy, policy)
+			return next(c)
+		}
+	}
+}
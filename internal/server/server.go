@@ -0,0 +1,203 @@
+// Package server sets up the echo instances shared by the HTTP services.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/logging"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// DefaultRequestTimeout bounds each request unless configured otherwise
+const DefaultRequestTimeout = 10 * time.Second
+
+// Options are the settings of New that config.Load reads. The zero value
+// sends no Strict-Transport-Security header and compresses nothing.
+type Options struct {
+	// HSTSMaxAge is how long browsers are told to stick to HTTPS, 0 for
+	// not at all
+	HSTSMaxAge time.Duration
+	// HTTPSRedirect redirects requests over plain HTTP to HTTPS
+	HTTPSRedirect bool
+	// CORSOrigins may call the API routes from their pages, with
+	// CORSMethods and CORSHeaders or, if empty, those of the API
+	CORSOrigins []string
+	CORSMethods []string
+	CORSHeaders []string
+	// CompressionLevel is that of gzip and Brotli, from 1 to 9, 0 for no
+	// compression
+	CompressionLevel int
+	// BodyLimit is the size in bytes of the largest request body accepted,
+	// 0 for DefaultBodyLimit
+	BodyLimit int64
+	// RequestTimeout is how long a request may take, 0 for
+	// DefaultRequestTimeout
+	RequestTimeout time.Duration
+	// TrustedProxies are the address ranges of the proxies whose
+	// X-Forwarded-For header is believed, see mountIPExtractor
+	TrustedProxies []*net.IPNet
+	TrustNoProxy   bool
+}
+
+// New returns an echo instance set up by opts. It logs every request
+// through slog, rejects JSON bodies with unknown fields and answers errors
+// with problem details. The context of a request, which handlers pass to the
+// database, is cancelled once the client goes away or after
+// opts.RequestTimeout; event streams, exports, WebSockets and profiles are
+// exempt. PPROF_PASSWORD enables the profiles of /debug/pprof. The mount*
+// functions called here describe the remaining middleware.
+func New(opts Options) *echo.Echo {
+	timeout := opts.RequestTimeout
+	if timeout == 0 {
+		timeout = DefaultRequestTimeout
+	}
+	e := echo.New()
+	// The services log their start themselves.
+	e.HideBanner, e.HidePort = true, true
+	e.HTTPErrorHandler = errorHandler(nil)
+	mountIPExtractor(e, opts)
+	e.JSONSerializer = strictJSON{}
+	e.Use(requestID())
+	e.Use(requestLogger())
+	mountSecurity(e, opts)
+	mountCompression(e, opts)
+	mountBodyLimit(e, opts)
+	mountCORS(e, opts)
+	e.Use(middleware.ContextTimeoutWithConfig(middleware.ContextTimeoutConfig{
+		Skipper: longLived,
+		Timeout: timeout,
+	}))
+	mountPprof(e)
+	return e
+}
+
+// longLived reports whether c is a request that stays open for as long as
+// the client wants or the data takes: an event stream, an export of the
+// catalog, a WebSocket or a profile
+func longLived(c echo.Context) bool {
+	return strings.HasSuffix(c.Path(), "/stream") || strings.Contains(c.Path(), "/export.") || c.IsWebSocket() || isProfile(c)
+}
+
+// MountAPI lets register add its routes under /api/v1 and under the
+// unversioned /api alias kept for existing clients, callable from the
+// origins New allows, see mountCORS
+func MountAPI(e *echo.Echo, register func(g *echo.Group)) {
+	register(e.Group("/api/v1"))
+	register(e.Group("/api", deprecatedAPI))
+}
+
+// deprecatedAPI marks responses of the unversioned /api routes as deprecated
+// and links to the /api/v1 successor of the requested resource.
+func deprecatedAPI(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		successor := "/api/v1" + strings.TrimPrefix(c.Request().URL.Path, "/api")
+		c.Response().Header().Set("Deprecation", "true")
+		c.Response().Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		return next(c)
+	}
+}
+
+// shutdownTimeout is how long in-flight requests may take to finish once
+// the service has been asked to stop
+const shutdownTimeout = 15 * time.Second
+
+// Start serves e as l says until the process receives SIGINT or SIGTERM. It
+// then stops accepting connections and returns once the in-flight requests
+// have finished, or after shutdownTimeout, so that the caller can close the
+// storage afterwards. Functions registered with e.Server.RegisterOnShutdown
+// should end long-lived responses like event streams.
+func Start(e *echo.Echo, name string, l Listener) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ln, err := l.Listen()
+	if err != nil {
+		logging.Fatal("cannot listen", "addr", l.addr(), "error", err)
+	}
+	tlsConf, err := l.TLSConfig()
+	if err != nil {
+		logging.Fatal("cannot load the TLS certificate", "error", err)
+	}
+	srv := e.Server
+	if tlsConf != nil {
+		srv = e.TLSServer
+		srv.TLSConfig = tlsConf
+		e.TLSListener = tls.NewListener(ln, tlsConf)
+	} else {
+		e.Listener = ln
+	}
+	go func() {
+		// The address is that of the listener, so that a port picked by
+		// the system is logged as it is.
+		slog.Info(name+" service starting", "addr", ln.Addr().String(), "tls", tlsConf != nil)
+		if err := e.StartServer(srv); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Fatal("cannot serve", "addr", ln.Addr().String(), "error", err)
+		}
+	}()
+
+	<-ctx.Done()
+	slog.Info(name + " service shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		slog.Error("shutdown incomplete", "error", err)
+	}
+}
+
+// requestLogger logs a line for every request with its route, status and
+// latency, and the error if the handler returned one. The request ID is
+// added by the logger.
+// Server errors are logged as errors.
+func requestLogger() echo.MiddlewareFunc {
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		LogMethod:    true,
+		LogURI:       true,
+		LogRoutePath: true,
+		LogStatus:    true,
+		LogLatency:   true,
+		LogRemoteIP:  true,
+		LogError:     true,
+		HandleError:  true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			level := slog.LevelInfo
+			if v.Status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			attrs := []slog.Attr{
+				slog.String("method", v.Method),
+				slog.String("uri", v.URI),
+				slog.String("route", v.RoutePath),
+				slog.Int("status", v.Status),
+				slog.Duration("latency", v.Latency),
+				slog.String("remote_ip", v.RemoteIP),
+			}
+			if v.Error != nil {
+				attrs = append(attrs, slog.String("error", v.Error.Error()))
+			}
+			slog.LogAttrs(c.Request().Context(), level, "request", attrs...)
+			return nil
+		},
+	})
+}
+
+// requestID answers every request with an X-Request-ID header, reusing the
+// ID sent by the client or a proxy, and puts the ID in the context of the
+// request. Everything logged with that context, down to the commands sent to
+// MongoDB, carries the ID.
+func requestID() echo.MiddlewareFunc {
+	return middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		RequestIDHandler: func(c echo.Context, id string) {
+			c.SetRequest(c.Request().WithContext(logging.WithRequestID(c.Request().Context(), id)))
+		},
+	})
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"crypto/tls"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Autocert has a service obtain its certificates from Let's Encrypt, or
+// another ACME CA at Directory, for the names in Hosts. They are requested
+// when a client first asks for a name and renewed before they expire. The
+// CA checks that the service controls a name by connecting to port 443 of
+// it, so the service has to listen there. Certificates are kept in the
+// directory Cache so that restarts do not request new ones.
+type Autocert struct {
+	Hosts     []string
+	Cache     string
+	Email     string
+	Directory string
+}
+
+// TLSConfig returns the configuration the service serves TLS with: the
+// certificate in CertFile, or those of Autocert if it has hosts. It is nil
+// for plain HTTP.
+func (l Listener) TLSConfig() (*tls.Config, error) {
+	if len(l.Autocert.Hosts) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(l.Autocert.Cache),
+			HostPolicy: autocert.HostWhitelist(l.Autocert.Hosts...),
+			Email:      l.Autocert.Email,
+		}
+		if l.Autocert.Directory != "" {
+			m.Client = &acme.Client{DirectoryURL: l.Autocert.Directory}
+		}
+		return m.TLSConfig(), nil
+	}
+	if l.CertFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(l.CertFile, l.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2", "http/1.1"}}, nil
+}
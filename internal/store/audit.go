@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditQuery selects entries of the audit log, newest first
+type AuditQuery struct {
+	BookID string    // "" for the entries of all books
+	Since  time.Time // zero for no lower bound
+	Until  time.Time // zero for no upper bound; exclusive
+	Limit  int64
+}
+
+// ensureAuditIndex makes listing the history of a book cheap
+func (s *Store) ensureAuditIndex(ctx context.Context) error {
+	_, err := s.audit.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "book_id", Value: 1}, {Key: "time", Value: -1}},
+		Options: options.Index().SetName("audit_book_time"),
+	})
+	return err
+}
+
+// InsertAuditEntry stores a new entry and sets its ID
+func (s *Store) InsertAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	res, err := s.audit.InsertOne(ctx, entry)
+	if err != nil {
+		return err
+	}
+	entry.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// ListAuditEntries returns the entries matching q, newest first
+func (s *Store) ListAuditEntries(ctx context.Context, q AuditQuery) ([]models.AuditEntry, error) {
+	filter := bson.M{}
+	if q.BookID != "" {
+		filter["book_id"] = q.BookID
+	}
+	period := bson.M{}
+	if !q.Since.IsZero() {
+		period["$gte"] = q.Since
+	}
+	if !q.Until.IsZero() {
+		period["$lt"] = q.Until
+	}
+	if len(period) > 0 {
+		filter["time"] = period
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(q.Limit)
+	cursor, err := s.audit.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]models.AuditEntry, 0)
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
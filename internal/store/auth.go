@@ -0,0 +1,151 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureAuthIndexes makes key lookups by hash cheap and keeps usernames unique
+func (s *Store) EnsureAuthIndexes(ctx context.Context) error {
+	if _, err := s.keys.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{"hash", 1}},
+		Options: options.Index().SetName("apikeys_hash").SetUnique(true),
+	}); err != nil {
+		return err
+	}
+	_, err := s.users.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{"username", 1}},
+		Options: options.Index().SetName("users_username").SetUnique(true),
+	})
+	return err
+}
+
+// InsertAPIKey stores a new key and sets its ID
+func (s *Store) InsertAPIKey(ctx context.Context, key *models.APIKey) error {
+	res, err := s.keys.InsertOne(ctx, key)
+	if err != nil {
+		return err
+	}
+	key.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// ListAPIKeys returns all keys, revoked ones included, oldest first
+func (s *Store) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	opts := options.Find().SetSort(bson.D{{"created_at", 1}}).SetProjection(bson.M{"hash": 0})
+	cursor, err := s.keys.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]models.APIKey, 0)
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey marks the key with the given ID as revoked, or returns
+// ErrNotFound if there is no such unrevoked key
+func (s *Store) RevokeAPIKey(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	filter := bson.M{"_id": oid, "revoked_at": bson.M{"$exists": false}}
+	res, err := s.keys.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now().UTC()}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// APIKeyByHash returns the unrevoked key with the given hash, or ErrNotFound
+func (s *Store) APIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	filter := bson.M{"hash": hash, "revoked_at": bson.M{"$exists": false}}
+	var key models.APIKey
+	err := s.keys.FindOne(ctx, filter).Decode(&key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return key, ErrNotFound
+	}
+	return key, err
+}
+
+// InsertUser stores a new user and sets its ID. ErrDuplicate is returned if
+// the username is taken.
+func (s *Store) InsertUser(ctx context.Context, user *models.User) error {
+	res, err := s.users.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	user.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// ListUsers returns all users ordered by username
+func (s *Store) ListUsers(ctx context.Context) ([]models.User, error) {
+	opts := options.Find().SetSort(bson.D{{"username", 1}}).SetProjection(bson.M{"password_hash": 0})
+	cursor, err := s.users.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]models.User, 0)
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// FindUser returns the user with the given username, or ErrNotFound
+func (s *Store) FindUser(ctx context.Context, username string) (models.User, error) {
+	var user models.User
+	err := s.users.FindOne(ctx, bson.M{"username": username}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+// UpdateUser assigns a new role and/or password hash to a user; empty values
+// are left unchanged. ErrNotFound is returned if there is no such user.
+func (s *Store) UpdateUser(ctx context.Context, username, role, passwordHash string) error {
+	update := bson.M{}
+	if role != "" {
+		update["role"] = role
+	}
+	if passwordHash != "" {
+		update["password_hash"] = passwordHash
+	}
+	res, err := s.users.UpdateOne(ctx, bson.M{"username": username}, bson.M{"$set": update})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteUser removes a user, or returns ErrNotFound
+func (s *Store) DeleteUser(ctx context.Context, username string) error {
+	res, err := s.users.DeleteOne(ctx, bson.M{"username": username})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
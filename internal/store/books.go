@@ -0,0 +1,739 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// storedFields maps the API field names of a book to the stored fields
+var storedFields = map[string]string{
+	"id":      "ID",
+	"title":   "BookName",
+	"author":  "BookAuthor",
+	"pages":   "BookPages",
+	"edition": "BookEdition",
+	"year":    "BookYear",
+}
+
+// SortCreated sorts books by the time they were inserted. It is not an API
+// field name, so it cannot be used in filters.
+const SortCreated = "created_at"
+
+// authorCollation is applied to author filters so that matching is done
+// case-insensitively ("mary shelley" finds "Mary Shelley"). Strength 2 compares
+// base letters and accents but ignores case; the stored value is left untouched.
+var authorCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// Condition restricts a listing to books whose field compares to Value with
+// Op: "eq", "contains" (case-insensitive substring), "gte" or "lte". The
+// numeric operators only apply to pages and year and need an integer Value.
+type Condition struct {
+	Field string // API field name, see models.BookFields
+	Op    string
+	Value string
+}
+
+// BookQuery describes a listing: which books to return, in which order and,
+// optionally, which page of them.
+type BookQuery struct {
+	IDs        []string    // if not nil, only books with one of these IDs
+	Deleted    bool        // the books in the trash instead of the others
+	Conditions []Condition // combined with AND
+	Author     string      // matched ignoring case
+	Year       string
+	Sort       string // API field name; "" keeps the natural order
+	Desc       bool
+	Page       int64 // 1-based; 0 means the listing is not paginated
+	Limit      int64
+}
+
+// filter translates the conditions of q into a BSON filter and the collation
+// it has to run with
+func (q BookQuery) filter() (bson.M, *options.Collation, error) {
+	var conds bson.A
+	var collation *options.Collation
+	for _, cond := range q.Conditions {
+		field, ok := storedFields[cond.Field]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown filter field %q", cond.Field)
+		}
+		switch cond.Op {
+		case "eq":
+			conds = append(conds, bson.M{field: cond.Value})
+		case "contains":
+			conds = append(conds, bson.M{field: primitive.Regex{Pattern: regexp.QuoteMeta(cond.Value), Options: "i"}})
+		case "gte", "lte":
+			n, err := strconv.Atoi(cond.Value)
+			if err != nil || !models.NumericFields[cond.Field] {
+				return nil, nil, fmt.Errorf("cannot compare %s %s %q", cond.Field, cond.Op, cond.Value)
+			}
+			// Convert the stored string on the fly; unparsable values never match.
+			asInt := bson.M{"$convert": bson.M{"input": "$" + field, "to": "int", "onError": nil, "onNull": nil}}
+			conds = append(conds, bson.M{"$expr": bson.M{"$" + cond.Op: bson.A{asInt, n}}})
+		default:
+			return nil, nil, fmt.Errorf("unknown filter operator %q", cond.Op)
+		}
+	}
+	if q.IDs != nil {
+		conds = append(conds, bson.M{"ID": bson.M{"$in": q.IDs}})
+	}
+	if q.Author != "" {
+		conds = append(conds, bson.M{"BookAuthor": q.Author})
+		collation = authorCollation
+	}
+	if q.Year != "" {
+		conds = append(conds, bson.M{"BookYear": q.Year})
+	}
+	if q.Deleted {
+		conds = append(conds, bson.M{"DeletedAt": bson.M{"$ne": nil}})
+	} else {
+		conds = append(conds, bson.M{"DeletedAt": nil})
+	}
+	return bson.M{"$and": conds}, collation, nil
+}
+
+// find translates q into the filter and the options of a Find, without
+// pagination
+func (q BookQuery) find() (bson.M, *options.FindOptions, error) {
+	filter, collation, err := q.filter()
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := options.Find()
+	dir := 1
+	if q.Desc {
+		dir = -1
+	}
+	switch q.Sort {
+	case "":
+	case SortCreated:
+		// Books without CreatedAt sort as the oldest, in insertion order.
+		opts.SetSort(bson.D{{Key: "CreatedAt", Value: dir}, {Key: "_id", Value: dir}})
+	default:
+		field, ok := storedFields[q.Sort]
+		if !ok {
+			return nil, nil, fmt.Errorf("cannot sort by %q", q.Sort)
+		}
+		// _id breaks ties so that equal values keep a stable order across pages.
+		opts.SetSort(bson.D{{Key: field, Value: dir}, {Key: "_id", Value: 1}})
+		// Pages and years are stored as strings; numeric ordering sorts "280" before "1000".
+		sortCollation := options.Collation{Locale: "en", NumericOrdering: true}
+		if collation != nil {
+			sortCollation.Strength = collation.Strength
+		}
+		collation = &sortCollation
+	}
+	if collation != nil {
+		opts.SetCollation(collation)
+	}
+	return filter, opts, nil
+}
+
+// ListBooks runs q. For paginated queries the total number of matches is
+// returned as well; otherwise it is 0.
+func (s *Store) ListBooks(ctx context.Context, q BookQuery) ([]models.BookStore, int64, error) {
+	filter, opts, err := q.find()
+	if err != nil {
+		return nil, 0, err
+	}
+	if q.Page == 0 {
+		books, err := s.findBooks(ctx, filter, opts)
+		return books, 0, err
+	}
+
+	if q.Sort == "" {
+		// Sort by insertion order so that pages are stable between requests.
+		opts.SetSort(bson.M{"_id": 1})
+	}
+	opts.SetSkip((q.Page - 1) * q.Limit).SetLimit(q.Limit)
+	books, err := s.findBooks(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	countOpts := options.Count()
+	if opts.Collation != nil {
+		countOpts.SetCollation(opts.Collation)
+	}
+	total, err := s.books.CountDocuments(ctx, filter, countOpts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return books, total, nil
+}
+
+// EachBook calls fn with every book matching q, in insertion order unless
+// q sorts them, decoding one document of the cursor at a time. Pagination
+// and MaxResults do not apply. It stops at the first error of fn.
+func (s *Store) EachBook(ctx context.Context, q BookQuery, fn func(models.BookStore) error) error {
+	filter, opts, err := q.find()
+	if err != nil {
+		return err
+	}
+	if q.Sort == "" {
+		opts.SetSort(bson.M{"_id": 1})
+	}
+	cursor, err := s.books.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var book models.BookStore
+		if err := cursor.Decode(&book); err != nil {
+			return err
+		}
+		if err := fn(book); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// findBooks retrieves the books matching filter, at most MaxResults of them
+func (s *Store) findBooks(ctx context.Context, filter bson.M, opts ...*options.FindOptions) ([]models.BookStore, error) {
+	// Ask for one document more than the cap so truncation can be detected.
+	// The cap comes first so that a smaller limit in opts takes precedence.
+	opts = append([]*options.FindOptions{options.Find().SetLimit(s.MaxResults + 1)}, opts...)
+	cursor, err := s.books.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	results := []models.BookStore{}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	if int64(len(results)) > s.MaxResults {
+		slog.Warn("query returned too many books, results were truncated", "max_results", s.MaxResults)
+		results = results[:s.MaxResults]
+	}
+	return results, nil
+}
+
+// GetBook returns the book with the given ID, or ErrNotFound
+func (s *Store) GetBook(ctx context.Context, id string) (models.BookStore, error) {
+	var book models.BookStore
+	err := s.books.FindOne(ctx, bson.M{"ID": id, "DeletedAt": nil}).Decode(&book)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return book, ErrNotFound
+	}
+	return book, err
+}
+
+// BookExists reports whether a book with the given ID is stored and not in
+// the trash
+func (s *Store) BookExists(ctx context.Context, id string) (bool, error) {
+	count, err := s.books.CountDocuments(ctx, bson.M{"ID": id, "DeletedAt": nil})
+	return count > 0, err
+}
+
+// CountBooks returns the number of stored books outside the trash
+func (s *Store) CountBooks(ctx context.Context) (int64, error) {
+	return s.books.CountDocuments(ctx, bson.M{"DeletedAt": nil})
+}
+
+// ensureBookIndexes creates the unique index on the book ID that makes
+// CreateBook reject duplicates. Books in the trash keep their ID until they
+// are purged.
+func (s *Store) ensureBookIndexes(ctx context.Context) error {
+	_, err := s.books.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "ID", Value: 1}},
+		Options: options.Index().SetName("books_id").SetUnique(true),
+	})
+	return err
+}
+
+// CreateBook stores a new book. ErrDuplicate is returned if its ID is taken
+// and ErrInvalid if it does not match models.BookSchema.
+func (s *Store) CreateBook(ctx context.Context, book models.BookStore) error {
+	now := time.Now().UTC()
+	book.Revision, book.CreatedAt = 1, &now
+	_, err := s.books.InsertOne(ctx, book)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil && rejectedByValidator(err) {
+		return ErrInvalid
+	}
+	return err
+}
+
+// CreateBooks stores books with a single unordered InsertMany, so one
+// rejected book does not keep the others from being stored. Books whose ID
+// is taken get ErrDuplicate, books not matching models.BookSchema ErrInvalid.
+func (s *Store) CreateBooks(ctx context.Context, books []models.BookStore) ([]error, error) {
+	docs := make([]interface{}, len(books))
+	now := time.Now().UTC()
+	for i, book := range books {
+		book.Revision, book.CreatedAt = 1, &now
+		docs[i] = book
+	}
+	errs := make([]error, len(books))
+	_, err := s.books.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, we := range bulkErr.WriteErrors {
+			switch {
+			case we.Code == 11000:
+				errs[we.Index] = ErrDuplicate
+			case we.Code == 121:
+				errs[we.Index] = ErrInvalid
+			default:
+				errs[we.Index] = we
+			}
+		}
+		return errs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+// UpsertBooks stores books with a single unordered bulk write of upserts
+// that only set the fields of books they insert
+func (s *Store) UpsertBooks(ctx context.Context, books []models.BookStore) (int64, error) {
+	if len(books) == 0 {
+		return 0, nil
+	}
+	writes := make([]mongo.WriteModel, len(books))
+	now := time.Now().UTC()
+	for i, book := range books {
+		book.Revision, book.CreatedAt = 1, &now
+		writes[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"ID": book.ID}).
+			SetUpdate(bson.M{"$setOnInsert": book}).
+			SetUpsert(true)
+	}
+	res, err := s.books.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	if err != nil && rejectedByValidator(err) {
+		return 0, ErrInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+	return res.UpsertedCount, nil
+}
+
+// UpdateBook sets the given fields, keyed by API field name, on the book with
+// the given ID and returns the updated book, or ErrNotFound, also for books
+// in the trash. Changing the ID to one that is taken returns ErrDuplicate,
+// breaking models.BookSchema ErrInvalid. If revision is not 0 and the book is at another revision,
+// ErrConflict is returned and nothing changes.
+func (s *Store) UpdateBook(ctx context.Context, id string, revision int64, fields map[string]string) (models.BookStore, error) {
+	update := bson.M{}
+	for name, value := range fields {
+		field, ok := storedFields[name]
+		if !ok {
+			return models.BookStore{}, fmt.Errorf("unknown field %q", name)
+		}
+		update[field] = value
+	}
+	filter := bson.M{"ID": id, "DeletedAt": nil}
+	if revision != 0 {
+		filter["Revision"] = revision
+	}
+	var book models.BookStore
+	err := s.books.FindOneAndUpdate(ctx, filter, bson.M{"$set": update, "$inc": bson.M{"Revision": int64(1)}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&book)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if revision != 0 {
+			if exists, existsErr := s.BookExists(ctx, id); existsErr == nil && exists {
+				return book, ErrConflict
+			}
+		}
+		return book, ErrNotFound
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return book, ErrDuplicate
+	}
+	if err != nil && rejectedByValidator(err) {
+		return book, ErrInvalid
+	}
+	return book, err
+}
+
+// UpdateBooks sets fields on the books matching q with UpdateMany and
+// returns the number of matches and the changed books. Books already holding
+// the values keep their revision. Run it in a transaction so that the
+// returned books are the ones that were changed.
+func (s *Store) UpdateBooks(ctx context.Context, q BookQuery, fields map[string]string) (int64, []models.BookStore, error) {
+	filter, collation, err := q.filter()
+	if err != nil {
+		return 0, nil, err
+	}
+	set := bson.M{}
+	var differs bson.A
+	for name, value := range fields {
+		field, ok := storedFields[name]
+		if !ok {
+			return 0, nil, fmt.Errorf("unknown field %q", name)
+		}
+		set[field] = value
+		differs = append(differs, bson.M{field: bson.M{"$ne": value}})
+	}
+	countOpts, findOpts := options.Count(), options.Find()
+	if collation != nil {
+		countOpts.SetCollation(collation)
+		findOpts.SetCollation(collation)
+	}
+	matched, err := s.books.CountDocuments(ctx, filter, countOpts)
+	if err != nil || len(fields) == 0 {
+		return matched, nil, err
+	}
+	cursor, err := s.books.Find(ctx, bson.M{"$and": bson.A{filter, bson.M{"$or": differs}}}, findOpts)
+	if err != nil {
+		return 0, nil, err
+	}
+	books := []models.BookStore{}
+	if err := cursor.All(ctx, &books); err != nil {
+		return 0, nil, err
+	}
+	if len(books) == 0 {
+		return matched, books, nil
+	}
+	oids := make(bson.A, len(books))
+	for i := range books {
+		oids[i] = books[i].MongoID
+		books[i].Revision++
+		for name, value := range fields {
+			setBookField(&books[i], name, value)
+		}
+	}
+	_, err = s.books.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": oids}}, bson.M{"$set": set, "$inc": bson.M{"Revision": int64(1)}})
+	if mongo.IsDuplicateKeyError(err) {
+		return 0, nil, ErrDuplicate
+	}
+	if err != nil && rejectedByValidator(err) {
+		return 0, nil, ErrInvalid
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return matched, books, nil
+}
+
+// DeleteBooks moves the books matching q to the trash with UpdateMany and
+// returns them. The order and pagination of q are ignored.
+func (s *Store) DeleteBooks(ctx context.Context, q BookQuery) ([]models.BookStore, error) {
+	books, err := s.matchingBooks(ctx, q)
+	if err != nil || len(books) == 0 {
+		return books, err
+	}
+	now := time.Now().UTC()
+	oids := make(bson.A, len(books))
+	for i := range books {
+		oids[i] = books[i].MongoID
+		books[i].DeletedAt = &now
+	}
+	// Only books that are still live are trashed; one trashed in between
+	// keeps its original time.
+	_, err = s.books.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": oids}, "DeletedAt": nil},
+		bson.M{"$set": bson.M{"DeletedAt": now}})
+	if err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+// PurgeBooks removes the books in the trash matching q with DeleteMany and
+// returns them. The order and pagination of q are ignored.
+func (s *Store) PurgeBooks(ctx context.Context, q BookQuery) ([]models.BookStore, error) {
+	q.Deleted = true
+	books, err := s.matchingBooks(ctx, q)
+	if err != nil || len(books) == 0 {
+		return books, err
+	}
+	// Deleting by _id removes exactly the books that are returned.
+	oids := make(bson.A, len(books))
+	for i, book := range books {
+		oids[i] = book.MongoID
+	}
+	if _, err := s.books.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": oids}}); err != nil {
+		return nil, err
+	}
+	for _, book := range books {
+		if book.Cover != nil {
+			s.deleteCoverFiles(ctx, *book.Cover)
+		}
+	}
+	return books, nil
+}
+
+// matchingBooks returns all books matching q, ignoring its order and
+// pagination
+func (s *Store) matchingBooks(ctx context.Context, q BookQuery) ([]models.BookStore, error) {
+	filter, collation, err := q.filter()
+	if err != nil {
+		return nil, err
+	}
+	opts := options.Find()
+	if collation != nil {
+		opts.SetCollation(collation)
+	}
+	cursor, err := s.books.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	books := []models.BookStore{}
+	if err := cursor.All(ctx, &books); err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+// DeleteBook moves the book with the given ID to the trash, or returns
+// ErrNotFound
+func (s *Store) DeleteBook(ctx context.Context, id string) error {
+	res, err := s.books.UpdateOne(ctx, bson.M{"ID": id, "DeletedAt": nil},
+		bson.M{"$set": bson.M{"DeletedAt": time.Now().UTC()}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RestoreBook takes the book with the given ID out of the trash and returns
+// it, or ErrNotFound if it is not in the trash
+func (s *Store) RestoreBook(ctx context.Context, id string) (models.BookStore, error) {
+	var book models.BookStore
+	err := s.books.FindOneAndUpdate(ctx, bson.M{"ID": id, "DeletedAt": bson.M{"$ne": nil}},
+		bson.M{"$unset": bson.M{"DeletedAt": ""}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&book)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return book, ErrNotFound
+	}
+	return book, err
+}
+
+// Distinct returns the sorted distinct non-empty values of a book field,
+// given by its API name
+func (s *Store) Distinct(ctx context.Context, field string) ([]string, error) {
+	stored, ok := storedFields[field]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", field)
+	}
+	values, err := s.books.Distinct(ctx, stored, bson.M{"DeletedAt": nil})
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]string, 0, len(values))
+	for _, v := range values {
+		if str, ok := v.(string); ok && str != "" {
+			ret = append(ret, str)
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// EnsureTextIndex creates the text index on title and author used by
+// TextSearch. Creating an index that already exists is a no-op.
+func (s *Store) EnsureTextIndex(ctx context.Context) error {
+	_, err := s.books.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "BookName", Value: "text"}, {Key: "BookAuthor", Value: "text"}},
+		Options: options.Index().
+			SetName("books_text").
+			SetWeights(bson.D{{Key: "BookName", Value: 2}, {Key: "BookAuthor", Value: 1}}),
+	})
+	return err
+}
+
+// ScoredBook is a match of a full-text search with its relevance
+type ScoredBook struct {
+	models.BookStore `bson:",inline"`
+	Score            float64 `bson:"score"`
+}
+
+// TextSearch runs a full-text search over title and author and returns at
+// most limit matches ranked by relevance
+func (s *Store) TextSearch(ctx context.Context, q string, limit int64) ([]ScoredBook, error) {
+	score := bson.M{"$meta": "textScore"}
+	opts := options.Find().
+		SetProjection(bson.M{"score": score}).
+		SetSort(bson.M{"score": score}).
+		SetLimit(limit)
+	cursor, err := s.books.Find(ctx, bson.M{"$text": bson.M{"$search": q}, "DeletedAt": nil}, opts)
+	if err != nil {
+		return nil, err
+	}
+	results := []ScoredBook{}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// SearchTitles returns the books whose title contains q, ignoring case
+func (s *Store) SearchTitles(ctx context.Context, q string) ([]models.BookStore, error) {
+	filter := bson.M{"BookName": primitive.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}, "DeletedAt": nil}
+	return s.findBooks(ctx, filter)
+}
+
+// fuzzyCandidateLimit caps how many books are scanned by a fuzzy search.
+const fuzzyCandidateLimit = 1000
+
+// fuzzyMaxDistance is the largest edit distance still reported as a match.
+const fuzzyMaxDistance = 2
+
+// RankedBook is a match of a fuzzy search with the edit distance of its title
+type RankedBook struct {
+	models.BookStore
+	Distance int
+}
+
+// FuzzySearch ranks titles by edit distance to q so that small typos
+// ("Frankenstien") still find the intended book.
+func (s *Store) FuzzySearch(ctx context.Context, q string) ([]RankedBook, error) {
+	cursor, err := s.books.Find(ctx, bson.M{"DeletedAt": nil}, options.Find().SetLimit(fuzzyCandidateLimit))
+	if err != nil {
+		return nil, err
+	}
+	var candidates []models.BookStore
+	if err = cursor.All(ctx, &candidates); err != nil {
+		return nil, err
+	}
+
+	return rankByDistance(candidates, q), nil
+}
+
+// titleDistance is the smallest edit distance between q and either the whole
+// title or a run of as many consecutive title words as q has, compared
+// case-insensitively, so "Blak Cat" is close to "The Black Cat".
+func titleDistance(q, title string) int {
+	qWords := strings.Fields(strings.ToLower(q))
+	q = strings.Join(qWords, " ")
+	title = strings.ToLower(title)
+	best := levenshtein(q, title)
+	words := strings.Fields(title)
+	for i := 0; i+len(qWords) <= len(words); i++ {
+		if d := levenshtein(q, strings.Join(words[i:i+len(qWords)], " ")); d < best {
+			best = d
+		}
+	}
+	return best
+}
+
+// levenshtein computes the edit distance between a and b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// changeEvent is the part of a change stream event WatchBooks needs
+type changeEvent struct {
+	OperationType            string            `bson:"operationType"`
+	FullDocument             *models.BookStore `bson:"fullDocument"`
+	FullDocumentBeforeChange *models.BookStore `bson:"fullDocumentBeforeChange"`
+	DocumentKey              struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	UpdateDescription struct {
+		UpdatedFields bson.M   `bson:"updatedFields"`
+		RemovedFields []string `bson:"removedFields"`
+	} `bson:"updateDescription"`
+}
+
+// WatchBooks opens a change stream on the books collection and reports every
+// insert, update and delete until ctx is done. Moving a book to the trash is
+// reported as a delete and restoring it as an insert. Change streams need a
+// replica set; on a standalone server ErrWatchUnsupported is returned.
+func (s *Store) WatchBooks(ctx context.Context) (<-chan BookEvent, error) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{
+		"operationType": bson.M{"$in": bson.A{"insert", "update", "replace", "delete"}},
+	}}}}
+	opts := options.ChangeStream().
+		SetFullDocument(options.UpdateLookup).
+		SetFullDocumentBeforeChange(options.WhenAvailable)
+	stream, err := s.books.Watch(ctx, pipeline, opts)
+	if err != nil {
+		if changeStreamsUnsupported(err) {
+			return nil, ErrWatchUnsupported
+		}
+		return nil, err
+	}
+
+	events := make(chan BookEvent)
+	go func() {
+		defer close(events)
+		defer stream.Close(context.Background())
+		for stream.Next(ctx) {
+			var change changeEvent
+			if err := stream.Decode(&change); err != nil {
+				slog.Error("cannot decode change event", "error", err)
+				continue
+			}
+			ev := BookEvent{Op: OpUpdate}
+			switch change.OperationType {
+			case "insert":
+				ev.Op = OpInsert
+			case "delete":
+				ev.Op = OpDelete
+				if before := change.FullDocumentBeforeChange; before != nil && before.DeletedAt != nil {
+					// Purged from the trash; its delete was reported when
+					// it was trashed.
+					continue
+				}
+			case "update":
+				if _, ok := change.UpdateDescription.UpdatedFields["DeletedAt"]; ok {
+					ev.Op = OpDelete
+				} else if slices.Contains(change.UpdateDescription.RemovedFields, "DeletedAt") {
+					ev.Op = OpInsert
+				}
+			}
+			switch {
+			case change.FullDocument != nil:
+				ev.Book = *change.FullDocument
+			case change.FullDocumentBeforeChange != nil:
+				ev.Book = *change.FullDocumentBeforeChange
+			case ev.Op == OpDelete:
+				ev.Book.MongoID = change.DocumentKey.ID
+			default:
+				// The book was deleted before its update could be looked up;
+				// the delete event follows.
+				continue
+			}
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := stream.Err(); err != nil && ctx.Err() == nil {
+			slog.Error("watching books failed", "error", err)
+		}
+	}()
+	return events, nil
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"frankenstein", "frankenstein", 0},
+		{"frankenstien", "frankenstein", 2}, // two letters swapped
+		{"frankenstin", "frankenstein", 1},  // one left out
+		{"frankensteinn", "frankenstein", 1},
+		{"kitten", "sitting", 3},
+		{"müde", "mude", 1}, // runes, not bytes
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestTitleDistance(t *testing.T) {
+	tests := []struct {
+		q, title string
+		want     int
+	}{
+		{"Frankenstein", "Frankenstein", 0},
+		{"frankenstien", "Frankenstein", 2},
+		{"  Frankenstin ", "Frankenstein", 1},
+		// A word of the title is enough.
+		{"Usher", "The Fall of the House of Usher", 0},
+		{"Ushr", "The Fall of the House of Usher", 1},
+		// So is a run of as many words as the query has.
+		{"the house of usher", "The Fall of the House of Usher", 0},
+		{"Blak Cat", "The Black Cat", 1},
+		{"house  of ushr", "The Fall of the House of Usher", 1},
+		{"fall house", "The Fall of the House of Usher", 4}, // the words must be consecutive
+	}
+	for _, tt := range tests {
+		if got := titleDistance(tt.q, tt.title); got != tt.want {
+			t.Errorf("titleDistance(%q, %q) = %d, want %d", tt.q, tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestRankByDistance(t *testing.T) {
+	books := []models.BookStore{
+		{ID: "1", BookName: "Frankenstein"},
+		{ID: "2", BookName: "The Raven"},
+		{ID: "3", BookName: "Frankenstein Unbound"},
+		{ID: "4", BookName: "Frankenstien"},
+		{ID: "5", BookName: "Young Frankenstin"},
+	}
+	got := rankByDistance(books, "Frankenstien")
+	want := []struct {
+		id       string
+		distance int
+	}{{"4", 0}, {"5", 1}, {"1", 2}, {"3", 2}}
+	if len(got) != len(want) {
+		t.Fatalf("got %d matches, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if got[i].ID != w.id || got[i].Distance != w.distance {
+			t.Errorf("match %d = %s at %d, want %s at %d", i, got[i].ID, got[i].Distance, w.id, w.distance)
+		}
+	}
+	if matches := rankByDistance(books, "Dracula"); len(matches) != 0 {
+		t.Errorf("matches of Dracula = %+v, want none", matches)
+	}
+	cats := []models.BookStore{{ID: "6", BookName: "The Black Cat"}}
+	if matches := rankByDistance(cats, "Blak Cat"); len(matches) != 1 || matches[0].Distance != 1 {
+		t.Errorf("matches of Blak Cat = %+v, want The Black Cat at 1", matches)
+	}
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SetCover uploads data and its thumbnails to the covers bucket of GridFS
+// and points the book at the new files. The files of the previous cover
+// are deleted afterwards; if that fails, they are only left behind.
+func (s *Store) SetCover(ctx context.Context, id string, cover models.Cover, data []byte, thumbnails map[string][]byte) (models.BookStore, error) {
+	opts := options.GridFSUpload().SetMetadata(bson.M{"book_id": id, "content_type": cover.ContentType})
+	fileID, err := s.covers.UploadFromStream(id, bytes.NewReader(data), opts)
+	if err != nil {
+		return models.BookStore{}, err
+	}
+	cover.FileID = fileID.Hex()
+	for size, thumbnail := range thumbnails {
+		opts := options.GridFSUpload().SetMetadata(bson.M{"book_id": id, "content_type": models.ThumbnailType, "size": size})
+		if err := s.covers.UploadFromStreamWithID(cover.ThumbnailID(size), id, bytes.NewReader(thumbnail), opts); err != nil {
+			s.deleteCoverFiles(ctx, cover)
+			return models.BookStore{}, err
+		}
+	}
+	var book models.BookStore
+	err = s.books.FindOneAndUpdate(ctx, bson.M{"ID": id, "DeletedAt": nil}, bson.M{"$set": bson.M{"Cover": cover}}).Decode(&book)
+	if err != nil {
+		s.deleteCoverFiles(ctx, cover)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return book, ErrNotFound
+		}
+		return book, err
+	}
+	if book.Cover != nil {
+		s.deleteCoverFiles(ctx, *book.Cover)
+	}
+	book.Cover = &cover
+	return book, nil
+}
+
+// OpenCover returns the cover of the book in size and a stream of its
+// GridFS file
+func (s *Store) OpenCover(ctx context.Context, id, size string) (models.Cover, io.ReadCloser, error) {
+	book, err := s.GetBook(ctx, id)
+	if err != nil {
+		return models.Cover{}, nil, err
+	}
+	if book.Cover == nil {
+		return models.Cover{}, nil, ErrNotFound
+	}
+	cover := *book.Cover
+	if size != "" {
+		stream, err := s.covers.OpenDownloadStream(cover.ThumbnailID(size))
+		if err == nil {
+			thumbnail := models.Cover{FileID: cover.ThumbnailID(size), ContentType: models.ThumbnailType, Size: stream.GetFile().Length, UploadedAt: cover.UploadedAt}
+			return thumbnail, stream, nil
+		}
+		if !errors.Is(err, gridfs.ErrFileNotFound) {
+			return models.Cover{}, nil, err
+		}
+	}
+	fileID, err := primitive.ObjectIDFromHex(cover.FileID)
+	if err != nil {
+		return models.Cover{}, nil, err
+	}
+	stream, err := s.covers.OpenDownloadStream(fileID)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return models.Cover{}, nil, ErrNotFound
+	}
+	if err != nil {
+		return models.Cover{}, nil, err
+	}
+	return cover, stream, nil
+}
+
+// deleteCoverFiles removes the files of the cover from the covers bucket:
+// the image and its thumbnails. Failures are logged and otherwise ignored,
+// since a stray file does no harm.
+func (s *Store) deleteCoverFiles(ctx context.Context, cover models.Cover) {
+	ids := []interface{}{}
+	if oid, err := primitive.ObjectIDFromHex(cover.FileID); err == nil {
+		ids = append(ids, oid)
+	}
+	for size := range models.CoverSizes {
+		ids = append(ids, cover.ThumbnailID(size))
+	}
+	for _, fileID := range ids {
+		err := s.covers.DeleteContext(ctx, fileID)
+		if err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			slog.WarnContext(ctx, "cannot delete cover image", "file", fileID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ensureHistoryIndex keeps one copy of each version of a book and makes
+// listing them cheap
+func (s *Store) ensureHistoryIndex(ctx context.Context) error {
+	_, err := s.history.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "book_id", Value: 1}, {Key: "version", Value: -1}},
+		Options: options.Index().SetName("book_history_version").SetUnique(true),
+	})
+	return err
+}
+
+// InsertBookVersion stores a previous version of a book and sets its ID.
+// ErrDuplicate is returned if the version is already stored.
+func (s *Store) InsertBookVersion(ctx context.Context, v *models.BookVersion) error {
+	res, err := s.history.InsertOne(ctx, v)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	v.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// ListBookVersions returns the previous versions of a book, newest first
+func (s *Store) ListBookVersions(ctx context.Context, bookID string) ([]models.BookVersion, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: -1}})
+	cursor, err := s.history.Find(ctx, bson.M{"book_id": bookID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]models.BookVersion, 0)
+	if err := cursor.All(ctx, &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// GetBookVersion returns a previous version of a book or ErrNotFound
+func (s *Store) GetBookVersion(ctx context.Context, bookID string, version int64) (models.BookVersion, error) {
+	var v models.BookVersion
+	err := s.history.FindOne(ctx, bson.M{"book_id": bookID, "version": version}).Decode(&v)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+
+// DeleteBookVersions removes the previous versions of the books with the
+// given IDs
+func (s *Store) DeleteBookVersions(ctx context.Context, bookIDs []string) error {
+	_, err := s.history.DeleteMany(ctx, bson.M{"book_id": bson.M{"$in": bookIDs}})
+	return err
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IdempotencyTTL is how long the response to an Idempotency-Key is replayed
+const IdempotencyTTL = 24 * time.Hour
+
+// ensureIdempotencyIndex lets MongoDB remove idempotency records once they
+// have expired
+func (s *Store) ensureIdempotencyIndex(ctx context.Context) error {
+	_, err := s.idemKeys.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().SetName("idempotency_expiry").SetExpireAfterSeconds(int32(IdempotencyTTL.Seconds())),
+	})
+	return err
+}
+
+// ClaimIdempotencyKey stores rec unless its key is taken; then the stored
+// record is returned with ErrDuplicate. MongoDB removes expired records only
+// once a minute, so they are skipped here as well.
+func (s *Store) ClaimIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord) (models.IdempotencyRecord, error) {
+	_, err := s.idemKeys.DeleteOne(ctx, bson.M{"_id": rec.Key, "created_at": bson.M{"$lt": time.Now().Add(-IdempotencyTTL)}})
+	if err != nil {
+		return rec, err
+	}
+	_, err = s.idemKeys.InsertOne(ctx, rec)
+	if !mongo.IsDuplicateKeyError(err) {
+		return rec, err
+	}
+	var stored models.IdempotencyRecord
+	err = s.idemKeys.FindOne(ctx, bson.M{"_id": rec.Key}).Decode(&stored)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// Released in the meantime: report it as running, so that the
+		// client retries.
+		return rec, ErrDuplicate
+	}
+	if err != nil {
+		return rec, err
+	}
+	return stored, ErrDuplicate
+}
+
+// CompleteIdempotencyKey stores the response to the claimed key
+func (s *Store) CompleteIdempotencyKey(ctx context.Context, key string, status int, body []byte) error {
+	_, err := s.idemKeys.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{"status": status, "body": body}})
+	return err
+}
+
+// ReleaseIdempotencyKey drops the claim of key
+func (s *Store) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := s.idemKeys.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
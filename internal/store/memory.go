@@ -0,0 +1,1003 @@
+package store
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Memory is a map-backed Repository for tests and demos without a running
+// MongoDB. Its data lives in the process, so services using it neither share
+// books with each other nor keep them across restarts.
+type Memory struct {
+	mu       sync.RWMutex
+	books    []models.BookStore // in insertion order
+	keys     []models.APIKey
+	users    map[string]models.User
+	webhooks []models.Webhook
+	audit    []models.AuditEntry // oldest first
+	history  []models.BookVersion
+	covers   map[string][]byte // cover images by file ID
+	idemKeys map[string]models.IdempotencyRecord
+
+	// tx serializes transactions, see WithTransaction
+	tx sync.Mutex
+
+	// watchers receive the changes of books, see WatchBooks
+	watchers map[chan BookEvent]struct{}
+
+	// MaxResults caps how many books a listing returns.
+	MaxResults int64
+}
+
+// NewMemory returns an empty in-memory repository
+func NewMemory() *Memory {
+	return &Memory{
+		users:      map[string]models.User{},
+		covers:     map[string][]byte{},
+		idemKeys:   map[string]models.IdempotencyRecord{},
+		watchers:   map[chan BookEvent]struct{}{},
+		MaxResults: 10000,
+	}
+}
+
+// bookField returns the value of a book field given by its API name
+func bookField(b models.BookStore, name string) string {
+	switch name {
+	case "id":
+		return b.ID
+	case "title":
+		return b.BookName
+	case "author":
+		return b.BookAuthor
+	case "pages":
+		return b.BookPages
+	case "edition":
+		return b.BookEdition
+	case "year":
+		return b.BookYear
+	}
+	return ""
+}
+
+// setBookField sets a book field given by its API name
+func setBookField(b *models.BookStore, name, value string) error {
+	switch name {
+	case "id":
+		b.ID = value
+	case "title":
+		b.BookName = value
+	case "author":
+		b.BookAuthor = value
+	case "pages":
+		b.BookPages = value
+	case "edition":
+		b.BookEdition = value
+	case "year":
+		b.BookYear = value
+	default:
+		return fmt.Errorf("unknown field %q", name)
+	}
+	return nil
+}
+
+// matches reports whether b satisfies every condition of q
+func (q BookQuery) matches(b models.BookStore) (bool, error) {
+	for _, cond := range q.Conditions {
+		if _, ok := storedFields[cond.Field]; !ok {
+			return false, fmt.Errorf("unknown filter field %q", cond.Field)
+		}
+		value := bookField(b, cond.Field)
+		switch cond.Op {
+		case "eq":
+			if value != cond.Value {
+				return false, nil
+			}
+		case "contains":
+			if !strings.Contains(strings.ToLower(value), strings.ToLower(cond.Value)) {
+				return false, nil
+			}
+		case "gte", "lte":
+			n, err := strconv.Atoi(cond.Value)
+			if err != nil || !models.NumericFields[cond.Field] {
+				return false, fmt.Errorf("cannot compare %s %s %q", cond.Field, cond.Op, cond.Value)
+			}
+			// Like in MongoDB, unparsable stored values never match.
+			v, err := strconv.Atoi(value)
+			if err != nil || (cond.Op == "gte" && v < n) || (cond.Op == "lte" && v > n) {
+				return false, nil
+			}
+		default:
+			return false, fmt.Errorf("unknown filter operator %q", cond.Op)
+		}
+	}
+	if q.IDs != nil && !slices.Contains(q.IDs, b.ID) {
+		return false, nil
+	}
+	if q.Author != "" && !strings.EqualFold(b.BookAuthor, q.Author) {
+		return false, nil
+	}
+	if q.Year != "" && b.BookYear != q.Year {
+		return false, nil
+	}
+	return (b.DeletedAt != nil) == q.Deleted, nil
+}
+
+// compareValues orders field values like the numeric collation of the
+// MongoDB store: integers by value, everything else ignoring case
+func compareValues(a, b string) int {
+	if x, err := strconv.Atoi(a); err == nil {
+		if y, err := strconv.Atoi(b); err == nil {
+			return cmp.Compare(x, y)
+		}
+	}
+	return cmp.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// capResults truncates books to MaxResults
+func (m *Memory) capResults(books []models.BookStore) []models.BookStore {
+	if int64(len(books)) > m.MaxResults {
+		slog.Warn("query returned too many books, results were truncated", "max_results", m.MaxResults)
+		return books[:m.MaxResults]
+	}
+	return books
+}
+
+// matching returns the books matching q in its order. The caller holds mu.
+func (m *Memory) matching(q BookQuery) ([]models.BookStore, error) {
+	matched := []models.BookStore{}
+	for _, b := range m.books {
+		ok, err := q.matches(b)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, b)
+		}
+	}
+	if q.Sort == SortCreated {
+		// Books are kept in the order they were created.
+		if q.Desc {
+			slices.Reverse(matched)
+		}
+	} else if q.Sort != "" {
+		if _, ok := storedFields[q.Sort]; !ok {
+			return nil, fmt.Errorf("cannot sort by %q", q.Sort)
+		}
+		// A stable sort keeps insertion order for equal values, like _id does.
+		slices.SortStableFunc(matched, func(a, b models.BookStore) int {
+			c := compareValues(bookField(a, q.Sort), bookField(b, q.Sort))
+			if q.Desc {
+				return -c
+			}
+			return c
+		})
+	}
+	return matched, nil
+}
+
+// ListBooks runs q. For paginated queries the total number of matches is
+// returned as well; otherwise it is 0.
+func (m *Memory) ListBooks(ctx context.Context, q BookQuery) ([]models.BookStore, int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	matched, err := m.matching(q)
+	if err != nil {
+		return nil, 0, err
+	}
+	if q.Page == 0 {
+		return m.capResults(matched), 0, nil
+	}
+	total := int64(len(matched))
+	start := min((q.Page-1)*q.Limit, total)
+	end := min(start+q.Limit, total)
+	return m.capResults(matched[start:end]), total, nil
+}
+
+// EachBook calls fn with every book matching q, in insertion order unless
+// q sorts them. Pagination and MaxResults do not apply. The books are those
+// stored when it was called; it stops at the first error of fn.
+func (m *Memory) EachBook(ctx context.Context, q BookQuery, fn func(models.BookStore) error) error {
+	m.mu.RLock()
+	matched, err := m.matching(q)
+	m.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	for _, b := range matched {
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexOf returns the position of the book with the given ID, or -1. Books
+// in the trash are found as well, since they keep their ID.
+func (m *Memory) indexOf(id string) int {
+	return slices.IndexFunc(m.books, func(b models.BookStore) bool { return b.ID == id })
+}
+
+// liveIndexOf returns the position of the book with the given ID unless it
+// is in the trash, or -1
+func (m *Memory) liveIndexOf(id string) int {
+	i := m.indexOf(id)
+	if i >= 0 && m.books[i].DeletedAt != nil {
+		return -1
+	}
+	return i
+}
+
+// liveBooks returns the books outside the trash
+func (m *Memory) liveBooks() []models.BookStore {
+	return slices.DeleteFunc(slices.Clone(m.books), func(b models.BookStore) bool { return b.DeletedAt != nil })
+}
+
+// GetBook returns the book with the given ID, or ErrNotFound
+func (m *Memory) GetBook(ctx context.Context, id string) (models.BookStore, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i := m.liveIndexOf(id)
+	if i < 0 {
+		return models.BookStore{}, ErrNotFound
+	}
+	return m.books[i], nil
+}
+
+// BookExists reports whether a book with the given ID is stored and not in
+// the trash
+func (m *Memory) BookExists(ctx context.Context, id string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.liveIndexOf(id) >= 0, nil
+}
+
+// CountBooks returns the number of stored books outside the trash
+func (m *Memory) CountBooks(ctx context.Context) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return int64(len(m.liveBooks())), nil
+}
+
+// CreateBook stores a new book. ErrDuplicate is returned if its ID is taken,
+// also by a book in the trash.
+func (m *Memory) CreateBook(ctx context.Context, book models.BookStore) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.indexOf(book.ID) >= 0 {
+		return ErrDuplicate
+	}
+	now := time.Now().UTC()
+	book.MongoID = primitive.NewObjectID()
+	book.Revision, book.CreatedAt = 1, &now
+	m.books = append(m.books, book)
+	m.notify(BookEvent{OpInsert, book})
+	return nil
+}
+
+// CreateBooks stores each of books, see CreateBook
+func (m *Memory) CreateBooks(ctx context.Context, books []models.BookStore) ([]error, error) {
+	errs := make([]error, len(books))
+	for i, book := range books {
+		errs[i] = m.CreateBook(ctx, book)
+	}
+	return errs, nil
+}
+
+// UpsertBooks stores each of books whose ID is not taken, see CreateBook
+func (m *Memory) UpsertBooks(ctx context.Context, books []models.BookStore) (int64, error) {
+	var stored int64
+	for _, book := range books {
+		err := m.CreateBook(ctx, book)
+		if errors.Is(err, ErrDuplicate) {
+			continue
+		}
+		if err != nil {
+			return stored, err
+		}
+		stored++
+	}
+	return stored, nil
+}
+
+// UpdateBook sets the given fields, keyed by API field name, on the book with
+// the given ID and returns the updated book, or ErrNotFound, also for books
+// in the trash. Changing the ID to one that is taken returns ErrDuplicate. If
+// revision is not 0 and the book is at another revision, ErrConflict is
+// returned.
+func (m *Memory) UpdateBook(ctx context.Context, id string, revision int64, fields map[string]string) (models.BookStore, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.liveIndexOf(id)
+	if i < 0 {
+		return models.BookStore{}, ErrNotFound
+	}
+	if revision != 0 && m.books[i].Revision != revision {
+		return models.BookStore{}, ErrConflict
+	}
+	book := m.books[i]
+	book.Revision++
+	for name, value := range fields {
+		if err := setBookField(&book, name, value); err != nil {
+			return models.BookStore{}, err
+		}
+	}
+	if book.ID != id && m.indexOf(book.ID) >= 0 {
+		return models.BookStore{}, ErrDuplicate
+	}
+	m.books[i] = book
+	m.notify(BookEvent{OpUpdate, book})
+	return book, nil
+}
+
+// UpdateBooks sets fields on the books matching q and returns the number of
+// matches and the changed books. Books already holding the values keep
+// their revision.
+func (m *Memory) UpdateBooks(ctx context.Context, q BookQuery, fields map[string]string) (int64, []models.BookStore, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var matched int64
+	var changed []int
+	for i, b := range m.books {
+		ok, err := q.matches(b)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !ok {
+			continue
+		}
+		matched++
+		for name, value := range fields {
+			if _, known := storedFields[name]; !known {
+				return 0, nil, fmt.Errorf("unknown field %q", name)
+			}
+			if bookField(b, name) != value {
+				changed = append(changed, i)
+				break
+			}
+		}
+	}
+	updated := make([]models.BookStore, 0, len(changed))
+	for _, i := range changed {
+		book := m.books[i]
+		book.Revision++
+		for name, value := range fields {
+			if err := setBookField(&book, name, value); err != nil {
+				return 0, nil, err
+			}
+		}
+		updated = append(updated, book)
+	}
+	if id, ok := fields["id"]; ok && len(changed) > 0 {
+		// Every changed book would get the same ID.
+		if i := m.indexOf(id); len(changed) > 1 || (i >= 0 && i != changed[0]) {
+			return 0, nil, ErrDuplicate
+		}
+	}
+	for j, i := range changed {
+		m.books[i] = updated[j]
+		m.notify(BookEvent{OpUpdate, updated[j]})
+	}
+	return matched, updated, nil
+}
+
+// DeleteBooks moves the books matching q to the trash and returns them. The
+// order and pagination of q are ignored.
+func (m *Memory) DeleteBooks(ctx context.Context, q BookQuery) ([]models.BookStore, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var matched []int
+	for i, b := range m.books {
+		ok, err := q.matches(b)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, i)
+		}
+	}
+	now := time.Now().UTC()
+	deleted := make([]models.BookStore, 0, len(matched))
+	for _, i := range matched {
+		m.books[i].DeletedAt = &now
+		deleted = append(deleted, m.books[i])
+		m.notify(BookEvent{OpDelete, m.books[i]})
+	}
+	return deleted, nil
+}
+
+// PurgeBooks removes the books in the trash matching q and returns them.
+// The order and pagination of q are ignored.
+func (m *Memory) PurgeBooks(ctx context.Context, q BookQuery) ([]models.BookStore, error) {
+	q.Deleted = true
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	purged := []models.BookStore{}
+	kept := m.books[:0]
+	for _, b := range m.books {
+		ok, err := q.matches(b)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			purged = append(purged, b)
+			if b.Cover != nil {
+				m.deleteCover(*b.Cover)
+			}
+		} else {
+			kept = append(kept, b)
+		}
+	}
+	m.books = kept
+	return purged, nil
+}
+
+// SetCover keeps data and its thumbnails as the cover of the book,
+// replacing the previous one
+func (m *Memory) SetCover(ctx context.Context, id string, cover models.Cover, data []byte, thumbnails map[string][]byte) (models.BookStore, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.liveIndexOf(id)
+	if i < 0 {
+		return models.BookStore{}, ErrNotFound
+	}
+	if old := m.books[i].Cover; old != nil {
+		m.deleteCover(*old)
+	}
+	cover.FileID = primitive.NewObjectID().Hex()
+	m.covers[cover.FileID] = slices.Clone(data)
+	for size, thumbnail := range thumbnails {
+		m.covers[cover.ThumbnailID(size)] = slices.Clone(thumbnail)
+	}
+	m.books[i].Cover = &cover
+	m.notify(BookEvent{OpUpdate, m.books[i]})
+	return m.books[i], nil
+}
+
+// OpenCover returns the cover of the book in size and its image
+func (m *Memory) OpenCover(ctx context.Context, id, size string) (models.Cover, io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i := m.liveIndexOf(id)
+	if i < 0 || m.books[i].Cover == nil {
+		return models.Cover{}, nil, ErrNotFound
+	}
+	cover := *m.books[i].Cover
+	if thumbnail, ok := m.covers[cover.ThumbnailID(size)]; ok && size != "" {
+		cover = models.Cover{FileID: cover.ThumbnailID(size), ContentType: models.ThumbnailType, Size: int64(len(thumbnail)), UploadedAt: cover.UploadedAt}
+	}
+	return cover, io.NopCloser(bytes.NewReader(m.covers[cover.FileID])), nil
+}
+
+// deleteCover drops the image of the cover and its thumbnails; m.mu must
+// be held
+func (m *Memory) deleteCover(cover models.Cover) {
+	delete(m.covers, cover.FileID)
+	for size := range models.CoverSizes {
+		delete(m.covers, cover.ThumbnailID(size))
+	}
+}
+
+// DeleteBook moves the book with the given ID to the trash, or returns
+// ErrNotFound
+func (m *Memory) DeleteBook(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.liveIndexOf(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	m.books[i].DeletedAt = &now
+	m.notify(BookEvent{OpDelete, m.books[i]})
+	return nil
+}
+
+// RestoreBook takes the book with the given ID out of the trash and returns
+// it, or ErrNotFound if it is not in the trash
+func (m *Memory) RestoreBook(ctx context.Context, id string) (models.BookStore, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.indexOf(id)
+	if i < 0 || m.books[i].DeletedAt == nil {
+		return models.BookStore{}, ErrNotFound
+	}
+	m.books[i].DeletedAt = nil
+	m.notify(BookEvent{OpInsert, m.books[i]})
+	return m.books[i], nil
+}
+
+// TextSearch ranks books by the words of q they contain, see rankByText
+func (m *Memory) TextSearch(ctx context.Context, q string, limit int64) ([]ScoredBook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return rankByText(m.liveBooks(), q, limit), nil
+}
+
+// rankByText scores books by how many words of q occur in their title
+// (weighted 2) and author (weighted 1) and returns at most limit of the
+// matches, best first
+func rankByText(books []models.BookStore, q string, limit int64) []ScoredBook {
+	terms := strings.Fields(strings.ToLower(q))
+	results := []ScoredBook{}
+	for _, b := range books {
+		title := strings.Fields(strings.ToLower(b.BookName))
+		author := strings.Fields(strings.ToLower(b.BookAuthor))
+		var score float64
+		for _, term := range terms {
+			if slices.Contains(title, term) {
+				score += 2
+			}
+			if slices.Contains(author, term) {
+				score++
+			}
+		}
+		if score > 0 {
+			results = append(results, ScoredBook{b, score})
+		}
+	}
+	slices.SortStableFunc(results, func(a, b ScoredBook) int { return cmp.Compare(b.Score, a.Score) })
+	if int64(len(results)) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// SearchTitles returns the books whose title contains q, ignoring case
+func (m *Memory) SearchTitles(ctx context.Context, q string) ([]models.BookStore, error) {
+	books, _, err := m.ListBooks(ctx, BookQuery{Conditions: []Condition{{Field: "title", Op: "contains", Value: q}}})
+	return books, err
+}
+
+// FuzzySearch ranks titles by edit distance to q so that small typos
+// ("Frankenstien") still find the intended book.
+func (m *Memory) FuzzySearch(ctx context.Context, q string) ([]RankedBook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	books := m.liveBooks()
+	return rankByDistance(books[:min(len(books), fuzzyCandidateLimit)], q), nil
+}
+
+// rankByDistance returns the books whose title is at most fuzzyMaxDistance
+// edits away from q, closest first
+func rankByDistance(books []models.BookStore, q string) []RankedBook {
+	matches := []RankedBook{}
+	for _, book := range books {
+		if d := titleDistance(q, book.BookName); d <= fuzzyMaxDistance {
+			matches = append(matches, RankedBook{book, d})
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b RankedBook) int { return cmp.Compare(a.Distance, b.Distance) })
+	return matches
+}
+
+// BookStats computes the statistics of the catalog
+func (m *Memory) BookStats(ctx context.Context) (BookStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var stats BookStats
+	authors := map[string]bool{}
+	for _, b := range m.books {
+		if b.DeletedAt != nil {
+			stats.Trash++
+			continue
+		}
+		stats.Books++
+		authors[b.BookAuthor] = true
+		year, err := strconv.ParseInt(b.BookYear, 10, 64)
+		if err != nil {
+			continue
+		}
+		if stats.FirstYear == 0 && stats.LastYear == 0 || year < stats.FirstYear {
+			stats.FirstYear = year
+		}
+		if year > stats.LastYear {
+			stats.LastYear = year
+		}
+	}
+	stats.Authors = int64(len(authors))
+	return stats, nil
+}
+
+// BooksPerAuthor counts the books of each author
+func (m *Memory) BooksPerAuthor(ctx context.Context) ([]AuthorCount, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	counts := map[string]int64{}
+	for _, b := range m.liveBooks() {
+		if b.BookAuthor != "" {
+			counts[b.BookAuthor]++
+		}
+	}
+	ret := make([]AuthorCount, 0, len(counts))
+	for author, n := range counts {
+		ret = append(ret, AuthorCount{Author: author, Books: n})
+	}
+	slices.SortFunc(ret, func(a, b AuthorCount) int {
+		if a.Books != b.Books {
+			return cmp.Compare(b.Books, a.Books)
+		}
+		return strings.Compare(a.Author, b.Author)
+	})
+	return ret, nil
+}
+
+// BooksPerDecade counts the books of each decade
+func (m *Memory) BooksPerDecade(ctx context.Context) ([]DecadeCount, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	counts := map[int64]int64{}
+	for _, b := range m.liveBooks() {
+		if year, err := strconv.ParseInt(b.BookYear, 10, 64); err == nil && year >= 1 {
+			counts[year-year%10]++
+		}
+	}
+	ret := make([]DecadeCount, 0, len(counts))
+	for _, decade := range slices.Sorted(maps.Keys(counts)) {
+		ret = append(ret, DecadeCount{Decade: decade, Books: counts[decade]})
+	}
+	return ret, nil
+}
+
+// Distinct returns the sorted distinct non-empty values of a book field,
+// given by its API name
+func (m *Memory) Distinct(ctx context.Context, field string) ([]string, error) {
+	if _, ok := storedFields[field]; !ok {
+		return nil, fmt.Errorf("unknown field %q", field)
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ret := []string{}
+	for _, b := range m.liveBooks() {
+		if v := bookField(b, field); v != "" && !slices.Contains(ret, v) {
+			ret = append(ret, v)
+		}
+	}
+	slices.Sort(ret)
+	return ret, nil
+}
+
+// watchBuffer is how many events a slow watcher may fall behind before
+// further events are dropped for it
+const watchBuffer = 64
+
+// WatchBooks reports every insert, update and delete of this process until
+// ctx is done. Moving a book to the trash is reported as a delete and
+// restoring it as an insert.
+func (m *Memory) WatchBooks(ctx context.Context) (<-chan BookEvent, error) {
+	events := make(chan BookEvent, watchBuffer)
+	m.mu.Lock()
+	m.watchers[events] = struct{}{}
+	m.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		delete(m.watchers, events)
+		m.mu.Unlock()
+		close(events)
+	}()
+	return events, nil
+}
+
+// notify sends ev to all watchers; m.mu must be held
+func (m *Memory) notify(ev BookEvent) {
+	for w := range m.watchers {
+		select {
+		case w <- ev:
+		default:
+			slog.Warn("watcher is too slow, dropped event", "op", ev.Op, "book", ev.Book.ID)
+		}
+	}
+}
+
+// InsertAPIKey stores a new key and sets its ID
+func (m *Memory) InsertAPIKey(ctx context.Context, key *models.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if slices.ContainsFunc(m.keys, func(k models.APIKey) bool { return k.Hash == key.Hash }) {
+		return ErrDuplicate
+	}
+	key.ID = primitive.NewObjectID()
+	m.keys = append(m.keys, *key)
+	return nil
+}
+
+// ListAPIKeys returns all keys, revoked ones included, oldest first
+func (m *Memory) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := make([]models.APIKey, 0, len(m.keys))
+	for _, k := range m.keys {
+		k.Hash = ""
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey marks the key with the given ID as revoked, or returns
+// ErrNotFound if there is no such unrevoked key
+func (m *Memory) RevokeAPIKey(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, k := range m.keys {
+		if k.ID.Hex() == id && k.RevokedAt == nil {
+			now := time.Now().UTC()
+			m.keys[i].RevokedAt = &now
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// APIKeyByHash returns the unrevoked key with the given hash, or ErrNotFound
+func (m *Memory) APIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, k := range m.keys {
+		if k.Hash == hash && k.RevokedAt == nil {
+			return k, nil
+		}
+	}
+	return models.APIKey{}, ErrNotFound
+}
+
+// InsertUser stores a new user and sets its ID. ErrDuplicate is returned if
+// the username is taken.
+func (m *Memory) InsertUser(ctx context.Context, user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[user.Username]; ok {
+		return ErrDuplicate
+	}
+	user.ID = primitive.NewObjectID()
+	m.users[user.Username] = *user
+	return nil
+}
+
+// ListUsers returns all users ordered by username
+func (m *Memory) ListUsers(ctx context.Context) ([]models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	users := make([]models.User, 0, len(m.users))
+	for _, u := range m.users {
+		u.PasswordHash = ""
+		users = append(users, u)
+	}
+	slices.SortFunc(users, func(a, b models.User) int { return cmp.Compare(a.Username, b.Username) })
+	return users, nil
+}
+
+// FindUser returns the user with the given username, or ErrNotFound
+func (m *Memory) FindUser(ctx context.Context, username string) (models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.users[username]
+	if !ok {
+		return u, ErrNotFound
+	}
+	return u, nil
+}
+
+// UpdateUser assigns a new role and/or password hash to a user; empty values
+// are left unchanged. ErrNotFound is returned if there is no such user.
+func (m *Memory) UpdateUser(ctx context.Context, username, role, passwordHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+	if role != "" {
+		u.Role = role
+	}
+	if passwordHash != "" {
+		u.PasswordHash = passwordHash
+	}
+	m.users[username] = u
+	return nil
+}
+
+// DeleteUser removes a user, or returns ErrNotFound
+func (m *Memory) DeleteUser(ctx context.Context, username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[username]; !ok {
+		return ErrNotFound
+	}
+	delete(m.users, username)
+	return nil
+}
+
+// memTxKey marks the context of a running Memory transaction
+type memTxKey struct{}
+
+// InsertWebhook stores a new webhook and sets its ID
+func (m *Memory) InsertWebhook(ctx context.Context, hook *models.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hook.ID = primitive.NewObjectID()
+	m.webhooks = append(m.webhooks, *hook)
+	return nil
+}
+
+// ListWebhooks returns all webhooks with their secrets, oldest first
+func (m *Memory) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]models.Webhook{}, m.webhooks...), nil
+}
+
+// DeleteWebhook removes the webhook with the given ID, or returns ErrNotFound
+func (m *Memory) DeleteWebhook(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.IndexFunc(m.webhooks, func(h models.Webhook) bool { return h.ID.Hex() == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+	m.webhooks = slices.Delete(m.webhooks, i, i+1)
+	return nil
+}
+
+// InsertAuditEntry stores a new entry and sets its ID
+func (m *Memory) InsertAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry.ID = primitive.NewObjectID()
+	m.audit = append(m.audit, *entry)
+	return nil
+}
+
+// ListAuditEntries returns the entries matching q, newest first
+func (m *Memory) ListAuditEntries(ctx context.Context, q AuditQuery) ([]models.AuditEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entries := []models.AuditEntry{}
+	for i := len(m.audit) - 1; i >= 0 && int64(len(entries)) < q.Limit; i-- {
+		e := m.audit[i]
+		if (q.BookID != "" && e.BookID != q.BookID) ||
+			(!q.Since.IsZero() && e.Time.Before(q.Since)) ||
+			(!q.Until.IsZero() && !e.Time.Before(q.Until)) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// InsertBookVersion stores a previous version of a book and sets its ID.
+// ErrDuplicate is returned if the version is already stored.
+func (m *Memory) InsertBookVersion(ctx context.Context, v *models.BookVersion) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if slices.ContainsFunc(m.history, func(h models.BookVersion) bool { return h.BookID == v.BookID && h.Version == v.Version }) {
+		return ErrDuplicate
+	}
+	v.ID = primitive.NewObjectID()
+	m.history = append(m.history, *v)
+	return nil
+}
+
+// ListBookVersions returns the previous versions of a book, newest first
+func (m *Memory) ListBookVersions(ctx context.Context, bookID string) ([]models.BookVersion, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	versions := []models.BookVersion{}
+	for _, v := range m.history {
+		if v.BookID == bookID {
+			versions = append(versions, v)
+		}
+	}
+	slices.SortFunc(versions, func(a, b models.BookVersion) int { return cmp.Compare(b.Version, a.Version) })
+	return versions, nil
+}
+
+// GetBookVersion returns a previous version of a book or ErrNotFound
+func (m *Memory) GetBookVersion(ctx context.Context, bookID string, version int64) (models.BookVersion, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, v := range m.history {
+		if v.BookID == bookID && v.Version == version {
+			return v, nil
+		}
+	}
+	return models.BookVersion{}, ErrNotFound
+}
+
+// DeleteBookVersions removes the previous versions of the books with the
+// given IDs
+func (m *Memory) DeleteBookVersions(ctx context.Context, bookIDs []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.history = slices.DeleteFunc(m.history, func(v models.BookVersion) bool { return slices.Contains(bookIDs, v.BookID) })
+	return nil
+}
+
+// WithTransaction runs fn and restores the previous data if it fails.
+// Transactions run one at a time, but writes outside of them are not held
+// back and may be undone by a rollback. Called again from within fn, it
+// joins the running transaction.
+func (m *Memory) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(memTxKey{}) != nil {
+		return fn(ctx)
+	}
+	m.tx.Lock()
+	defer m.tx.Unlock()
+
+	m.mu.RLock()
+	books, keys, hooks, audit, history := slices.Clone(m.books), slices.Clone(m.keys), slices.Clone(m.webhooks), slices.Clone(m.audit), slices.Clone(m.history)
+	users, covers := maps.Clone(m.users), maps.Clone(m.covers)
+	m.mu.RUnlock()
+
+	if err := fn(context.WithValue(ctx, memTxKey{}, true)); err != nil {
+		m.mu.Lock()
+		m.books, m.keys, m.webhooks, m.audit, m.history, m.users, m.covers = books, keys, hooks, audit, history, users, covers
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// ClaimIdempotencyKey stores rec unless its key is taken; then the stored
+// record is returned with ErrDuplicate. Expired records are removed first.
+func (m *Memory) ClaimIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord) (models.IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, stored := range m.idemKeys {
+		if time.Since(stored.CreatedAt) >= IdempotencyTTL {
+			delete(m.idemKeys, key)
+		}
+	}
+	if stored, ok := m.idemKeys[rec.Key]; ok {
+		return stored, ErrDuplicate
+	}
+	m.idemKeys[rec.Key] = rec
+	return rec, nil
+}
+
+// CompleteIdempotencyKey stores the response to the claimed key
+func (m *Memory) CompleteIdempotencyKey(ctx context.Context, key string, status int, body []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rec, ok := m.idemKeys[key]; ok {
+		rec.Status, rec.Body = status, body
+		m.idemKeys[key] = rec
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey drops the claim of key
+func (m *Memory) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.idemKeys, key)
+	return nil
+}
+
+// EnsureTextIndex is a no-op; TextSearch scans all books
+func (m *Memory) EnsureTextIndex(ctx context.Context) error { return nil }
+
+// EnsureAuthIndexes is a no-op; uniqueness is checked on insert
+func (m *Memory) EnsureAuthIndexes(ctx context.Context) error { return nil }
+
+// Ping always succeeds
+func (m *Memory) Ping(ctx context.Context) error { return nil }
+
+// Close is a no-op; the data is dropped with the process
+func (m *Memory) Close(ctx context.Context) error { return nil }
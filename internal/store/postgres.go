@@ -0,0 +1,34 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the pgx driver
+)
+
+// postgres is the dialect of PostgreSQL
+var postgres = dialect{
+	name:      "PostgreSQL",
+	driver:    "pgx",
+	serial:    "BIGSERIAL PRIMARY KEY",
+	timestamp: "TIMESTAMPTZ",
+	blob:      "BYTEA",
+	numbered:  true,
+	asInt: func(col string) string {
+		return "(CASE WHEN " + col + " ~ '^[+-]{0,1}[0-9]+$' THEN " + col + "::numeric END)"
+	},
+	isDuplicate: func(err error) bool {
+		var pgErr *pgconn.PgError
+		return errors.As(err, &pgErr) && pgErr.Code == "23505" // unique_violation
+	},
+}
+
+// OpenPostgres connects to the PostgreSQL server at uri, pings it and
+// creates the tables that do not exist yet. A server that cannot be reached
+// is pinged again for up to retry.
+func OpenPostgres(ctx context.Context, uri string, retry time.Duration) (*SQLStore, error) {
+	return openSQL(ctx, postgres, uri, retry)
+}
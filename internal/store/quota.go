@@ -0,0 +1,18 @@
+package store
+
+import "context"
+
+// RemainingQuota returns how many more books st may hold when it is capped
+// at maxBooks, or -1 if maxBooks is 0 for no cap. The books are counted, not
+// reserved, so writers racing each other may together go a few books past
+// the cap.
+func RemainingQuota(ctx context.Context, st Repository, maxBooks int64) (int64, error) {
+	if maxBooks == 0 {
+		return -1, nil
+	}
+	count, err := st.CountBooks(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return max(maxBooks-count, 0), nil
+}
@@ -0,0 +1,220 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+)
+
+// BookRepository stores the books of the bookstore
+type BookRepository interface {
+	ListBooks(ctx context.Context, q BookQuery) ([]models.BookStore, int64, error)
+	// EachBook calls fn with every book matching q without loading them
+	// all at once, ignoring pagination and MaxResults, and stops at the
+	// first error of fn
+	EachBook(ctx context.Context, q BookQuery, fn func(models.BookStore) error) error
+	GetBook(ctx context.Context, id string) (models.BookStore, error)
+	BookExists(ctx context.Context, id string) (bool, error)
+	CountBooks(ctx context.Context) (int64, error)
+	CreateBook(ctx context.Context, book models.BookStore) error
+	// CreateBooks stores each of books independently and returns the error
+	// of each, nil for the stored ones. The second error is returned if the
+	// batch could not be written at all.
+	CreateBooks(ctx context.Context, books []models.BookStore) ([]error, error)
+	// UpsertBooks stores the books whose ID is not taken, in as few round
+	// trips as the backend allows, and returns how many it stored. It
+	// upserts keyed on ID without changing stored books, also those in the
+	// trash, so storing the same books again changes nothing.
+	UpsertBooks(ctx context.Context, books []models.BookStore) (int64, error)
+	// UpdateBook requires the book to be at revision unless revision is 0
+	UpdateBook(ctx context.Context, id string, revision int64, fields map[string]string) (models.BookStore, error)
+	// UpdateBooks sets fields on the books matching q that differ from
+	// them and returns the number of matches and the changed books
+	UpdateBooks(ctx context.Context, q BookQuery, fields map[string]string) (int64, []models.BookStore, error)
+	// DeleteBook moves the book to the trash
+	DeleteBook(ctx context.Context, id string) error
+	// DeleteBooks moves the books matching q to the trash and returns them
+	DeleteBooks(ctx context.Context, q BookQuery) ([]models.BookStore, error)
+	// RestoreBook takes the book out of the trash and returns it
+	RestoreBook(ctx context.Context, id string) (models.BookStore, error)
+	// PurgeBooks removes the books in the trash matching q for good, along
+	// with their covers, and returns them
+	PurgeBooks(ctx context.Context, q BookQuery) ([]models.BookStore, error)
+	// SetCover stores data as the cover image of the book, along with its
+	// thumbnails by size, points the book at it and removes the images it
+	// replaces. It returns the book, or ErrNotFound if it is not stored or
+	// in the trash.
+	SetCover(ctx context.Context, id string, cover models.Cover, data []byte, thumbnails map[string][]byte) (models.BookStore, error)
+	// OpenCover returns the cover image of the book in size, "" for the
+	// image as uploaded, and the cover describing it, or ErrNotFound if
+	// there is none. Covers without a thumbnail in size, uploaded before
+	// thumbnails were made, are returned as uploaded.
+	OpenCover(ctx context.Context, id, size string) (models.Cover, io.ReadCloser, error)
+	TextSearch(ctx context.Context, q string, limit int64) ([]ScoredBook, error)
+	SearchTitles(ctx context.Context, q string) ([]models.BookStore, error)
+	FuzzySearch(ctx context.Context, q string) ([]RankedBook, error)
+	Distinct(ctx context.Context, field string) ([]string, error)
+	// BookStats computes the statistics of the catalog in the database,
+	// without loading the books
+	BookStats(ctx context.Context) (BookStats, error)
+	BooksPerAuthor(ctx context.Context) ([]AuthorCount, error)
+	BooksPerDecade(ctx context.Context) ([]DecadeCount, error)
+	WatchBooks(ctx context.Context) (<-chan BookEvent, error)
+}
+
+// Operations reported by WatchBooks
+const (
+	OpInsert = "insert"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// BookEvent is a change of a stored book. For deletes, Book is only filled
+// in if the backend still knows the deleted book; MongoDB needs pre-images
+// enabled on the collection for that.
+type BookEvent struct {
+	Op   string
+	Book models.BookStore
+}
+
+// Repository is everything the services keep in storage: books, API keys,
+// users, webhooks, the audit log, book history and idempotency keys. It is
+// implemented by the MongoDB Store, by SQLStore and by Memory.
+type Repository interface {
+	BookRepository
+
+	InsertAPIKey(ctx context.Context, key *models.APIKey) error
+	ListAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string) error
+	APIKeyByHash(ctx context.Context, hash string) (models.APIKey, error)
+
+	InsertUser(ctx context.Context, user *models.User) error
+	ListUsers(ctx context.Context) ([]models.User, error)
+	FindUser(ctx context.Context, username string) (models.User, error)
+	UpdateUser(ctx context.Context, username, role, passwordHash string) error
+	DeleteUser(ctx context.Context, username string) error
+
+	InsertWebhook(ctx context.Context, hook *models.Webhook) error
+	ListWebhooks(ctx context.Context) ([]models.Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) error
+
+	InsertAuditEntry(ctx context.Context, entry *models.AuditEntry) error
+	ListAuditEntries(ctx context.Context, q AuditQuery) ([]models.AuditEntry, error)
+
+	// InsertBookVersion returns ErrDuplicate if the version is already stored
+	InsertBookVersion(ctx context.Context, v *models.BookVersion) error
+	// ListBookVersions returns the previous versions of a book, newest first
+	ListBookVersions(ctx context.Context, bookID string) ([]models.BookVersion, error)
+	GetBookVersion(ctx context.Context, bookID string, version int64) (models.BookVersion, error)
+	DeleteBookVersions(ctx context.Context, bookIDs []string) error
+
+	// ClaimIdempotencyKey stores rec unless its key is already taken; then
+	// the stored record is returned with ErrDuplicate. Records expire after
+	// IdempotencyTTL.
+	ClaimIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord) (models.IdempotencyRecord, error)
+	// CompleteIdempotencyKey stores the response to the claimed key
+	CompleteIdempotencyKey(ctx context.Context, key string, status int, body []byte) error
+	// ReleaseIdempotencyKey drops the key so that the request can be retried
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+
+	// WithTransaction runs fn so that the writes made with the context it
+	// passes either all happen or none. Use it for every operation that
+	// writes more than one document.
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+	EnsureTextIndex(ctx context.Context) error
+	EnsureAuthIndexes(ctx context.Context) error
+	// Ping reports whether the database can be reached
+	Ping(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+var (
+	_ Repository = (*Store)(nil)
+	_ Repository = (*SQLStore)(nil)
+	_ Repository = (*Memory)(nil)
+)
+
+// Storage backends selectable with STORAGE_BACKEND
+const (
+	BackendMongo    = "mongo"
+	BackendPostgres = "postgres"
+	BackendSQLite   = "sqlite"
+	BackendMemory   = "memory"
+)
+
+// Config selects and configures the storage backend
+type Config struct {
+	Backend    string // one of the Backend constants; "" picks it by the scheme of URI
+	URI        string // connection string of the backend, or the file of SQLite
+	Database   string // database of MongoDB; "" is DefaultDatabase
+	Collection string // collection of the books in MongoDB; "" is DefaultCollection
+	MaxResults int64  // caps how many books a listing returns; 0 keeps the default
+	// ConnectRetry is how long to keep retrying a database server that
+	// cannot be reached yet; 0 fails at the first attempt
+	ConnectRetry time.Duration
+}
+
+// backendForURI returns the backend serving connection strings like uri
+func backendForURI(uri string) string {
+	if strings.HasPrefix(uri, "postgres://") || strings.HasPrefix(uri, "postgresql://") {
+		return BackendPostgres
+	}
+	return BackendMongo
+}
+
+// New opens the backend described by conf. ctx bounds the whole setup,
+// including the retries of ConnectRetry.
+func New(ctx context.Context, conf Config) (Repository, error) {
+	if conf.Backend == "" {
+		conf.Backend = backendForURI(conf.URI)
+	}
+	switch conf.Backend {
+	case BackendMongo:
+		if conf.Database == "" {
+			conf.Database = DefaultDatabase
+		}
+		if conf.Collection == "" {
+			conf.Collection = DefaultCollection
+		}
+		st, err := Open(ctx, conf)
+		if err != nil {
+			return nil, err
+		}
+		if conf.MaxResults > 0 {
+			st.MaxResults = conf.MaxResults
+		}
+		return st, nil
+	case BackendPostgres:
+		st, err := OpenPostgres(ctx, conf.URI, conf.ConnectRetry)
+		if err != nil {
+			return nil, err
+		}
+		if conf.MaxResults > 0 {
+			st.MaxResults = conf.MaxResults
+		}
+		return st, nil
+	case BackendSQLite:
+		st, err := OpenSQLite(ctx, conf.URI)
+		if err != nil {
+			return nil, err
+		}
+		if conf.MaxResults > 0 {
+			st.MaxResults = conf.MaxResults
+		}
+		return st, nil
+	case BackendMemory:
+		slog.Warn("using the in-memory storage backend, data is lost on restart and not shared between services")
+		m := NewMemory()
+		if conf.MaxResults > 0 {
+			m.MaxResults = conf.MaxResults
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q, use %s, %s, %s or %s", conf.Backend, BackendMongo, BackendPostgres, BackendSQLite, BackendMemory)
+	}
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+)
+
+// testBooks are stored by the tests, with authors of different cases
+var testBooks = []models.BookStore{
+	{ID: "1", BookName: "Frankenstein", BookAuthor: "Mary Shelley", BookYear: "1818"},
+	{ID: "2", BookName: "The Last Man", BookAuthor: "mary shelley", BookYear: "1826"},
+	{ID: "3", BookName: "The Raven", BookAuthor: "Edgar Allan Poe", BookYear: "1845"},
+}
+
+// forEachBackend runs test on an empty store of every backend that needs
+// no server: the in-memory store and SQLite
+func forEachBackend(t *testing.T, test func(t *testing.T, st Repository)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemory())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		st, err := OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "books.db"))
+		if err != nil {
+			t.Fatalf("OpenSQLite: %v", err)
+		}
+		t.Cleanup(func() { st.Close(context.Background()) })
+		test(t, st)
+	})
+}
+
+// storeBooks stores books in st
+func storeBooks(t *testing.T, st Repository, books []models.BookStore) {
+	t.Helper()
+	for _, book := range books {
+		if err := st.CreateBook(context.Background(), book); err != nil {
+			t.Fatalf("CreateBook(%s): %v", book.ID, err)
+		}
+	}
+}
+
+// bookIDs returns the IDs of books in their order
+func bookIDs(books []models.BookStore) []string {
+	ids := make([]string, 0, len(books))
+	for _, book := range books {
+		ids = append(ids, book.ID)
+	}
+	return ids
+}
+
+func TestAuthorFilterIgnoresCase(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, st Repository) {
+		storeBooks(t, st, testBooks)
+		for _, author := range []string{"Mary Shelley", "mary shelley", "MARY SHELLEY", "mARY sHELLEY"} {
+			books, _, err := st.ListBooks(context.Background(), BookQuery{Author: author, Sort: "year"})
+			if err != nil {
+				t.Fatalf("ListBooks(%q): %v", author, err)
+			}
+			if ids := bookIDs(books); len(ids) != 2 || ids[0] != "1" || ids[1] != "2" {
+				t.Errorf("books of %q = %v, want [1 2]", author, ids)
+			}
+		}
+		// The author must match as a whole.
+		books, _, err := st.ListBooks(context.Background(), BookQuery{Author: "shelley"})
+		if err != nil {
+			t.Fatalf("ListBooks: %v", err)
+		}
+		if len(books) != 0 {
+			t.Errorf("books of %q = %v, want none", "shelley", bookIDs(books))
+		}
+	})
+}
+
+func TestListingStopsAtMaxResults(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, st Repository) {
+		switch st := st.(type) {
+		case *Memory:
+			st.MaxResults = 2
+		case *SQLStore:
+			st.MaxResults = 2
+		}
+		storeBooks(t, st, testBooks)
+		books, _, err := st.ListBooks(context.Background(), BookQuery{Sort: "year"})
+		if err != nil {
+			t.Fatalf("ListBooks: %v", err)
+		}
+		if ids := bookIDs(books); len(ids) != 2 || ids[0] != "1" || ids[1] != "2" {
+			t.Errorf("books = %v, want the first two, [1 2]", ids)
+		}
+	})
+}
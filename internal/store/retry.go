@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	// DefaultConnectRetry is how long the services wait for their database
+	// to come up unless configured otherwise
+	DefaultConnectRetry = 30 * time.Second
+	// firstRetryDelay doubles after every failed attempt up to maxRetryDelay
+	firstRetryDelay = 500 * time.Millisecond
+	maxRetryDelay   = 8 * time.Second
+	// connectAttemptTimeout bounds a single attempt, so that a server that
+	// does not answer is asked again instead of waited for
+	connectAttemptTimeout = 5 * time.Second
+)
+
+// retryConnect calls ping until it succeeds, waiting longer after every
+// failure. It gives up with the last error once retrying would exceed window
+// or ctx ends; a window of 0 tries once.
+func retryConnect(ctx context.Context, name string, window time.Duration, ping func(ctx context.Context) error) error {
+	if window <= 0 {
+		return ping(ctx)
+	}
+	deadline := time.Now().Add(window)
+	delay := firstRetryDelay
+	for {
+		attemptCtx, cancel := context.WithTimeout(ctx, connectAttemptTimeout)
+		err := ping(attemptCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return err
+		}
+		slog.Warn("cannot reach "+name+" yet", "retry_in", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxRetryDelay)
+	}
+}
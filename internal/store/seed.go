@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+// ExampleBooks are the books a new bookstore starts with
+var ExampleBooks = []models.BookStore{
+	{ID: "example1", BookName: "The Vortex", BookAuthor: "José Eustasio Rivera", BookEdition: "958-30-0804-4", BookPages: "292", BookYear: "1924"},
+	{ID: "example2", BookName: "Frankenstein", BookAuthor: "Mary Shelley", BookEdition: "978-3-649-64609-9", BookPages: "280", BookYear: "1818"},
+	{ID: "example3", BookName: "The Black Cat", BookAuthor: "Edgar Allan Poe", BookEdition: "978-3-99168-238-7", BookPages: "280", BookYear: "1843"},
+}
+
+// seedBook is a book of a seed file, with the fields named as in the API
+type seedBook struct {
+	ID      string `json:"id" yaml:"id"`
+	Title   string `json:"title" yaml:"title"`
+	Author  string `json:"author" yaml:"author"`
+	Edition string `json:"edition" yaml:"edition"`
+	Pages   string `json:"pages" yaml:"pages"`
+	Year    string `json:"year" yaml:"year"`
+}
+
+// ReadSeedFile reads the books in the file at path, a list of books like
+// those POST /api/v1/books/import takes, in YAML if the file ends in .yaml
+// or .yml and in JSON otherwise. Every book must be valid.
+func ReadSeedFile(path string) ([]models.BookStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var records []seedBook
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &records)
+	default:
+		err = json.Unmarshal(data, &records)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	books := make([]models.BookStore, 0, len(records))
+	for i, r := range records {
+		book := models.BookStore{ID: r.ID, BookName: r.Title, BookAuthor: r.Author, BookEdition: r.Edition, BookPages: r.Pages, BookYear: r.Year}
+		if errs := book.Validate(); len(errs) > 0 {
+			return nil, fmt.Errorf("%s: book %d (%q): %s", path, i, r.ID, models.DescribeProblems(errs))
+		}
+		books = append(books, book)
+	}
+	return books, nil
+}
+
+// SeedBooks stores those of books that are not stored yet with one bulk
+// upsert, see UpsertBooks, so that it can run on every start
+func SeedBooks(ctx context.Context, r BookRepository, books []models.BookStore) error {
+	n, err := r.UpsertBooks(ctx, books)
+	if err != nil {
+		return err
+	}
+	slog.Info("seeded books", "stored", n, "already_stored", int64(len(books))-n)
+	return nil
+}
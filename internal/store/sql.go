@@ -0,0 +1,1269 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// dialect holds what differs between the SQL databases SQLStore runs on
+type dialect struct {
+	name   string
+	driver string // database/sql driver name
+	// serial is the column definition of an auto-incrementing primary key
+	serial string
+	// timestamp is the column type of points in time
+	timestamp string
+	// blob is the column type of binary data
+	blob string
+	// numbered reports whether placeholders are numbered ($1, $2, ...)
+	// instead of question marks
+	numbered bool
+	// asInt returns an expression converting the text column col to an
+	// integer, or NULL if it does not hold one
+	asInt func(col string) string
+	// isDuplicate reports whether err comes from a violated unique constraint
+	isDuplicate func(err error) bool
+}
+
+// sqlColumns maps the API field names of a book to its table columns
+var sqlColumns = map[string]string{
+	"id":      "id",
+	"title":   "title",
+	"author":  "author",
+	"pages":   "pages",
+	"edition": "edition",
+	"year":    "year",
+}
+
+const bookColumns = "oid, id, title, author, edition, pages, year, revision, deleted_at, created_at, cover_id, cover_type, cover_size, cover_uploaded_at"
+
+// SQLStore keeps the bookstore in a SQL database. Books are stored in
+// insertion order, which the seq column preserves.
+type SQLStore struct {
+	db *sql.DB
+	d  dialect
+
+	// MaxResults caps how many books a listing returns.
+	MaxResults int64
+}
+
+// openSQL connects to the database at dsn, pings it for up to retry and
+// creates the tables that do not exist yet
+func openSQL(ctx context.Context, d dialect, dsn string, retry time.Duration) (*SQLStore, error) {
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := retryConnect(ctx, d.name, retry, db.PingContext); err != nil {
+		db.Close()
+		return nil, err
+	}
+	slog.Info("connected to " + d.name)
+
+	s := &SQLStore{db: db, d: d, MaxResults: 10000}
+	if err := s.createTables(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// createTables creates the tables of the bookstore unless they exist
+func (s *SQLStore) createTables(ctx context.Context) error {
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS books (
+			seq ` + s.d.serial + `,
+			oid TEXT NOT NULL,
+			id TEXT NOT NULL,
+			title TEXT NOT NULL,
+			author TEXT NOT NULL,
+			edition TEXT NOT NULL,
+			pages TEXT NOT NULL,
+			year TEXT NOT NULL,
+			revision INTEGER NOT NULL DEFAULT 1,
+			deleted_at ` + s.d.timestamp + `,
+			created_at ` + s.d.timestamp + `,
+			cover_id TEXT,
+			cover_type TEXT,
+			cover_size BIGINT,
+			cover_uploaded_at ` + s.d.timestamp + `
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS books_id ON books (id)`,
+		`CREATE TABLE IF NOT EXISTS api_keys (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			role TEXT NOT NULL,
+			prefix TEXT NOT NULL,
+			hash TEXT NOT NULL UNIQUE,
+			created_at ` + s.d.timestamp + ` NOT NULL,
+			revoked_at ` + s.d.timestamp + `
+		)`,
+		`CREATE TABLE IF NOT EXISTS users (
+			id TEXT PRIMARY KEY,
+			username TEXT NOT NULL UNIQUE,
+			password_hash TEXT NOT NULL,
+			role TEXT NOT NULL,
+			created_at ` + s.d.timestamp + ` NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS webhooks (
+			id TEXT PRIMARY KEY,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			created_at ` + s.d.timestamp + ` NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS audit (
+			id TEXT PRIMARY KEY,
+			book_id TEXT NOT NULL,
+			action TEXT NOT NULL,
+			actor TEXT NOT NULL,
+			route TEXT NOT NULL,
+			client_ip TEXT NOT NULL DEFAULT '',
+			request_id TEXT NOT NULL,
+			time ` + s.d.timestamp + ` NOT NULL,
+			before_values TEXT NOT NULL,
+			after_values TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS audit_book_time ON audit (book_id, time)`,
+		`CREATE TABLE IF NOT EXISTS book_history (
+			id TEXT PRIMARY KEY,
+			book_id TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			title TEXT NOT NULL,
+			author TEXT NOT NULL,
+			pages TEXT NOT NULL,
+			edition TEXT NOT NULL,
+			year TEXT NOT NULL,
+			replaced_at ` + s.d.timestamp + ` NOT NULL
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS book_history_version ON book_history (book_id, version)`,
+		`CREATE TABLE IF NOT EXISTS book_covers (
+			id TEXT PRIMARY KEY,
+			book_id TEXT NOT NULL,
+			data ` + s.d.blob + ` NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS book_covers_book ON book_covers (book_id)`,
+		`CREATE TABLE IF NOT EXISTS idempotency_keys (
+			id TEXT PRIMARY KEY,
+			fingerprint TEXT NOT NULL,
+			status INTEGER NOT NULL,
+			body TEXT NOT NULL,
+			created_at ` + s.d.timestamp + ` NOT NULL
+		)`,
+	} {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			slog.Error("cannot create table", "error", err)
+			return err
+		}
+	}
+	return s.addColumns(ctx)
+}
+
+// addColumns adds the columns introduced after the tables were first
+// created to tables that lack them
+func (s *SQLStore) addColumns(ctx context.Context) error {
+	for _, col := range []struct{ table, name, definition string }{
+		{"books", "revision", "INTEGER NOT NULL DEFAULT 1"},
+		{"books", "deleted_at", s.d.timestamp},
+		{"books", "created_at", s.d.timestamp},
+		{"books", "cover_id", "TEXT"},
+		{"books", "cover_type", "TEXT"},
+		{"books", "cover_size", "BIGINT"},
+		{"books", "cover_uploaded_at", s.d.timestamp},
+		{"audit", "client_ip", "TEXT NOT NULL DEFAULT ''"},
+	} {
+		if s.hasColumn(ctx, col.table, col.name) {
+			continue
+		}
+		_, err := s.db.ExecContext(ctx, "ALTER TABLE "+col.table+" ADD COLUMN "+col.name+" "+col.definition)
+		// Another service may have added the column in the meantime.
+		if err != nil && !s.hasColumn(ctx, col.table, col.name) {
+			slog.Error("cannot add column", "table", col.table, "column", col.name, "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// hasColumn reports whether table has the column name
+func (s *SQLStore) hasColumn(ctx context.Context, table, name string) bool {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+name+" FROM "+table+" WHERE 1 = 0")
+	if err != nil {
+		return false
+	}
+	rows.Close()
+	return true
+}
+
+// Ping reports whether the database can be reached
+func (s *SQLStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the database
+func (s *SQLStore) Close(ctx context.Context) error {
+	return s.db.Close()
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// txKey is the context key of the transaction started by WithTransaction
+type txKey struct{}
+
+// conn returns the transaction ctx runs in, or the database
+func (s *SQLStore) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return s.db
+}
+
+// rebind rewrites the question mark placeholders of query for the dialect
+func (s *SQLStore) rebind(query string) string {
+	if !s.d.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *SQLStore) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.conn(ctx).ExecContext(ctx, s.rebind(query), args...)
+}
+
+func (s *SQLStore) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.conn(ctx).QueryContext(ctx, s.rebind(query), args...)
+}
+
+func (s *SQLStore) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.conn(ctx).QueryRowContext(ctx, s.rebind(query), args...)
+}
+
+// WithTransaction runs fn inside a transaction. SQLStore methods called with
+// the context passed to fn take part in it, so either all of their writes are
+// committed or none. Called again from within fn, it joins the running
+// transaction.
+func (s *SQLStore) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanBook reads a row selected with bookColumns
+func scanBook(row scanner) (models.BookStore, error) {
+	var b models.BookStore
+	var oid string
+	var deleted, created, coverUploaded sql.NullTime
+	var coverID, coverType sql.NullString
+	var coverSize sql.NullInt64
+	if err := row.Scan(&oid, &b.ID, &b.BookName, &b.BookAuthor, &b.BookEdition, &b.BookPages, &b.BookYear, &b.Revision, &deleted, &created,
+		&coverID, &coverType, &coverSize, &coverUploaded); err != nil {
+		return b, err
+	}
+	b.MongoID, _ = primitive.ObjectIDFromHex(oid)
+	if deleted.Valid {
+		b.DeletedAt = &deleted.Time
+	}
+	if created.Valid {
+		b.CreatedAt = &created.Time
+	}
+	if coverID.Valid {
+		b.Cover = &models.Cover{FileID: coverID.String, ContentType: coverType.String, Size: coverSize.Int64, UploadedAt: coverUploaded.Time}
+	}
+	return b, nil
+}
+
+// queryBooks runs a query selecting bookColumns
+func (s *SQLStore) queryBooks(ctx context.Context, query string, args ...any) ([]models.BookStore, error) {
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	books := []models.BookStore{}
+	for rows.Next() {
+		b, err := scanBook(rows)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, b)
+	}
+	return books, rows.Err()
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// where translates the conditions of q into a WHERE clause and its arguments
+func (s *SQLStore) where(q BookQuery) (string, []any, error) {
+	var conds []string
+	var args []any
+	for _, cond := range q.Conditions {
+		col, ok := sqlColumns[cond.Field]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown filter field %q", cond.Field)
+		}
+		switch cond.Op {
+		case "eq":
+			conds = append(conds, col+" = ?")
+			args = append(args, cond.Value)
+		case "contains":
+			conds = append(conds, "LOWER("+col+`) LIKE ? ESCAPE '\'`)
+			args = append(args, "%"+likeEscaper.Replace(strings.ToLower(cond.Value))+"%")
+		case "gte", "lte":
+			n, err := strconv.Atoi(cond.Value)
+			if err != nil || !models.NumericFields[cond.Field] {
+				return "", nil, fmt.Errorf("cannot compare %s %s %q", cond.Field, cond.Op, cond.Value)
+			}
+			// Unparsable stored values convert to NULL and never match.
+			op := ">="
+			if cond.Op == "lte" {
+				op = "<="
+			}
+			conds = append(conds, s.d.asInt(col)+" "+op+" ?")
+			args = append(args, n)
+		default:
+			return "", nil, fmt.Errorf("unknown filter operator %q", cond.Op)
+		}
+	}
+	if q.IDs != nil {
+		if len(q.IDs) == 0 {
+			conds = append(conds, "1 = 0")
+		} else {
+			conds = append(conds, "id IN (?"+strings.Repeat(", ?", len(q.IDs)-1)+")")
+			for _, id := range q.IDs {
+				args = append(args, id)
+			}
+		}
+	}
+	if q.Author != "" {
+		conds = append(conds, "LOWER(author) = LOWER(?)")
+		args = append(args, q.Author)
+	}
+	if q.Year != "" {
+		conds = append(conds, "year = ?")
+		args = append(args, q.Year)
+	}
+	if q.Deleted {
+		conds = append(conds, "deleted_at IS NOT NULL")
+	} else {
+		conds = append(conds, "deleted_at IS NULL")
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args, nil
+}
+
+// orderBy translates the order of q into an ORDER BY clause
+func (s *SQLStore) orderBy(q BookQuery) (string, error) {
+	dir := " ASC"
+	if q.Desc {
+		dir = " DESC"
+	}
+	switch q.Sort {
+	case "":
+		return " ORDER BY seq", nil
+	case SortCreated:
+		// Books without created_at sort as the oldest, in insertion order;
+		// the databases disagree on where NULL goes otherwise.
+		if q.Desc {
+			return " ORDER BY created_at IS NULL, created_at DESC, seq DESC", nil
+		}
+		return " ORDER BY created_at IS NOT NULL, created_at, seq", nil
+	}
+	col, ok := sqlColumns[q.Sort]
+	if !ok {
+		return "", fmt.Errorf("cannot sort by %q", q.Sort)
+	}
+	// Pages and years are stored as text; compare them as numbers so that
+	// "280" sorts before "1000". seq breaks ties to keep pages stable.
+	if models.NumericFields[q.Sort] {
+		return " ORDER BY " + s.d.asInt(col) + dir + ", LOWER(" + col + ")" + dir + ", seq", nil
+	}
+	return " ORDER BY LOWER(" + col + ")" + dir + ", seq", nil
+}
+
+// ListBooks runs q. For paginated queries the total number of matches is
+// returned as well; otherwise it is 0.
+func (s *SQLStore) ListBooks(ctx context.Context, q BookQuery) ([]models.BookStore, int64, error) {
+	where, args, err := s.where(q)
+	if err != nil {
+		return nil, 0, err
+	}
+	order, err := s.orderBy(q)
+	if err != nil {
+		return nil, 0, err
+	}
+	if q.Page == 0 {
+		books, err := s.queryBooks(ctx, "SELECT "+bookColumns+" FROM books"+where+order+" LIMIT ?", append(args, s.MaxResults+1)...)
+		if err != nil {
+			return nil, 0, err
+		}
+		if int64(len(books)) > s.MaxResults {
+			slog.Warn("query returned too many books, results were truncated", "max_results", s.MaxResults)
+			books = books[:s.MaxResults]
+		}
+		return books, 0, nil
+	}
+
+	limit := min(q.Limit, s.MaxResults)
+	books, err := s.queryBooks(ctx, "SELECT "+bookColumns+" FROM books"+where+order+" LIMIT ? OFFSET ?",
+		append(args, limit, (q.Page-1)*q.Limit)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	var total int64
+	if err := s.queryRow(ctx, "SELECT COUNT(*) FROM books"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	return books, total, nil
+}
+
+// EachBook calls fn with every book matching q, in insertion order unless
+// q sorts them, reading one row at a time. Pagination and MaxResults do not
+// apply. It stops at the first error of fn, which must not use the store:
+// the rows hold on to a connection, the only one of SQLite.
+func (s *SQLStore) EachBook(ctx context.Context, q BookQuery, fn func(models.BookStore) error) error {
+	where, args, err := s.where(q)
+	if err != nil {
+		return err
+	}
+	order, err := s.orderBy(q)
+	if err != nil {
+		return err
+	}
+	rows, err := s.query(ctx, "SELECT "+bookColumns+" FROM books"+where+order, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		b, err := scanBook(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetBook returns the book with the given ID, or ErrNotFound
+func (s *SQLStore) GetBook(ctx context.Context, id string) (models.BookStore, error) {
+	book, err := scanBook(s.queryRow(ctx, "SELECT "+bookColumns+" FROM books WHERE id = ? AND deleted_at IS NULL", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return book, ErrNotFound
+	}
+	return book, err
+}
+
+// BookExists reports whether a book with the given ID is stored and not in
+// the trash
+func (s *SQLStore) BookExists(ctx context.Context, id string) (bool, error) {
+	var exists bool
+	err := s.queryRow(ctx, "SELECT EXISTS (SELECT 1 FROM books WHERE id = ? AND deleted_at IS NULL)", id).Scan(&exists)
+	return exists, err
+}
+
+// CountBooks returns the number of stored books outside the trash
+func (s *SQLStore) CountBooks(ctx context.Context) (int64, error) {
+	var count int64
+	err := s.queryRow(ctx, "SELECT COUNT(*) FROM books WHERE deleted_at IS NULL").Scan(&count)
+	return count, err
+}
+
+// CreateBook stores a new book. ErrDuplicate is returned if its ID is taken,
+// also by a book in the trash.
+func (s *SQLStore) CreateBook(ctx context.Context, book models.BookStore) error {
+	_, err := s.exec(ctx, "INSERT INTO books (oid, id, title, author, edition, pages, year, revision, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, 1, ?)",
+		primitive.NewObjectID().Hex(), book.ID, book.BookName, book.BookAuthor, book.BookEdition, book.BookPages, book.BookYear, time.Now().UTC())
+	if err != nil && s.d.isDuplicate(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// CreateBooks stores books one by one. A failed insert would abort a
+// PostgreSQL transaction, so the books are not inserted in one.
+func (s *SQLStore) CreateBooks(ctx context.Context, books []models.BookStore) ([]error, error) {
+	errs := make([]error, len(books))
+	for i, book := range books {
+		errs[i] = s.CreateBook(ctx, book)
+	}
+	return errs, nil
+}
+
+// upsertBatch is how many books UpsertBooks inserts with one statement,
+// keeping the number of parameters below the limit of SQLite
+const upsertBatch = 100
+
+// UpsertBooks stores books with multi-row inserts that skip the rows whose
+// ID is taken
+func (s *SQLStore) UpsertBooks(ctx context.Context, books []models.BookStore) (int64, error) {
+	var stored int64
+	now := time.Now().UTC()
+	for batch := range slices.Chunk(books, upsertBatch) {
+		rows := make([]string, len(batch))
+		args := make([]any, 0, 8*len(batch))
+		for i, book := range batch {
+			rows[i] = "(?, ?, ?, ?, ?, ?, ?, 1, ?)"
+			args = append(args, primitive.NewObjectID().Hex(), book.ID, book.BookName, book.BookAuthor, book.BookEdition, book.BookPages, book.BookYear, now)
+		}
+		res, err := s.exec(ctx, "INSERT INTO books (oid, id, title, author, edition, pages, year, revision, created_at) VALUES "+
+			strings.Join(rows, ", ")+" ON CONFLICT (id) DO NOTHING", args...)
+		if err != nil {
+			return stored, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return stored, err
+		}
+		stored += n
+	}
+	return stored, nil
+}
+
+// UpdateBook sets the given fields, keyed by API field name, on the book with
+// the given ID and returns the updated book, or ErrNotFound, also for books
+// in the trash. Changing the ID to one that is taken returns ErrDuplicate. If
+// revision is not 0 and the book is at another revision, ErrConflict is
+// returned and nothing changes.
+func (s *SQLStore) UpdateBook(ctx context.Context, id string, revision int64, fields map[string]string) (models.BookStore, error) {
+	if len(fields) == 0 {
+		book, err := s.GetBook(ctx, id)
+		if err == nil && revision != 0 && book.Revision != revision {
+			return book, ErrConflict
+		}
+		return book, err
+	}
+	sets := []string{"revision = revision + 1"}
+	var args []any
+	for name, value := range fields {
+		col, ok := sqlColumns[name]
+		if !ok {
+			return models.BookStore{}, fmt.Errorf("unknown field %q", name)
+		}
+		sets = append(sets, col+" = ?")
+		args = append(args, value)
+	}
+	where := " WHERE id = ? AND deleted_at IS NULL"
+	args = append(args, id)
+	if revision != 0 {
+		where += " AND revision = ?"
+		args = append(args, revision)
+	}
+	query := "UPDATE books SET " + strings.Join(sets, ", ") + where + " RETURNING " + bookColumns
+	book, err := scanBook(s.queryRow(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		if revision != 0 {
+			if exists, existsErr := s.BookExists(ctx, id); existsErr == nil && exists {
+				return book, ErrConflict
+			}
+		}
+		return book, ErrNotFound
+	}
+	if err != nil && s.d.isDuplicate(err) {
+		return book, ErrDuplicate
+	}
+	return book, err
+}
+
+// UpdateBooks sets fields on the books matching q and returns the number of
+// matches and the changed books. Books already holding the values keep
+// their revision.
+func (s *SQLStore) UpdateBooks(ctx context.Context, q BookQuery, fields map[string]string) (int64, []models.BookStore, error) {
+	where, args, err := s.where(q)
+	if err != nil {
+		return 0, nil, err
+	}
+	var matched int64
+	if err := s.queryRow(ctx, "SELECT COUNT(*) FROM books"+where, args...).Scan(&matched); err != nil {
+		return 0, nil, err
+	}
+	if len(fields) == 0 {
+		return matched, nil, nil
+	}
+	sets := []string{"revision = revision + 1"}
+	var setArgs, differArgs []any
+	var differs []string
+	for name, value := range fields {
+		col, ok := sqlColumns[name]
+		if !ok {
+			return 0, nil, fmt.Errorf("unknown field %q", name)
+		}
+		sets = append(sets, col+" = ?")
+		setArgs = append(setArgs, value)
+		differs = append(differs, col+" <> ?")
+		differArgs = append(differArgs, value)
+	}
+	query := "UPDATE books SET " + strings.Join(sets, ", ") + where +
+		" AND (" + strings.Join(differs, " OR ") + ") RETURNING " + bookColumns
+	books, err := s.queryBooks(ctx, query, append(append(setArgs, args...), differArgs...)...)
+	if err != nil && s.d.isDuplicate(err) {
+		return 0, nil, ErrDuplicate
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return matched, books, nil
+}
+
+// DeleteBooks moves the books matching q to the trash and returns them. The
+// order and pagination of q are ignored.
+func (s *SQLStore) DeleteBooks(ctx context.Context, q BookQuery) ([]models.BookStore, error) {
+	where, args, err := s.where(q)
+	if err != nil {
+		return nil, err
+	}
+	return s.queryBooks(ctx, "UPDATE books SET deleted_at = ?"+where+" RETURNING "+bookColumns,
+		append([]any{time.Now().UTC()}, args...)...)
+}
+
+// PurgeBooks removes the books in the trash matching q and returns them.
+// The order and pagination of q are ignored.
+func (s *SQLStore) PurgeBooks(ctx context.Context, q BookQuery) ([]models.BookStore, error) {
+	q.Deleted = true
+	where, args, err := s.where(q)
+	if err != nil {
+		return nil, err
+	}
+	var books []models.BookStore
+	err = s.WithTransaction(ctx, func(ctx context.Context) error {
+		books, err = s.queryBooks(ctx, "DELETE FROM books"+where+" RETURNING "+bookColumns, args...)
+		if err != nil {
+			return err
+		}
+		for _, book := range books {
+			if book.Cover == nil {
+				continue
+			}
+			if _, err := s.exec(ctx, "DELETE FROM book_covers WHERE book_id = ?", book.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return books, err
+}
+
+// DeleteBook moves the book with the given ID to the trash, or returns
+// ErrNotFound
+func (s *SQLStore) DeleteBook(ctx context.Context, id string) error {
+	res, err := s.exec(ctx, "UPDATE books SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RestoreBook takes the book with the given ID out of the trash and returns
+// it, or ErrNotFound if it is not in the trash
+func (s *SQLStore) RestoreBook(ctx context.Context, id string) (models.BookStore, error) {
+	book, err := scanBook(s.queryRow(ctx, "UPDATE books SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL RETURNING "+bookColumns, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return book, ErrNotFound
+	}
+	return book, err
+}
+
+// SetCover stores data and its thumbnails in book_covers and points the
+// book at the new rows, replacing the previous cover, in one transaction
+func (s *SQLStore) SetCover(ctx context.Context, id string, cover models.Cover, data []byte, thumbnails map[string][]byte) (models.BookStore, error) {
+	cover.FileID = primitive.NewObjectID().Hex()
+	var book models.BookStore
+	err := s.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		book, err = scanBook(s.queryRow(ctx, "UPDATE books SET cover_id = ?, cover_type = ?, cover_size = ?, cover_uploaded_at = ? WHERE id = ? AND deleted_at IS NULL RETURNING "+bookColumns,
+			cover.FileID, cover.ContentType, cover.Size, cover.UploadedAt, id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := s.exec(ctx, "DELETE FROM book_covers WHERE book_id = ?", id); err != nil {
+			return err
+		}
+		if _, err := s.exec(ctx, "INSERT INTO book_covers (id, book_id, data) VALUES (?, ?, ?)", cover.FileID, id, data); err != nil {
+			return err
+		}
+		for size, thumbnail := range thumbnails {
+			if _, err := s.exec(ctx, "INSERT INTO book_covers (id, book_id, data) VALUES (?, ?, ?)", cover.ThumbnailID(size), id, thumbnail); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return book, err
+}
+
+// OpenCover returns the cover of the book in size and its image from
+// book_covers
+func (s *SQLStore) OpenCover(ctx context.Context, id, size string) (models.Cover, io.ReadCloser, error) {
+	book, err := s.GetBook(ctx, id)
+	if err != nil {
+		return models.Cover{}, nil, err
+	}
+	if book.Cover == nil {
+		return models.Cover{}, nil, ErrNotFound
+	}
+	cover := *book.Cover
+	var data []byte
+	if size != "" {
+		err = s.queryRow(ctx, "SELECT data FROM book_covers WHERE id = ?", cover.ThumbnailID(size)).Scan(&data)
+		if err == nil {
+			thumbnail := models.Cover{FileID: cover.ThumbnailID(size), ContentType: models.ThumbnailType, Size: int64(len(data)), UploadedAt: cover.UploadedAt}
+			return thumbnail, io.NopCloser(bytes.NewReader(data)), nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return models.Cover{}, nil, err
+		}
+	}
+	err = s.queryRow(ctx, "SELECT data FROM book_covers WHERE id = ?", cover.FileID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Cover{}, nil, ErrNotFound
+	}
+	if err != nil {
+		return models.Cover{}, nil, err
+	}
+	return cover, io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// BookStats computes the statistics of the catalog in one scan of the books
+func (s *SQLStore) BookStats(ctx context.Context) (BookStats, error) {
+	var stats BookStats
+	var first, last sql.NullInt64
+	err := s.queryRow(ctx, "SELECT COUNT(*) - COUNT(deleted_at), COUNT(DISTINCT CASE WHEN deleted_at IS NULL THEN author END), COUNT(deleted_at), "+
+		"MIN(CASE WHEN deleted_at IS NULL THEN "+s.d.asInt("year")+" END), MAX(CASE WHEN deleted_at IS NULL THEN "+s.d.asInt("year")+" END) FROM books").
+		Scan(&stats.Books, &stats.Authors, &stats.Trash, &first, &last)
+	stats.FirstYear, stats.LastYear = first.Int64, last.Int64
+	return stats, err
+}
+
+// BooksPerAuthor counts the books of each author with GROUP BY
+func (s *SQLStore) BooksPerAuthor(ctx context.Context) ([]AuthorCount, error) {
+	rows, err := s.query(ctx, "SELECT author, COUNT(*) FROM books WHERE author <> '' AND deleted_at IS NULL GROUP BY author ORDER BY COUNT(*) DESC, author")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ret := []AuthorCount{}
+	for rows.Next() {
+		var ac AuthorCount
+		if err := rows.Scan(&ac.Author, &ac.Books); err != nil {
+			return nil, err
+		}
+		ret = append(ret, ac)
+	}
+	return ret, rows.Err()
+}
+
+// BooksPerDecade counts the books of each decade, parsing the years with
+// the asInt of the dialect
+func (s *SQLStore) BooksPerDecade(ctx context.Context) ([]DecadeCount, error) {
+	rows, err := s.query(ctx, "SELECT year - year % 10 AS decade, COUNT(*) FROM "+
+		"(SELECT "+s.d.asInt("year")+" AS year FROM books WHERE deleted_at IS NULL) AS years "+
+		"WHERE year >= 1 GROUP BY decade ORDER BY decade")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ret := []DecadeCount{}
+	for rows.Next() {
+		var dc DecadeCount
+		if err := rows.Scan(&dc.Decade, &dc.Books); err != nil {
+			return nil, err
+		}
+		ret = append(ret, dc)
+	}
+	return ret, rows.Err()
+}
+
+// Distinct returns the sorted distinct non-empty values of a book field,
+// given by its API name
+func (s *SQLStore) Distinct(ctx context.Context, field string) ([]string, error) {
+	col, ok := sqlColumns[field]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", field)
+	}
+	rows, err := s.query(ctx, "SELECT DISTINCT "+col+" FROM books WHERE "+col+" <> '' AND deleted_at IS NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ret := []string{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		ret = append(ret, v)
+	}
+	sort.Strings(ret)
+	return ret, rows.Err()
+}
+
+// TextSearch ranks books by the words of q they contain, see rankByText
+func (s *SQLStore) TextSearch(ctx context.Context, q string, limit int64) ([]ScoredBook, error) {
+	books, err := s.queryBooks(ctx, "SELECT "+bookColumns+" FROM books WHERE deleted_at IS NULL ORDER BY seq")
+	if err != nil {
+		return nil, err
+	}
+	return rankByText(books, q, limit), nil
+}
+
+// SearchTitles returns the books whose title contains q, ignoring case
+func (s *SQLStore) SearchTitles(ctx context.Context, q string) ([]models.BookStore, error) {
+	books, _, err := s.ListBooks(ctx, BookQuery{Conditions: []Condition{{Field: "title", Op: "contains", Value: q}}})
+	return books, err
+}
+
+// FuzzySearch ranks titles by edit distance to q so that small typos
+// ("Frankenstien") still find the intended book.
+func (s *SQLStore) FuzzySearch(ctx context.Context, q string) ([]RankedBook, error) {
+	candidates, err := s.queryBooks(ctx, "SELECT "+bookColumns+" FROM books WHERE deleted_at IS NULL ORDER BY seq LIMIT ?", fuzzyCandidateLimit)
+	if err != nil {
+		return nil, err
+	}
+	return rankByDistance(candidates, q), nil
+}
+
+// WatchBooks returns ErrWatchUnsupported; SQLStore keeps no change log
+func (s *SQLStore) WatchBooks(ctx context.Context) (<-chan BookEvent, error) {
+	return nil, ErrWatchUnsupported
+}
+
+// EnsureTextIndex is a no-op; TextSearch ranks the books itself
+func (s *SQLStore) EnsureTextIndex(ctx context.Context) error { return nil }
+
+// EnsureAuthIndexes is a no-op; the unique constraints are part of the tables
+func (s *SQLStore) EnsureAuthIndexes(ctx context.Context) error { return nil }
+
+// InsertAPIKey stores a new key and sets its ID
+func (s *SQLStore) InsertAPIKey(ctx context.Context, key *models.APIKey) error {
+	id := primitive.NewObjectID()
+	_, err := s.exec(ctx, "INSERT INTO api_keys (id, name, role, prefix, hash, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		id.Hex(), key.Name, key.Role, key.Prefix, key.Hash, key.CreatedAt)
+	if err != nil {
+		if s.d.isDuplicate(err) {
+			return ErrDuplicate
+		}
+		return err
+	}
+	key.ID = id
+	return nil
+}
+
+// scanAPIKey reads a row of api_keys selected with keyColumns
+func scanAPIKey(row scanner) (models.APIKey, error) {
+	var k models.APIKey
+	var id string
+	var revoked sql.NullTime
+	if err := row.Scan(&id, &k.Name, &k.Role, &k.Prefix, &k.Hash, &k.CreatedAt, &revoked); err != nil {
+		return k, err
+	}
+	k.ID, _ = primitive.ObjectIDFromHex(id)
+	if revoked.Valid {
+		k.RevokedAt = &revoked.Time
+	}
+	return k, nil
+}
+
+const keyColumns = "id, name, role, prefix, hash, created_at, revoked_at"
+
+// ListAPIKeys returns all keys, revoked ones included, oldest first
+func (s *SQLStore) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	rows, err := s.query(ctx, "SELECT "+keyColumns+" FROM api_keys ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []models.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		k.Hash = ""
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey marks the key with the given ID as revoked, or returns
+// ErrNotFound if there is no such unrevoked key
+func (s *SQLStore) RevokeAPIKey(ctx context.Context, id string) error {
+	res, err := s.exec(ctx, "UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// APIKeyByHash returns the unrevoked key with the given hash, or ErrNotFound
+func (s *SQLStore) APIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	k, err := scanAPIKey(s.queryRow(ctx, "SELECT "+keyColumns+" FROM api_keys WHERE hash = ? AND revoked_at IS NULL", hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return k, ErrNotFound
+	}
+	return k, err
+}
+
+// InsertUser stores a new user and sets its ID. ErrDuplicate is returned if
+// the username is taken.
+func (s *SQLStore) InsertUser(ctx context.Context, user *models.User) error {
+	id := primitive.NewObjectID()
+	_, err := s.exec(ctx, "INSERT INTO users (id, username, password_hash, role, created_at) VALUES (?, ?, ?, ?, ?)",
+		id.Hex(), user.Username, user.PasswordHash, user.Role, user.CreatedAt)
+	if err != nil {
+		if s.d.isDuplicate(err) {
+			return ErrDuplicate
+		}
+		return err
+	}
+	user.ID = id
+	return nil
+}
+
+// scanUser reads a row of users selected with userColumns
+func scanUser(row scanner) (models.User, error) {
+	var u models.User
+	var id string
+	if err := row.Scan(&id, &u.Username, &u.PasswordHash, &u.Role, &u.CreatedAt); err != nil {
+		return u, err
+	}
+	u.ID, _ = primitive.ObjectIDFromHex(id)
+	return u, nil
+}
+
+const userColumns = "id, username, password_hash, role, created_at"
+
+// ListUsers returns all users ordered by username
+func (s *SQLStore) ListUsers(ctx context.Context) ([]models.User, error) {
+	rows, err := s.query(ctx, "SELECT "+userColumns+" FROM users ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []models.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		u.PasswordHash = ""
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// FindUser returns the user with the given username, or ErrNotFound
+func (s *SQLStore) FindUser(ctx context.Context, username string) (models.User, error) {
+	u, err := scanUser(s.queryRow(ctx, "SELECT "+userColumns+" FROM users WHERE username = ?", username))
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, ErrNotFound
+	}
+	return u, err
+}
+
+// UpdateUser assigns a new role and/or password hash to a user; empty values
+// are left unchanged. ErrNotFound is returned if there is no such user.
+func (s *SQLStore) UpdateUser(ctx context.Context, username, role, passwordHash string) error {
+	res, err := s.exec(ctx, `UPDATE users SET
+		role = CASE WHEN ? = '' THEN role ELSE ? END,
+		password_hash = CASE WHEN ? = '' THEN password_hash ELSE ? END
+		WHERE username = ?`, role, role, passwordHash, passwordHash, username)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteUser removes a user, or returns ErrNotFound
+func (s *SQLStore) DeleteUser(ctx context.Context, username string) error {
+	res, err := s.exec(ctx, "DELETE FROM users WHERE username = ?", username)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// InsertWebhook stores a new webhook and sets its ID
+func (s *SQLStore) InsertWebhook(ctx context.Context, hook *models.Webhook) error {
+	id := primitive.NewObjectID()
+	_, err := s.exec(ctx, "INSERT INTO webhooks (id, url, secret, created_at) VALUES (?, ?, ?, ?)",
+		id.Hex(), hook.URL, hook.Secret, hook.CreatedAt)
+	if err != nil {
+		return err
+	}
+	hook.ID = id
+	return nil
+}
+
+// ListWebhooks returns all webhooks with their secrets, oldest first
+func (s *SQLStore) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	rows, err := s.query(ctx, "SELECT id, url, secret, created_at FROM webhooks ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hooks := []models.Webhook{}
+	for rows.Next() {
+		var h models.Webhook
+		var id string
+		if err := rows.Scan(&id, &h.URL, &h.Secret, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		h.ID, _ = primitive.ObjectIDFromHex(id)
+		hooks = append(hooks, h)
+	}
+	return hooks, rows.Err()
+}
+
+// DeleteWebhook removes the webhook with the given ID, or returns ErrNotFound
+func (s *SQLStore) DeleteWebhook(ctx context.Context, id string) error {
+	res, err := s.exec(ctx, "DELETE FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// InsertAuditEntry stores a new entry and sets its ID. The changed fields
+// are stored as JSON.
+func (s *SQLStore) InsertAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	before, err := json.Marshal(entry.Before)
+	if err != nil {
+		return err
+	}
+	after, err := json.Marshal(entry.After)
+	if err != nil {
+		return err
+	}
+	id := primitive.NewObjectID()
+	_, err = s.exec(ctx, "INSERT INTO audit (id, book_id, action, actor, route, client_ip, request_id, time, before_values, after_values) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		id.Hex(), entry.BookID, entry.Action, entry.Actor, entry.Route, entry.ClientIP, entry.RequestID, entry.Time, string(before), string(after))
+	if err != nil {
+		return err
+	}
+	entry.ID = id
+	return nil
+}
+
+// ListAuditEntries returns the entries matching q, newest first
+func (s *SQLStore) ListAuditEntries(ctx context.Context, q AuditQuery) ([]models.AuditEntry, error) {
+	conds := []string{"1 = 1"}
+	var args []any
+	if q.BookID != "" {
+		conds = append(conds, "book_id = ?")
+		args = append(args, q.BookID)
+	}
+	if !q.Since.IsZero() {
+		conds = append(conds, "time >= ?")
+		args = append(args, q.Since.UTC())
+	}
+	if !q.Until.IsZero() {
+		conds = append(conds, "time < ?")
+		args = append(args, q.Until.UTC())
+	}
+	rows, err := s.query(ctx, "SELECT id, book_id, action, actor, route, client_ip, request_id, time, before_values, after_values FROM audit WHERE "+
+		strings.Join(conds, " AND ")+" ORDER BY time DESC, id DESC LIMIT ?", append(args, q.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		var id, before, after string
+		if err := rows.Scan(&id, &e.BookID, &e.Action, &e.Actor, &e.Route, &e.ClientIP, &e.RequestID, &e.Time, &before, &after); err != nil {
+			return nil, err
+		}
+		e.ID, _ = primitive.ObjectIDFromHex(id)
+		if err := json.Unmarshal([]byte(before), &e.Before); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(after), &e.After); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// InsertBookVersion stores a previous version of a book and sets its ID.
+// A version stored before is left alone, since a failed insert would abort
+// a PostgreSQL transaction, and reported with ErrDuplicate.
+func (s *SQLStore) InsertBookVersion(ctx context.Context, v *models.BookVersion) error {
+	id := primitive.NewObjectID()
+	res, err := s.exec(ctx, "INSERT INTO book_history (id, book_id, version, title, author, pages, edition, year, replaced_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (book_id, version) DO NOTHING",
+		id.Hex(), v.BookID, v.Version, v.Title, v.Author, v.Pages, v.Edition, v.Year, v.ReplacedAt)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrDuplicate
+	}
+	v.ID = id
+	return nil
+}
+
+// bookVersionColumns are the columns of book_history in the order
+// scanBookVersion reads them
+const bookVersionColumns = "id, book_id, version, title, author, pages, edition, year, replaced_at"
+
+// scanBookVersion reads a row selected with bookVersionColumns
+func scanBookVersion(row scanner) (models.BookVersion, error) {
+	var v models.BookVersion
+	var id string
+	err := row.Scan(&id, &v.BookID, &v.Version, &v.Title, &v.Author, &v.Pages, &v.Edition, &v.Year, &v.ReplacedAt)
+	v.ID, _ = primitive.ObjectIDFromHex(id)
+	return v, err
+}
+
+// ListBookVersions returns the previous versions of a book, newest first
+func (s *SQLStore) ListBookVersions(ctx context.Context, bookID string) ([]models.BookVersion, error) {
+	rows, err := s.query(ctx, "SELECT "+bookVersionColumns+" FROM book_history WHERE book_id = ? ORDER BY version DESC", bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	versions := []models.BookVersion{}
+	for rows.Next() {
+		v, err := scanBookVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// GetBookVersion returns a previous version of a book or ErrNotFound
+func (s *SQLStore) GetBookVersion(ctx context.Context, bookID string, version int64) (models.BookVersion, error) {
+	v, err := scanBookVersion(s.queryRow(ctx, "SELECT "+bookVersionColumns+" FROM book_history WHERE book_id = ? AND version = ?", bookID, version))
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+
+// DeleteBookVersions removes the previous versions of the books with the
+// given IDs
+func (s *SQLStore) DeleteBookVersions(ctx context.Context, bookIDs []string) error {
+	if len(bookIDs) == 0 {
+		return nil
+	}
+	args := make([]any, len(bookIDs))
+	for i, id := range bookIDs {
+		args[i] = id
+	}
+	_, err := s.exec(ctx, "DELETE FROM book_history WHERE book_id IN (?"+strings.Repeat(", ?", len(bookIDs)-1)+")", args...)
+	return err
+}
+
+// ClaimIdempotencyKey stores rec unless its key is taken; then the stored
+// record is returned with ErrDuplicate. Expired records are removed first.
+func (s *SQLStore) ClaimIdempotencyKey(ctx context.Context, rec models.IdempotencyRecord) (models.IdempotencyRecord, error) {
+	if _, err := s.exec(ctx, "DELETE FROM idempotency_keys WHERE created_at < ?", time.Now().Add(-IdempotencyTTL)); err != nil {
+		return rec, err
+	}
+	_, err := s.exec(ctx, "INSERT INTO idempotency_keys (id, fingerprint, status, body, created_at) VALUES (?, ?, ?, ?, ?)",
+		rec.Key, rec.Fingerprint, rec.Status, string(rec.Body), rec.CreatedAt)
+	if err == nil || !s.d.isDuplicate(err) {
+		return rec, err
+	}
+	var stored models.IdempotencyRecord
+	var body string
+	err = s.queryRow(ctx, "SELECT id, fingerprint, status, body, created_at FROM idempotency_keys WHERE id = ?", rec.Key).
+		Scan(&stored.Key, &stored.Fingerprint, &stored.Status, &body, &stored.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Released in the meantime: report it as running, so that the
+		// client retries.
+		return rec, ErrDuplicate
+	}
+	if err != nil {
+		return rec, err
+	}
+	stored.Body = []byte(body)
+	return stored, ErrDuplicate
+}
+
+// CompleteIdempotencyKey stores the response to the claimed key
+func (s *SQLStore) CompleteIdempotencyKey(ctx context.Context, key string, status int, body []byte) error {
+	_, err := s.exec(ctx, "UPDATE idempotency_keys SET status = ?, body = ? WHERE id = ?", status, string(body), key)
+	return err
+}
+
+// ReleaseIdempotencyKey drops the claim of key
+func (s *SQLStore) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := s.exec(ctx, "DELETE FROM idempotency_keys WHERE id = ?", key)
+	return err
+}
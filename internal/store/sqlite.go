@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3" // registers the sqlite3 driver
+)
+
+// sqlite is the dialect of SQLite
+var sqlite = dialect{
+	name:      "SQLite",
+	driver:    "sqlite3",
+	serial:    "INTEGER PRIMARY KEY AUTOINCREMENT",
+	timestamp: "TIMESTAMP",
+	blob:      "BLOB",
+	asInt: func(col string) string {
+		// An optional sign followed by at least one digit, like strconv.Atoi
+		digits := "LTRIM(" + col + ", '+-')"
+		return "(CASE WHEN " + digits + " <> '' AND " + digits + " NOT GLOB '*[^0-9]*'" +
+			" AND LENGTH(" + col + ") - LENGTH(" + digits + ") <= 1" +
+			" THEN CAST(" + col + " AS INTEGER) END)"
+	},
+	isDuplicate: func(err error) bool {
+		// Matched by message so that builds without cgo still compile.
+		return strings.Contains(err.Error(), "UNIQUE constraint failed")
+	},
+}
+
+// OpenSQLite opens the SQLite database file at path, creating it and its
+// tables if needed. Several services may share the file: writes wait for
+// each other instead of failing. The driver needs cgo; binaries built with
+// CGO_ENABLED=0 fail here.
+func OpenSQLite(ctx context.Context, path string) (*SQLStore, error) {
+	params := url.Values{}
+	params.Set("_busy_timeout", "5000")
+	params.Set("_journal_mode", "WAL")
+	params.Set("_txlock", "immediate")
+	return openSQL(ctx, sqlite, "file:"+path+"?"+params.Encode(), 0)
+}
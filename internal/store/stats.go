@@ -0,0 +1,127 @@
+package store
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// BookStats summarizes the catalog
+type BookStats struct {
+	Books   int64 // outside the trash
+	Authors int64 // distinct authors of those books
+	Trash   int64 // books in the trash
+	// FirstYear and LastYear are the earliest and latest years the books
+	// were published in, both 0 if no book has a year that is a number
+	FirstYear int64
+	LastYear  int64
+}
+
+// yearAsLong converts the year of a book to a number in a pipeline, null
+// if it is none
+var yearAsLong = bson.M{"$convert": bson.M{"input": "$BookYear", "to": "long", "onError": nil, "onNull": nil}}
+
+// BookStats computes the statistics of the catalog in a single aggregation
+func (s *Store) BookStats(ctx context.Context) (BookStats, error) {
+	live := bson.M{"$match": bson.M{"DeletedAt": nil}}
+	cursor, err := s.books.Aggregate(ctx, mongo.Pipeline{{{Key: "$facet", Value: bson.M{
+		"books": bson.A{live, bson.M{"$group": bson.M{
+			"_id":   nil,
+			"count": bson.M{"$sum": 1},
+			"first": bson.M{"$min": yearAsLong},
+			"last":  bson.M{"$max": yearAsLong},
+		}}},
+		"authors": bson.A{live, bson.M{"$group": bson.M{"_id": "$BookAuthor"}}, bson.M{"$count": "count"}},
+		"trash":   bson.A{bson.M{"$match": bson.M{"DeletedAt": bson.M{"$ne": nil}}}, bson.M{"$count": "count"}},
+	}}}})
+	if err != nil {
+		return BookStats{}, err
+	}
+	type count struct {
+		Count int64  `bson:"count"`
+		First *int64 `bson:"first"`
+		Last  *int64 `bson:"last"`
+	}
+	var facets []struct {
+		Books   []count `bson:"books"`
+		Authors []count `bson:"authors"`
+		Trash   []count `bson:"trash"`
+	}
+	if err := cursor.All(ctx, &facets); err != nil {
+		return BookStats{}, err
+	}
+	var stats BookStats
+	if len(facets) == 0 {
+		return stats, nil
+	}
+	// A facet without documents to count has no result at all.
+	if f := facets[0].Books; len(f) > 0 {
+		stats.Books = f[0].Count
+		if f[0].First != nil {
+			stats.FirstYear, stats.LastYear = *f[0].First, *f[0].Last
+		}
+	}
+	if f := facets[0].Authors; len(f) > 0 {
+		stats.Authors = f[0].Count
+	}
+	if f := facets[0].Trash; len(f) > 0 {
+		stats.Trash = f[0].Count
+	}
+	return stats, nil
+}
+
+// AuthorCount is the number of books of an author
+type AuthorCount struct {
+	Author string `bson:"_id"`
+	Books  int64  `bson:"books"`
+}
+
+// BooksPerAuthor counts the books outside the trash of each author, the
+// most prolific first and authors with as many books by name
+func (s *Store) BooksPerAuthor(ctx context.Context) ([]AuthorCount, error) {
+	cursor, err := s.books.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"DeletedAt": nil, "BookAuthor": bson.M{"$ne": ""}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$BookAuthor", "books": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "books", Value: -1}, {Key: "_id", Value: 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ret := []AuthorCount{}
+	if err := cursor.All(ctx, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// DecadeCount is the number of books published in a decade, given by its
+// first year: 1990 for the years 1990 to 1999
+type DecadeCount struct {
+	Decade int64 `bson:"_id"`
+	Books  int64 `bson:"books"`
+}
+
+// BooksPerDecade counts the books outside the trash published in each
+// decade, the earliest first. Books without a year that is a positive
+// number are left out.
+func (s *Store) BooksPerDecade(ctx context.Context) ([]DecadeCount, error) {
+	cursor, err := s.books.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"DeletedAt": nil}}},
+		{{Key: "$project", Value: bson.M{"year": yearAsLong}}},
+		{{Key: "$match", Value: bson.M{"year": bson.M{"$gte": 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"$subtract": bson.A{"$year", bson.M{"$mod": bson.A{"$year", 10}}}},
+			"books": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ret := []DecadeCount{}
+	if err := cursor.All(ctx, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,222 @@
+// Package store gives the bookstore services access to their storage.
+// Handlers get a Repository injected instead of reaching for the database
+// themselves; Store keeps the data in the MongoDB database the services
+// share, SQLStore in PostgreSQL or a SQLite file and Memory in the process.
+package store
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/CAPS-Cloud/exercises/internal/migrations"
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/telemetry"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+const (
+	// DefaultDatabase is the database holding all collections of the
+	// bookstore unless Config names another
+	DefaultDatabase = "exercise-1"
+	// DefaultCollection is the collection of the books unless Config names
+	// another
+	DefaultCollection = "information"
+)
+
+var (
+	// ErrNotFound is returned when no document matches
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate is returned when a unique index rejects a write
+	ErrDuplicate = errors.New("duplicate")
+	// ErrInvalid is returned when the schema validator of a collection
+	// rejects a write
+	ErrInvalid = errors.New("document failed validation")
+	// ErrConflict is returned by UpdateBook when the book has been changed
+	// since the revision the caller read
+	ErrConflict = errors.New("revision mismatch")
+	// ErrTransactionsUnsupported is returned by WithTransaction on a
+	// standalone server, which cannot run transactions
+	ErrTransactionsUnsupported = errors.New("transactions require MongoDB to run as a replica set")
+	// ErrWatchUnsupported is returned by WatchBooks when the backend cannot
+	// report changes, like a standalone MongoDB server or a SQL database
+	ErrWatchUnsupported = errors.New("the storage backend cannot report changes")
+)
+
+// Store wraps the collections of the bookstore database
+type Store struct {
+	client   *mongo.Client
+	books    *mongo.Collection
+	keys     *mongo.Collection
+	users    *mongo.Collection
+	webhooks *mongo.Collection
+	idemKeys *mongo.Collection
+	audit    *mongo.Collection
+	history  *mongo.Collection
+	covers   *gridfs.Bucket // the cover images of books
+
+	// MaxResults caps how many documents a listing loads into memory.
+	MaxResults int64
+}
+
+// Open connects to the MongoDB server at conf.URI, pings it, creates the
+// collections that do not exist yet in conf.Database and applies pending
+// migrations. A server that cannot be reached is pinged again for up to
+// conf.ConnectRetry.
+func Open(ctx context.Context, conf Config) (*Store, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(conf.URI).SetMonitor(telemetry.MongoMonitor()))
+	if err != nil {
+		return nil, err
+	}
+	// Ping the primary
+	err = retryConnect(ctx, "MongoDB", conf.ConnectRetry, func(ctx context.Context) error {
+		return client.Ping(ctx, nil)
+	})
+	if err != nil {
+		client.Disconnect(ctx)
+		return nil, err
+	}
+	slog.Info("connected to MongoDB")
+
+	s := &Store{client: client, MaxResults: 10000}
+	db := client.Database(conf.Database)
+	for name, coll := range map[string]**mongo.Collection{
+		conf.Collection: &s.books,
+		"apikeys":       &s.keys,
+		"users":         &s.users,
+		"webhooks":      &s.webhooks,
+		"idempotency":   &s.idemKeys,
+		"audit":         &s.audit,
+		"book_history":  &s.history,
+	} {
+		var validator bson.M
+		if name == conf.Collection {
+			validator = bson.M{"$jsonSchema": models.BookSchema}
+		}
+		if *coll, err = prepareCollection(ctx, db, name, validator); err != nil {
+			client.Disconnect(ctx)
+			return nil, err
+		}
+	}
+	if s.covers, err = gridfs.NewBucket(db, options.GridFSBucket().SetName("covers")); err != nil {
+		client.Disconnect(ctx)
+		return nil, err
+	}
+	if err := s.ensureBookIndexes(ctx); err != nil {
+		// Books stored before the index existed may share an ID; the
+		// services still work, but duplicates are only caught once fixed.
+		slog.Warn("cannot create the unique index on book ID, remove duplicate IDs and restart", "error", err)
+	}
+	if err := s.ensureIdempotencyIndex(ctx); err != nil {
+		slog.Warn("cannot create the expiry index on idempotency keys, they are kept forever", "error", err)
+	}
+	if err := s.ensureAuditIndex(ctx); err != nil {
+		slog.Warn("cannot create the index on the audit log, listing it may be slow", "error", err)
+	}
+	if err := s.ensureHistoryIndex(ctx); err != nil {
+		slog.Warn("cannot create the index on book history, versions may be stored twice", "error", err)
+	}
+	if err := migrations.Apply(ctx, db, s.books, migrations.All); err != nil {
+		client.Disconnect(ctx)
+		return nil, err
+	}
+	return s, nil
+}
+
+// Ping reports whether the primary can be reached
+func (s *Store) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx, nil)
+}
+
+// Close disconnects from MongoDB
+func (s *Store) Close(ctx context.Context) error {
+	return s.client.Disconnect(ctx)
+}
+
+// prepareCollection returns the collection name of db, creating it with the
+// given validator if needed. A nil validator accepts every document.
+func prepareCollection(ctx context.Context, db *mongo.Database, name string, validator bson.M) (*mongo.Collection, error) {
+	names, err := db.ListCollectionNames(ctx, bson.D{{}})
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(names, name) {
+		cmd := bson.D{{"create", name}}
+		if validator != nil {
+			cmd = append(cmd, bson.E{"validator", validator})
+		}
+		var result bson.M
+		if err = db.RunCommand(ctx, cmd).Decode(&result); err != nil {
+			slog.Error("cannot create collection", "collection", name, "error", err)
+			return nil, err
+		}
+	}
+	return db.Collection(name), nil
+}
+
+// WithTransaction runs fn inside a transaction. Store methods called with the
+// context passed to fn take part in it, so either all of their writes are
+// committed or none. Called again from within fn, it joins the running
+// transaction. Transactions read a snapshot and commit with majority write
+// concern; they need a replica set or sharded cluster, so on a standalone
+// server ErrTransactionsUnsupported is returned.
+func (s *Store) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+	session, err := s.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	opts := options.Transaction().
+		SetReadConcern(readconcern.Snapshot()).
+		SetWriteConcern(writeconcern.Majority())
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	}, opts)
+	if err != nil && transactionsUnsupported(err) {
+		return ErrTransactionsUnsupported
+	}
+	return err
+}
+
+// rejectedByValidator reports whether err comes from a write the schema
+// validator of a collection rejected (DocumentValidationFailure, code 121)
+func rejectedByValidator(err error) bool {
+	var writeErr mongo.WriteException
+	if errors.As(err, &writeErr) {
+		for _, e := range writeErr.WriteErrors {
+			if e.Code == 121 {
+				return true
+			}
+		}
+	}
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == 121
+}
+
+// changeStreamsUnsupported reports whether err comes from a standalone server
+// that cannot open change streams (code 40573).
+func changeStreamsUnsupported(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == 40573
+}
+
+// transactionsUnsupported reports whether err comes from a standalone server
+// that cannot run transactions (IllegalOperation, code 20).
+func transactionsUnsupported(err error) bool {
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == 20 {
+		return true
+	}
+	return strings.Contains(err.Error(), "Transaction numbers are only allowed")
+}
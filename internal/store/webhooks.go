@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InsertWebhook stores a new webhook and sets its ID
+func (s *Store) InsertWebhook(ctx context.Context, hook *models.Webhook) error {
+	res, err := s.webhooks.InsertOne(ctx, hook)
+	if err != nil {
+		return err
+	}
+	hook.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// ListWebhooks returns all webhooks with their secrets, oldest first
+func (s *Store) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	cursor, err := s.webhooks.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{"created_at", 1}}))
+	if err != nil {
+		return nil, err
+	}
+	hooks := make([]models.Webhook, 0)
+	if err := cursor.All(ctx, &hooks); err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+// DeleteWebhook removes the webhook with the given ID, or returns ErrNotFound
+func (s *Store) DeleteWebhook(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	res, err := s.webhooks.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
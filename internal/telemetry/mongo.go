@@ -0,0 +1,70 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/CAPS-Cloud/exercises/internal/logging"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans of this package
+const tracerName = "github.com/CAPS-Cloud/exercises/internal/telemetry"
+
+// MongoMonitor returns a command monitor that records every command sent to
+// MongoDB as a span, a child of the span in the context of the operation,
+// tagged with the ID of the request that sent it. Failed commands are logged
+// with that ID as well. The commands themselves are not recorded since they
+// contain book data.
+func MongoMonitor() *event.CommandMonitor {
+	var spans sync.Map // request ID of a running command -> trace.Span
+	end := func(requestID int64, err string) {
+		v, ok := spans.LoadAndDelete(requestID)
+		if !ok {
+			return
+		}
+		span := v.(trace.Span)
+		if err != "" {
+			span.SetStatus(codes.Error, err)
+		}
+		span.End()
+	}
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, evt *event.CommandStartedEvent) {
+			attrs := []attribute.KeyValue{
+				semconv.DBSystemNameMongoDB,
+				semconv.DBNamespace(evt.DatabaseName),
+				semconv.DBOperationName(evt.CommandName),
+			}
+			name := evt.CommandName
+			// Commands on a collection name it as their first value.
+			if first, err := evt.Command.IndexErr(0); err == nil {
+				if coll, ok := first.Value().StringValueOK(); ok {
+					attrs = append(attrs, semconv.DBCollectionName(coll))
+					name = evt.CommandName + " " + coll
+				}
+			}
+			if id := logging.RequestID(ctx); id != "" {
+				attrs = append(attrs, attribute.String("request_id", id))
+			}
+			_, span := otel.Tracer(tracerName).Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attrs...),
+			)
+			spans.Store(evt.RequestID, span)
+		},
+		Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
+			end(evt.RequestID, "")
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			slog.WarnContext(ctx, "MongoDB command failed", "command", evt.CommandName, "error", evt.Failure)
+			end(evt.RequestID, evt.Failure)
+		},
+	}
+}
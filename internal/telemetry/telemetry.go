@@ -0,0 +1,71 @@
+// Package telemetry exports traces of the services to an OpenTelemetry
+// collector. Spans of HTTP requests, started by Echo, are the parents of the
+// spans of the MongoDB commands they run, so one trace shows both.
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// flushTimeout bounds how long the spans still buffered are exported for
+// when the service stops
+const flushTimeout = 5 * time.Second
+
+// FromEnv exports the traces of service over OTLP/HTTP to
+// OTEL_EXPORTER_OTLP_ENDPOINT, e.g. http://otel-collector:4318, and returns a
+// function flushing the remaining spans. Tracing stays disabled unless the
+// endpoint is set; the other OTEL_* variables of the exporter and
+// OTEL_SERVICE_NAME apply as usual.
+func FromEnv(ctx context.Context, service string) (func(), error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func() {}, nil
+	}
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Attributes from the environment win over the defaults.
+	res, err := resource.Merge(
+		resource.NewSchemaless(semconv.ServiceName(service)),
+		resource.Environment(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	slog.Info("exporting traces over OTLP")
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			slog.Error("cannot flush traces", "error", err)
+		}
+	}, nil
+}
+
+// Middleware starts a span for every request to service, continuing the
+// trace of the caller if it sent a traceparent header. Health probes are
+// not traced.
+func Middleware(service string) echo.MiddlewareFunc {
+	return otelecho.Middleware(service, otelecho.WithSkipper(func(c echo.Context) bool {
+		return c.Path() == "/healthz" || c.Path() == "/readyz"
+	}))
+}
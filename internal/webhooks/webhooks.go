@@ -0,0 +1,122 @@
+// Package webhooks delivers book events to the URLs admins registered
+// through /api/v1/admin/webhooks.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/events"
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+)
+
+// SignatureHeader carries "sha256=" followed by the hex HMAC-SHA256 of the
+// body, keyed with the secret of the webhook
+const SignatureHeader = "X-Bookstore-Signature"
+
+// Retry policy of failed deliveries: the wait doubles after every attempt.
+const (
+	maxAttempts    = 5
+	initialBackoff = time.Second
+	requestTimeout = 10 * time.Second
+)
+
+// Dispatcher posts every event to all registered webhooks
+type Dispatcher struct {
+	store  store.Repository
+	client *http.Client
+}
+
+// New returns a dispatcher delivering to the webhooks stored in st
+func New(st store.Repository) *Dispatcher {
+	return &Dispatcher{store: st, client: &http.Client{Timeout: requestTimeout}}
+}
+
+// Sign returns the value of SignatureHeader for body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Publish delivers ev to every webhook in the background
+func (d *Dispatcher) Publish(ctx context.Context, ev events.Event) {
+	hooks, err := d.store.ListWebhooks(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "cannot load webhooks", "event", ev.Type, "book", ev.Book.ID, "error", err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+	body, err := json.Marshal(ev.Payload())
+	if err != nil {
+		slog.ErrorContext(ctx, "cannot encode event", "event", ev.Type, "book", ev.Book.ID, "error", err)
+		return
+	}
+	for _, hook := range hooks {
+		go d.deliver(hook, ev.Type, body)
+	}
+}
+
+// deliver posts body to hook, retrying with exponential backoff while the
+// receiver is unreachable or answers 429 or 5xx
+func (d *Dispatcher) deliver(hook models.Webhook, eventType string, body []byte) {
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := d.post(hook, eventType, body)
+		if err == nil {
+			return
+		}
+		if attempt == maxAttempts || !retryable(err) {
+			slog.Error("webhook delivery failed, giving up", "event", eventType, "url", hook.URL, "attempts", attempt, "error", err)
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// statusError is a delivery the receiver answered with a non-2xx status
+type statusError int
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("receiver answered %d %s", int(e), http.StatusText(int(e)))
+}
+
+// retryable reports whether a failed delivery may succeed later
+func retryable(err error) bool {
+	if status, ok := err.(statusError); ok {
+		return status == http.StatusTooManyRequests || status >= 500
+	}
+	return true
+}
+
+// post makes one delivery attempt
+func (d *Dispatcher) post(hook models.Webhook, eventType string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Bookstore-Event", eventType)
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return statusError(resp.StatusCode)
+	}
+	return nil
+}
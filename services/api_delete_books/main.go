@@ -2,99 +2,71 @@ package main
 
 import (
 	"context"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
-	"slices"
 	"time"
 
-	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"github.com/CAPS-Cloud/exercises/internal/audit"
+	"github.com/CAPS-Cloud/exercises/internal/config"
+	"github.com/CAPS-Cloud/exercises/internal/events"
+	"github.com/CAPS-Cloud/exercises/internal/handlers"
+	"github.com/CAPS-Cloud/exercises/internal/history"
+	"github.com/CAPS-Cloud/exercises/internal/logging"
+	"github.com/CAPS-Cloud/exercises/internal/server"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/CAPS-Cloud/exercises/internal/telemetry"
+	"github.com/CAPS-Cloud/exercises/internal/webhooks"
 )
 
-// BookStore model
-type BookStore struct {
-	MongoID     primitive.ObjectID `bson:"_id,omitempty"`
-	ID          string             `bson:"ID"`
-	BookName    string             `bson:"BookName"`
-	BookAuthor  string             `bson:"BookAuthor"`
-	BookEdition string             `bson:"BookEdition"`
-	BookPages   string             `bson:"BookPages"`
-	BookYear    string             `bson:"BookYear"`
-}
-
-// prepareDatabase initializes the database and collection
-func prepareDatabase(client *mongo.Client, dbName string, collecName string) (*mongo.Collection, error) {
-	db := client.Database(dbName)
-	names, err := db.ListCollectionNames(context.TODO(), bson.D{{}})
+func main() {
+	conf, err := config.Load("3004")
 	if err != nil {
-		return nil, err
+		logging.Fatal("failed to load configuration", "error", err)
 	}
-	if !slices.Contains(names, collecName) {
-		cmd := bson.D{{"create", collecName}}
-		var result bson.M
-		if err = db.RunCommand(context.TODO(), cmd).Decode(&result); err != nil {
-			log.Printf("Failed to create collection: %v", err)
-			return nil, err
-		}
+	if err := logging.Setup("api_delete_books", conf.Log.Level, conf.Log.Format); err != nil {
+		logging.Fatal("failed to set up logging", "error", err)
 	}
-	coll := db.Collection(collecName)
-	return coll, nil
-}
-
-func main() {
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	storeConf := conf.Store()
+	ctx, cancel := context.WithTimeout(context.Background(), storeConf.ConnectRetry+20*time.Second)
 	defer cancel()
 
-	uri := os.Getenv("DATABASE_URI")
-	if uri == "" {
-		log.Println("DATABASE_URI not set, using default localhost URI")
-		uri = "mongodb://localhost:27017/exercise-1?authSource=admin"
+	stopTracing, err := telemetry.FromEnv(ctx, "api_delete_books")
+	if err != nil {
+		logging.Fatal("failed to set up tracing", "error", err)
 	}
+	defer stopTracing()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	st, err := store.New(ctx, storeConf)
 	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
+		logging.Fatal("failed to open storage", "error", err)
 	}
-
 	defer func() {
-		if err = client.Disconnect(ctx); err != nil {
-			log.Printf("Error disconnecting from MongoDB: %v", err)
+		if err := st.Close(context.Background()); err != nil {
+			slog.Error("cannot close storage", "error", err)
 		}
 	}()
 
-	if err := client.Ping(ctx, nil); err != nil {
-		log.Fatalf("Failed to ping MongoDB: %v", err)
-	}
-	log.Println("Successfully connected and pinged MongoDB.")
-
-	coll, err := prepareDatabase(client, "exercise-1", "information")
+	pubs, closeBus, err := events.PublishersFromEnv(ctx)
 	if err != nil {
-		log.Fatalf("Failed to prepare database: %v", err)
+		logging.Fatal("failed to set up event publishers", "error", err)
 	}
+	defer closeBus()
+	st = audit.Wrap(st)
+	st = history.Wrap(st)
+	st = events.Wrap(st, append(pubs, webhooks.New(st))...)
 
-	e := echo.New()
-	e.Use(middleware.Logger())
-
-	// DELETE /api/books/:id
-	e.DELETE("/api/books/:id", func(c echo.Context) error {
-		id := c.Param("id")
-		res, err := coll.DeleteOne(context.TODO(), bson.M{"ID": id})
-		if err != nil {
-			log.Printf("Error in DELETE /api/books/:id (DeleteOne): %v", err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "db error"})
-		}
-		if res.DeletedCount == 0 {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "book not found"}) // Changed to 404
-		}
-		return c.JSON(http.StatusOK, map[string]string{"message": "book deleted", "id": id})
-	})
+	api := handlers.New(st, handlers.Config{JWTSecret: os.Getenv("JWT_SECRET")})
 
-	port := "3004"
-	log.Printf("API Delete Books service starting on port %s", port)
-	e.Logger.Fatal(e.Start(":" + port))
+	e := server.New(conf.Server())
+	e.Use(telemetry.Middleware("api_delete_books"))
+	server.MountHealth(e, map[string]server.Check{"database": st.Ping})
+	limit, err := server.RateLimitFromEnv()
+	if err != nil {
+		logging.Fatal("failed to set up rate limiting", "error", err)
+	}
+	if limit != nil {
+		e.Use(limit)
+	}
+	server.MountAPI(e, api.RegisterDelete)
+	server.Start(e, "API Delete Books", conf.Listener())
 }
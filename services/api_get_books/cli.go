@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/config"
+	"github.com/CAPS-Cloud/exercises/internal/handlers"
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+)
+
+// usage describes the commands of the binary
+const usage = `Usage: api_get_books [command] [flags]
+
+Commands:
+  serve     serve the API (the default)
+  seed      insert the books of a JSON or YAML file that are not stored yet
+  export    write every book to stdout as CSV or NDJSON
+  migrate   create the tables, collections and indexes of the storage and
+            apply pending migrations
+
+The storage is configured like for serve. Run a command with -h for its flags.
+`
+
+// errUsage is returned by commands called with wrong arguments, after the
+// flag package has explained what is wrong
+var errUsage = errors.New("wrong usage")
+
+// run runs the command named by args[0], serve if there is none, and
+// returns the exit code of the process. The commands other than serve use
+// the same storage code as the service without starting the HTTP server.
+func run(conf config.Config, args []string) int {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	var err error
+	switch name {
+	case "serve":
+		serve(conf)
+		return 0
+	case "seed":
+		err = seedCommand(conf, args)
+	case "export":
+		err = exportCommand(conf, args, os.Stdout)
+	case "migrate":
+		err = migrateCommand(conf, args)
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", name, usage)
+		return 2
+	}
+	if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+		return 2
+	}
+	if err != nil {
+		slog.Error(name+" failed", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// parseFlags parses the flags of command from args, which must not have
+// any other arguments
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// withStore opens the storage, which applies pending migrations, calls fn
+// with it and closes it again
+func withStore(conf config.Config, fn func(ctx context.Context, st store.Repository) error) error {
+	storeConf := conf.Store()
+	ctx, cancel := context.WithTimeout(context.Background(), storeConf.ConnectRetry+20*time.Second)
+	defer cancel()
+	st, err := store.New(ctx, storeConf)
+	if err != nil {
+		return fmt.Errorf("cannot open storage: %w", err)
+	}
+	defer func() {
+		if err := st.Close(context.Background()); err != nil {
+			slog.Error("cannot close storage", "error", err)
+		}
+	}()
+	return fn(context.Background(), st)
+}
+
+// seedBooks returns the books in the seed file at path, or the example
+// books if path is empty
+func seedBooks(path string) ([]models.BookStore, error) {
+	if path == "" {
+		return store.ExampleBooks, nil
+	}
+	return store.ReadSeedFile(path)
+}
+
+// seedCommand runs `seed [--file books.json]`: it inserts the books of the
+// file, by default SEED_FILE or else the example books, that are not
+// stored yet
+func seedCommand(conf config.Config, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	file := fs.String("file", conf.DB.SeedFile, "JSON or YAML `file` with a list of books as taken by POST /api/v1/books/import; the example books if empty")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	books, err := seedBooks(*file)
+	if err != nil {
+		return err
+	}
+	return withStore(conf, func(ctx context.Context, st store.Repository) error {
+		return store.SeedBooks(ctx, st, books)
+	})
+}
+
+// exportCommand runs `export [--format csv|ndjson]`: it writes every book
+// to w as GET /api/v1/books/export.csv or export.ndjson would
+func exportCommand(conf config.Config, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "csv", "`format` of the export: csv or ndjson")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	return withStore(conf, func(ctx context.Context, st store.Repository) error {
+		return handlers.WriteBooks(ctx, st, w, *format)
+	})
+}
+
+// migrateCommand runs `migrate`: opening the storage brings its schema up
+// to date, and the text index of the search is created as serve would
+func migrateCommand(conf config.Config, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	return withStore(conf, func(ctx context.Context, st store.Repository) error {
+		if err := st.EnsureTextIndex(ctx); err != nil {
+			return fmt.Errorf("cannot create text index: %w", err)
+		}
+		slog.Info("storage is up to date")
+		return nil
+	})
+}
@@ -2,173 +2,132 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"log"
-	"net/http"
+	_ "embed"
+	"log/slog"
 	"os"
-	"slices"
 	"time"
 
-	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"github.com/CAPS-Cloud/exercises/internal/cache"
+	"github.com/CAPS-Cloud/exercises/internal/config"
+	"github.com/CAPS-Cloud/exercises/internal/handlers"
+	"github.com/CAPS-Cloud/exercises/internal/logging"
+	"github.com/CAPS-Cloud/exercises/internal/server"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/CAPS-Cloud/exercises/internal/telemetry"
 )
 
-// BookStore model
-type BookStore struct {
-	MongoID     primitive.ObjectID `bson:"_id,omitempty"`
-	ID          string             `bson:"ID"`
-	BookName    string             `bson:"BookName"`
-	BookAuthor  string             `bson:"BookAuthor"`
-	BookEdition string             `bson:"BookEdition"`
-	BookPages   string             `bson:"BookPages"`
-	BookYear    string             `bson:"BookYear"`
-}
+// openAPISpec is the hand-maintained OpenAPI 3 document for all /api endpoints.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// Build metadata, injected at build time with
+// -ldflags "-X main.version=... -X main.gitCommit=... -X main.buildTime=...".
+var (
+	version   = "dev"
+	gitCommit = "unknown"
+	buildTime = "unknown"
+)
 
-// prepareDatabase initializes the database and collection
-func prepareDatabase(client *mongo.Client, dbName string, collecName string) (*mongo.Collection, error) {
-	db := client.Database(dbName)
-	names, err := db.ListCollectionNames(context.TODO(), bson.D{{}})
+func main() {
+	conf, err := config.Load("3001")
 	if err != nil {
-		return nil, err
-	}
-	if !slices.Contains(names, collecName) {
-		cmd := bson.D{{"create", collecName}}
-		var result bson.M
-		if err = db.RunCommand(context.TODO(), cmd).Decode(&result); err != nil {
-			log.Printf("Failed to create collection: %v", err)
-			return nil, err
-		}
+		logging.Fatal("failed to load configuration", "error", err)
 	}
-	coll := db.Collection(collecName)
-	return coll, nil
-}
-
-// prepareData seeds the database with initial data if it doesn't exist
-func prepareData(coll *mongo.Collection) {
-	startData := []BookStore{
-		{ID: "example1", BookName: "The Vortex", BookAuthor: "José Eustasio Rivera", BookEdition: "958-30-0804-4", BookPages: "292", BookYear: "1924"},
-		{ID: "example2", BookName: "Frankenstein", BookAuthor: "Mary Shelley", BookEdition: "978-3-649-64609-9", BookPages: "280", BookYear: "1818"},
-		{ID: "example3", BookName: "The Black Cat", BookAuthor: "Edgar Allan Poe", BookEdition: "978-3-99168-238-7", BookPages: "280", BookYear: "1843"},
-	}
-
-	for _, book := range startData {
-		filter := bson.M{"ID": book.ID}
-		count, err := coll.CountDocuments(context.TODO(), filter)
-		if err != nil {
-			log.Printf("Error counting documents for book ID %s: %v", book.ID, err)
-			continue
-		}
-		if count == 0 {
-			if _, err := coll.InsertOne(context.TODO(), book); err != nil {
-				log.Printf("Error inserting book ID %s: %v", book.ID, err)
-			} else {
-				fmt.Printf("Inserted book: %+v\n", book.BookName)
-			}
-		} else {
-			// fmt.Printf("Book ID %s already exists.\n", book.ID)
-		}
+	if err := logging.Setup("api_get_books", conf.Log.Level, conf.Log.Format); err != nil {
+		logging.Fatal("failed to set up logging", "error", err)
 	}
+	os.Exit(run(conf, os.Args[1:]))
 }
 
-// findAllBooks retrieves all books from the collection
-func findAllBooks(coll *mongo.Collection) ([]map[string]interface{}, error) {
-	cursor, err := coll.Find(context.TODO(), bson.D{{}})
-	if err != nil {
-		return nil, err
-	}
-	var results []BookStore
-	if err = cursor.All(context.TODO(), &results); err != nil {
-		return nil, err
-	}
-
-	var ret []map[string]interface{}
-	for _, res := range results {
-		ret = append(ret, map[string]interface{}{
-			"id":      res.ID,
-			"title":   res.BookName,
-			"author":  res.BookAuthor,
-			"pages":   res.BookPages,
-			"edition": res.BookEdition,
-			"year":    res.BookYear,
-		})
-	}
-	return ret, nil
-}
+// serve runs the service until it is stopped
+func serve(conf config.Config) {
+	storeConf := conf.Store()
 
-func main() {
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second) // Increased timeout
+	// The startup may first wait for the database to come up.
+	ctx, cancel := context.WithTimeout(context.Background(), storeConf.ConnectRetry+20*time.Second)
 	defer cancel()
 
-	uri := os.Getenv("DATABASE_URI")
-	if uri == "" {
-		log.Println("DATABASE_URI not set, using default localhost URI")
-		uri = "mongodb://localhost:27017/exercise-1?authSource=admin"
+	stopTracing, err := telemetry.FromEnv(ctx, "api_get_books")
+	if err != nil {
+		logging.Fatal("failed to set up tracing", "error", err)
 	}
+	defer stopTracing()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	st, err := store.New(ctx, storeConf)
 	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
+		logging.Fatal("failed to open storage", "error", err)
 	}
-
 	defer func() {
-		if err = client.Disconnect(ctx); err != nil {
-			log.Printf("Error disconnecting from MongoDB: %v", err)
+		if err := st.Close(context.Background()); err != nil {
+			slog.Error("cannot close storage", "error", err)
 		}
 	}()
 
-	// Ping the primary
-	if err := client.Ping(ctx, nil); err != nil {
-		log.Fatalf("Failed to ping MongoDB: %v", err)
-	}
-	log.Println("Successfully connected and pinged MongoDB.")
-
-	coll, err := prepareDatabase(client, "exercise-1", "information")
+	// Books already stored are skipped, so every start may seed. The seed
+	// command does the same as a separate job.
+	books, err := seedBooks(conf.DB.SeedFile)
 	if err != nil {
-		log.Fatalf("Failed to prepare database: %v", err)
+		logging.Fatal("failed to read SEED_FILE", "error", err)
+	}
+	if err := store.SeedBooks(ctx, st, books); err != nil {
+		slog.Error("cannot seed books", "error", err)
 	}
 
-	// It's usually better to run data seeding as a separate job or ensure idempotency.
-	// For this exercise, running it on startup of the GET service is acceptable.
-	prepareData(coll)
+	if err := st.EnsureTextIndex(ctx); err != nil {
+		logging.Fatal("failed to create text index", "error", err)
+	}
 
-	e := echo.New()
-	e.Use(middleware.Logger())
+	// watchCtx ends the change streams of the hub and the cache when the
+	// service stops.
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
 
-	e.GET("/api/books", func(c echo.Context) error {
-		books, err := findAllBooks(coll)
-		if err != nil {
-			log.Printf("Error in GET /api/books (findAllBooks): %v", err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	apiConf := handlers.Config{
+		JWTSecret:   os.Getenv("JWT_SECRET"),
+		OpenAPISpec: openAPISpec,
+		Build:       handlers.BuildInfo{Version: version, GitCommit: gitCommit, BuildTime: buildTime},
+	}
+	// With Redis, the write services drop the cached responses of the books
+	// they change, so they need the same REDIS_URI. The in-process cache
+	// follows the change stream instead.
+	respCache, closeCache, err := cache.FromEnv(ctx)
+	if err != nil {
+		logging.Fatal("failed to set up the response cache", "error", err)
+	}
+	defer closeCache()
+	apiConf.Cache = respCache
+	if mc, ok := respCache.(*cache.Memory); ok {
+		if events, err := st.WatchBooks(watchCtx); err != nil {
+			slog.Warn("cached responses may be stale for up to CACHE_TTL", "error", err)
+		} else {
+			go mc.Follow(events)
 		}
-		return c.JSON(http.StatusOK, books)
-	})
+	}
+	api := handlers.New(st, apiConf)
+
+	// The hub watches books for as long as the service runs, so it does not
+	// use the startup context.
+	hub := handlers.NewHub()
+	if events, err := st.WatchBooks(watchCtx); err != nil {
+		slog.Warn("WebSocket updates disabled", "error", err)
+	} else {
+		go hub.Run(events)
+	}
 
-	e.GET("/api/books/:id", func(c echo.Context) error {
-		id := c.Param("id")
-		var result BookStore
-		err := coll.FindOne(context.TODO(), bson.M{"ID": id}).Decode(&result)
-		if err != nil {
-			if err == mongo.ErrNoDocuments {
-				return c.NoContent(http.StatusNotFound) // Changed to 404 Not Found
-			}
-			log.Printf("Error in GET /api/books/:id (FindOne): %v", err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "db error"})
-		}
-		return c.JSON(http.StatusOK, map[string]interface{}{
-			"id":      result.ID,
-			"title":   result.BookName,
-			"author":  result.BookAuthor,
-			"pages":   result.BookPages,
-			"edition": result.BookEdition,
-			"year":    result.BookYear,
-		})
+	e := server.New(conf.Server())
+	e.Use(telemetry.Middleware("api_get_books"))
+	checks := map[string]server.Check{"database": st.Ping}
+	if rc, ok := respCache.(*cache.Redis); ok {
+		checks["cache"] = rc.Ping
+	}
+	server.MountHealth(e, checks)
+	server.MountAPI(e, api.RegisterGet)
+	e.GET("/ws", hub.Serve)
+	// Event streams and WebSockets never finish on their own.
+	e.Server.RegisterOnShutdown(func() {
+		api.CloseStreams()
+		stopWatching()
 	})
-
-	port := "3001"
-	log.Printf("API Get Books service starting on port %s", port)
-	e.Logger.Fatal(e.Start(":" + port))
+	server.Start(e, "API Get Books", conf.Listener())
 }
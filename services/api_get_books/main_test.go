@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/CAPS-Cloud/exercises/internal/handlers"
+	"github.com/CAPS-Cloud/exercises/internal/server"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// pathParam matches the parameters of echo routes, like :id
+var pathParam = regexp.MustCompile(`:([a-z_]+)`)
+
+// newTestServer serves every route of the API, as the API services do
+// together, with the OpenAPI document of this service
+func newTestServer(build handlers.BuildInfo) *echo.Echo {
+	e := server.New(server.Options{})
+	api := handlers.New(store.NewMemory(), handlers.Config{OpenAPISpec: openAPISpec, Build: build})
+	server.MountAPI(e, func(g *echo.Group) {
+		api.RegisterGet(g)
+		api.RegisterPost(g)
+		api.RegisterPut(g)
+		api.RegisterDelete(g)
+	})
+	return e
+}
+
+// TestOpenAPIDocumentsEveryRoute keeps the hand-maintained document in step
+// with the routes: every route of /api/v1 must be in it, and everything in
+// it must be a route.
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	e := newTestServer(handlers.BuildInfo{})
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/v1/openapi.json = %d", rec.Code)
+	}
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("openapi = %q, want an OpenAPI 3 document", spec.OpenAPI)
+	}
+
+	routes := map[string]bool{}
+	for _, r := range e.Routes() {
+		path, ok := strings.CutPrefix(r.Path, "/api/v1")
+		if !ok || path == "" || strings.HasSuffix(path, "*") {
+			continue
+		}
+		path = pathParam.ReplaceAllString(path, "{$1}")
+		key := strings.ToLower(r.Method) + " " + path
+		routes[key] = true
+		if _, ok := spec.Paths[path][strings.ToLower(r.Method)]; !ok {
+			t.Errorf("%s %s is not documented in openapi.json", r.Method, path)
+		}
+	}
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			switch method {
+			case "get", "post", "put", "patch", "delete":
+				if !routes[method+" "+path] {
+					t.Errorf("openapi.json documents %s %s, which is not a route", strings.ToUpper(method), path)
+				}
+			}
+		}
+	}
+}
+
+// TestVersionDefaults checks what a build without -ldflags reports
+func TestVersionDefaults(t *testing.T) {
+	e := newTestServer(handlers.BuildInfo{Version: version, GitCommit: gitCommit, BuildTime: buildTime})
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/version", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/v1/version = %d", rec.Code)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("cannot decode %q: %v", rec.Body.String(), err)
+	}
+	want := map[string]string{"version": "dev", "git_commit": "unknown", "build_time": "unknown"}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %q, want %q", key, got[key], value)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/audit"
+	"github.com/CAPS-Cloud/exercises/internal/config"
+	"github.com/CAPS-Cloud/exercises/internal/events"
+	"github.com/CAPS-Cloud/exercises/internal/handlers"
+	"github.com/CAPS-Cloud/exercises/internal/history"
+	"github.com/CAPS-Cloud/exercises/internal/logging"
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/problem"
+	"github.com/CAPS-Cloud/exercises/internal/server"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/CAPS-Cloud/exercises/internal/telemetry"
+	"github.com/CAPS-Cloud/exercises/internal/webhooks"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/labstack/echo/v4"
+)
+
+// bookType mirrors the JSON book of the REST API
+var bookType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Book",
+	Fields: graphql.Fields{
+		"id":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"title":    &graphql.Field{Type: graphql.String},
+		"author":   &graphql.Field{Type: graphql.String},
+		"pages":    &graphql.Field{Type: graphql.String},
+		"edition":  &graphql.Field{Type: graphql.String},
+		"year":     &graphql.Field{Type: graphql.String},
+		"revision": &graphql.Field{Type: graphql.Int},
+	},
+})
+
+// bookInputType holds the writable fields of a book
+var bookInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "BookInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"title":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"author":  &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"pages":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"edition": &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"year":    &graphql.InputObjectFieldConfig{Type: graphql.String},
+	},
+})
+
+// newSchema builds the GraphQL schema on top of the same store the REST
+// services use, so both APIs always see the same data. Like POST
+// /api/v1/books, createBook stores no more than maxBooks books, unless it is 0.
+func newSchema(st store.Repository, maxBooks int64) (graphql.Schema, error) {
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"books": &graphql.Field{
+				Type: graphql.NewList(bookType),
+				Args: graphql.FieldConfigArgument{
+					"author": &graphql.ArgumentConfig{Type: graphql.String},
+					"year":   &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var q store.BookQuery
+					if author, ok := p.Args["author"].(string); ok {
+						q.Conditions = append(q.Conditions, store.Condition{Field: "author", Op: "eq", Value: author})
+					}
+					if year, ok := p.Args["year"].(string); ok {
+						q.Conditions = append(q.Conditions, store.Condition{Field: "year", Op: "eq", Value: year})
+					}
+					books, _, err := st.ListBooks(p.Context, q)
+					if err != nil {
+						return nil, err
+					}
+					ret := make([]map[string]interface{}, 0, len(books))
+					for _, book := range books {
+						ret = append(ret, book.ToMap())
+					}
+					return ret, nil
+				},
+			},
+			"book": &graphql.Field{
+				Type: bookType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					book, err := st.GetBook(p.Context, p.Args["id"].(string))
+					if errors.Is(err, store.ErrNotFound) {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, err
+					}
+					return book.ToMap(), nil
+				},
+			},
+			"authors": &graphql.Field{
+				Type: graphql.NewList(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return st.Distinct(p.Context, "author")
+				},
+			},
+			"years": &graphql.Field{
+				Type: graphql.NewList(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return st.Distinct(p.Context, "year")
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createBook": &graphql.Field{
+				Type: bookType,
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(bookInputType)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id := p.Args["id"].(string)
+					input := p.Args["input"].(map[string]interface{})
+					book := models.BookStore{ID: id}
+					book.BookName, _ = input["title"].(string)
+					book.BookAuthor, _ = input["author"].(string)
+					book.BookPages, _ = input["pages"].(string)
+					book.BookEdition, _ = input["edition"].(string)
+					book.BookYear, _ = input["year"].(string)
+					if errs := book.Validate(); len(errs) > 0 {
+						return nil, validationError(errs)
+					}
+					remaining, err := store.RemainingQuota(p.Context, st, maxBooks)
+					if err != nil {
+						return nil, err
+					}
+					if remaining == 0 {
+						return nil, errQuotaExceeded
+					}
+					err = st.CreateBook(p.Context, book)
+					if errors.Is(err, store.ErrDuplicate) {
+						return nil, errors.New("duplicate entry for ID: " + id)
+					}
+					if err != nil {
+						return nil, err
+					}
+					book.Revision = 1 // as stored by CreateBook
+					return book.ToMap(), nil
+				},
+			},
+			"updateBook": &graphql.Field{
+				Type: bookType,
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(bookInputType)},
+					// The revision the client read; omitted, the update is
+					// unconditional.
+					"revision": &graphql.ArgumentConfig{Type: graphql.Int},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					// Like PUT /api/v1/books/:id, empty fields are left unchanged.
+					fields := map[string]string{}
+					for name, value := range p.Args["input"].(map[string]interface{}) {
+						if s, ok := value.(string); ok && s != "" {
+							fields[name] = s
+						}
+					}
+					if len(fields) == 0 {
+						return nil, errors.New("no fields to update")
+					}
+					if errs := models.ValidateFields(fields); len(errs) > 0 {
+						return nil, validationError(errs)
+					}
+					revision, _ := p.Args["revision"].(int)
+					book, err := st.UpdateBook(p.Context, p.Args["id"].(string), int64(revision), fields)
+					if errors.Is(err, store.ErrNotFound) {
+						return nil, errors.New("book not found")
+					}
+					if errors.Is(err, store.ErrConflict) {
+						return nil, errors.New("book has been changed since it was read")
+					}
+					if err != nil {
+						return nil, err
+					}
+					return book.ToMap(), nil
+				},
+			},
+			"deleteBook": &graphql.Field{
+				Type: graphql.Boolean,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					err := st.DeleteBook(p.Context, p.Args["id"].(string))
+					if errors.Is(err, store.ErrNotFound) {
+						return false, nil
+					}
+					return err == nil, err
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+// errQuotaExceeded is returned by createBook once MAX_BOOKS books are stored
+var errQuotaExceeded = errors.New("book quota exceeded")
+
+// validationError reports the per-field problems of a book input. They are
+// listed in the "fields" extension of the GraphQL error.
+type validationError map[string]string
+
+func (e validationError) Error() string {
+	return "validation failed: " + models.DescribeProblems(e)
+}
+
+func (e validationError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": "BAD_USER_INPUT", "fields": map[string]string(e)}
+}
+
+// graphQLRequest is the standard GraphQL-over-HTTP request body
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    map[string]interface{} `json:"extensions"` // sent by some clients, ignored
+}
+
+// operation returns the operation of req that graphql.Do runs, in the
+// document it is part of, or nil if the query does not parse or does not
+// pick exactly one operation, which graphql.Do then reports without running
+// anything
+func operation(req graphQLRequest) (*ast.Document, *ast.OperationDefinition) {
+	doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+	if err != nil {
+		return nil, nil
+	}
+	var found *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if req.OperationName == "" {
+			if found != nil {
+				return doc, nil
+			}
+			found = op
+		} else if op.Name != nil && op.Name.Value == req.OperationName {
+			found = op
+		}
+	}
+	return doc, found
+}
+
+// mutationRoles are the roles the mutations need, those of the REST routes
+// doing the same: editors create and change books, only admins move them
+// to the trash
+var mutationRoles = map[string]string{
+	"createBook": models.RoleEditor,
+	"updateBook": models.RoleEditor,
+	"deleteBook": models.RoleAdmin,
+}
+
+// requiredRole returns the role the mutation op of doc needs: the highest
+// of those of the mutations it selects, also through fragments
+func requiredRole(doc *ast.Document, op *ast.OperationDefinition) string {
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, def := range doc.Definitions {
+		if f, ok := def.(*ast.FragmentDefinition); ok && f.Name != nil {
+			fragments[f.Name.Value] = f
+		}
+	}
+	role := models.RoleEditor
+	seen := map[string]bool{}
+	var walk func(set *ast.SelectionSet)
+	walk = func(set *ast.SelectionSet) {
+		if set == nil {
+			return
+		}
+		for _, sel := range set.Selections {
+			switch sel := sel.(type) {
+			case *ast.Field:
+				if need, ok := mutationRoles[sel.Name.Value]; ok && models.HasRole(need, role) {
+					role = need
+				}
+			case *ast.InlineFragment:
+				walk(sel.SelectionSet)
+			case *ast.FragmentSpread:
+				if f := fragments[sel.Name.Value]; f != nil && !seen[sel.Name.Value] {
+					seen[sel.Name.Value] = true
+					walk(f.SelectionSet)
+				}
+			}
+		}
+	}
+	walk(op.SelectionSet)
+	return role
+}
+
+// registerGraphQL serves schema at /graphql, with queries via GET
+// (?query=) and POST (JSON body). Mutations are only taken by POST, so that
+// links, images and prefetching cannot change books, and need a bearer
+// token or API key of the role requiredRole names, checked by api like for
+// the REST routes.
+func registerGraphQL(e *echo.Echo, schema graphql.Schema, api *handlers.API) {
+	execute := func(c echo.Context) error {
+		var req graphQLRequest
+		if c.Request().Method == http.MethodGet {
+			req.Query = c.QueryParam("query")
+			req.OperationName = c.QueryParam("operationName")
+		} else if err := c.Bind(&req); err != nil {
+			// The error names the unknown or mistyped field
+			return err
+		}
+		if req.Query == "" {
+			return problem.Respond(c, http.StatusBadRequest, "query is required")
+		}
+		run := func(c echo.Context) error {
+			result := graphql.Do(graphql.Params{
+				Schema:         schema,
+				RequestString:  req.Query,
+				VariableValues: req.Variables,
+				OperationName:  req.OperationName,
+				// Mutations are audited as made by the caller, see
+				// handlers.API.RequireRole.
+				Context: c.Request().Context(),
+			})
+			return c.JSON(http.StatusOK, result)
+		}
+		doc, op := operation(req)
+		if op == nil || op.Operation == ast.OperationTypeQuery {
+			return run(c)
+		}
+		if c.Request().Method == http.MethodGet {
+			c.Response().Header().Set(echo.HeaderAllow, http.MethodPost)
+			return problem.Respond(c, http.StatusMethodNotAllowed, op.Operation+" operations must be sent with POST")
+		}
+		return api.RequireRole(requiredRole(doc, op))(run)(c)
+	}
+	e.GET("/graphql", execute)
+	e.POST("/graphql", execute)
+}
+
+func main() {
+	conf, err := config.Load("3006")
+	if err != nil {
+		logging.Fatal("failed to load configuration", "error", err)
+	}
+	if err := logging.Setup("api_graphql", conf.Log.Level, conf.Log.Format); err != nil {
+		logging.Fatal("failed to set up logging", "error", err)
+	}
+	storeConf := conf.Store()
+	ctx, cancel := context.WithTimeout(context.Background(), storeConf.ConnectRetry+20*time.Second)
+	defer cancel()
+
+	stopTracing, err := telemetry.FromEnv(ctx, "api_graphql")
+	if err != nil {
+		logging.Fatal("failed to set up tracing", "error", err)
+	}
+	defer stopTracing()
+
+	st, err := store.New(ctx, storeConf)
+	if err != nil {
+		logging.Fatal("failed to open storage", "error", err)
+	}
+	defer func() {
+		if err := st.Close(context.Background()); err != nil {
+			slog.Error("cannot close storage", "error", err)
+		}
+	}()
+
+	pubs, closeBus, err := events.PublishersFromEnv(ctx)
+	if err != nil {
+		logging.Fatal("failed to set up event publishers", "error", err)
+	}
+	defer closeBus()
+	st = audit.Wrap(st)
+	st = history.Wrap(st)
+	st = events.Wrap(st, append(pubs, webhooks.New(st))...)
+
+	schema, err := newSchema(st, conf.DB.MaxBooks)
+	if err != nil {
+		logging.Fatal("failed to build GraphQL schema", "error", err)
+	}
+
+	e := server.New(conf.Server())
+	e.Use(telemetry.Middleware("api_graphql"))
+	server.MountHealth(e, map[string]server.Check{"database": st.Ping})
+	// Mutations write like the REST services do, so they are limited alike.
+	limit, err := server.RateLimitFromEnv()
+	if err != nil {
+		logging.Fatal("failed to set up rate limiting", "error", err)
+	}
+	if limit != nil {
+		e.Use(limit)
+	}
+
+	registerGraphQL(e, schema, handlers.New(st, handlers.Config{JWTSecret: os.Getenv("JWT_SECRET")}))
+
+	server.Start(e, "API GraphQL", conf.Listener())
+}
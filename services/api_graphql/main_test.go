@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/handlers"
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/server"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// testSecret signs the tokens of the tests
+const testSecret = "test-secret"
+
+// newTestServer serves GraphQL on top of st with JWT_SECRET set, storing
+// up to maxBooks books
+func newTestServer(t *testing.T, st store.Repository, maxBooks int64) *echo.Echo {
+	t.Helper()
+	schema, err := newSchema(st, maxBooks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := server.New(server.Options{})
+	registerGraphQL(e, schema, handlers.New(st, handlers.Config{JWTSecret: testSecret}))
+	return e
+}
+
+// token returns a bearer token of user with role
+func token(t *testing.T, user, role string) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":  user,
+		"role": role,
+		"exp":  time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + signed
+}
+
+// post sends query to e, with the Authorization header auth unless empty
+func post(e *echo.Echo, query, auth string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(graphQLRequest{Query: query})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if auth != "" {
+		req.Header.Set(echo.HeaderAuthorization, auth)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// createMutation creates the book Frankenstein with ID 1
+const createMutation = `mutation { createBook(id: "1", input: {title: "Frankenstein", author: "Mary Shelley"}) { id revision } }`
+
+func TestMutationsNeedToken(t *testing.T) {
+	st := store.NewMemory()
+	e := newTestServer(t, st, 0)
+
+	for _, auth := range []string{"", "Bearer not-a-token"} {
+		if rec := post(e, createMutation, auth); rec.Code != http.StatusUnauthorized {
+			t.Errorf("createBook with %q = %d, want 401; body %s", auth, rec.Code, rec.Body.String())
+		}
+	}
+	if _, err := st.GetBook(context.Background(), "1"); err == nil {
+		t.Fatal("a mutation without a valid token stored the book")
+	}
+
+	rec := post(e, createMutation, token(t, "ada", models.RoleEditor))
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), `"errors"`) {
+		t.Fatalf("createBook as editor = %d %s", rec.Code, rec.Body.String())
+	}
+	if _, err := st.GetBook(context.Background(), "1"); err != nil {
+		t.Errorf("GetBook after createBook: %v", err)
+	}
+
+	// Queries stay open.
+	rec = post(e, `{ books { id title } }`, "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Frankenstein") {
+		t.Errorf("books without token = %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDeleteBookNeedsAdmin(t *testing.T) {
+	st := store.NewMemory()
+	if err := st.CreateBook(context.Background(), models.BookStore{ID: "1", BookName: "Frankenstein"}); err != nil {
+		t.Fatal(err)
+	}
+	e := newTestServer(t, st, 0)
+	editor := token(t, "bob", models.RoleEditor)
+
+	for _, mutation := range []string{
+		`mutation { deleteBook(id: "1") }`,
+		// Hiding it among other mutations or in fragments does not help.
+		`mutation { updateBook(id: "1", input: {year: "1818"}) { id } deleteBook(id: "1") }`,
+		`mutation { ...trash } fragment trash on Mutation { deleteBook(id: "1") }`,
+		`mutation { ... on Mutation { gone: deleteBook(id: "1") } }`,
+	} {
+		if rec := post(e, mutation, editor); rec.Code != http.StatusForbidden {
+			t.Errorf("%s as editor = %d, want 403; body %s", mutation, rec.Code, rec.Body.String())
+		}
+	}
+	if _, err := st.GetBook(context.Background(), "1"); err != nil {
+		t.Fatalf("an editor deleted the book: %v", err)
+	}
+	// Editors may still change books.
+	if rec := post(e, `mutation { updateBook(id: "1", input: {year: "1818"}) { id } }`, editor); rec.Code != http.StatusOK {
+		t.Errorf("updateBook as editor = %d; body %s", rec.Code, rec.Body.String())
+	}
+
+	rec := post(e, `mutation { deleteBook(id: "1") }`, token(t, "ada", models.RoleAdmin))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"deleteBook":true`) {
+		t.Fatalf("deleteBook as admin = %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestGetRunsOnlyQueries(t *testing.T) {
+	st := store.NewMemory()
+	e := newTestServer(t, st, 0)
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/graphql?query="+url.QueryEscape(query), nil)
+		req.Header.Set(echo.HeaderAuthorization, token(t, "ada", models.RoleAdmin))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get(createMutation)
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get(echo.HeaderAllow) != http.MethodPost {
+		t.Errorf("GET mutation = %d, Allow %q; want 405, POST", rec.Code, rec.Header().Get(echo.HeaderAllow))
+	}
+	if _, err := st.GetBook(context.Background(), "1"); err == nil {
+		t.Fatal("GET stored the book")
+	}
+	if rec := get(`query { books { id } }`); rec.Code != http.StatusOK {
+		t.Errorf("GET query = %d; body %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCreateBookOverQuota(t *testing.T) {
+	st := store.NewMemory()
+	e := newTestServer(t, st, 1)
+	editor := token(t, "bob", models.RoleEditor)
+	if rec := post(e, createMutation, editor); strings.Contains(rec.Body.String(), `"errors"`) {
+		t.Fatalf("first createBook = %s", rec.Body.String())
+	}
+	rec := post(e, `mutation { createBook(id: "2", input: {title: "The Last Man", author: "Mary Shelley"}) { id } }`, editor)
+	if !strings.Contains(rec.Body.String(), errQuotaExceeded.Error()) {
+		t.Errorf("createBook over quota = %s, want %q", rec.Body.String(), errQuotaExceeded)
+	}
+	if _, err := st.GetBook(context.Background(), "2"); err == nil {
+		t.Error("createBook stored a book over the quota")
+	}
+}
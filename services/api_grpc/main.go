@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/api_grpc/bookpb"
+	"github.com/CAPS-Cloud/exercises/internal/audit"
+	"github.com/CAPS-Cloud/exercises/internal/config"
+	"github.com/CAPS-Cloud/exercises/internal/events"
+	"github.com/CAPS-Cloud/exercises/internal/history"
+	"github.com/CAPS-Cloud/exercises/internal/logging"
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/CAPS-Cloud/exercises/internal/telemetry"
+	"github.com/CAPS-Cloud/exercises/internal/webhooks"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// toProto converts a stored book into its protobuf message
+func toProto(book models.BookStore) *bookpb.Book {
+	return &bookpb.Book{
+		Id:      book.ID,
+		Title:   book.BookName,
+		Author:  book.BookAuthor,
+		Pages:   book.BookPages,
+		Edition: book.BookEdition,
+		Year:    book.BookYear,
+	}
+}
+
+// bookServer implements bookpb.BookServiceServer on the shared store
+type bookServer struct {
+	bookpb.UnimplementedBookServiceServer
+	store store.Repository
+}
+
+func (s *bookServer) List(ctx context.Context, req *bookpb.ListBooksRequest) (*bookpb.ListBooksResponse, error) {
+	var q store.BookQuery
+	if req.GetAuthor() != "" {
+		q.Conditions = append(q.Conditions, store.Condition{Field: "author", Op: "eq", Value: req.GetAuthor()})
+	}
+	if req.GetYear() != "" {
+		q.Conditions = append(q.Conditions, store.Condition{Field: "year", Op: "eq", Value: req.GetYear()})
+	}
+	results, _, err := s.store.ListBooks(ctx, q)
+	if err != nil {
+		slog.ErrorContext(ctx, "call failed", "method", "List", "op", "ListBooks", "error", err)
+		return nil, status.Error(codes.Internal, "db error")
+	}
+	resp := &bookpb.ListBooksResponse{Books: make([]*bookpb.Book, 0, len(results))}
+	for _, res := range results {
+		resp.Books = append(resp.Books, toProto(res))
+	}
+	return resp, nil
+}
+
+// invalidBook returns an InvalidArgument status carrying the per-field
+// problems of a book as BadRequest details
+func invalidBook(errs map[string]string) error {
+	br := &errdetails.BadRequest{}
+	for field, problem := range errs {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       "book." + field,
+			Description: problem,
+		})
+	}
+	st := status.New(codes.InvalidArgument, "validation failed: "+models.DescribeProblems(errs))
+	if withDetails, err := st.WithDetails(br); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+func (s *bookServer) Get(ctx context.Context, req *bookpb.GetBookRequest) (*bookpb.Book, error) {
+	book, err := s.store.GetBook(ctx, req.GetId())
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "book not found")
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "call failed", "method", "Get", "op", "GetBook", "error", err)
+		return nil, status.Error(codes.Internal, "db error")
+	}
+	return toProto(book), nil
+}
+
+func (s *bookServer) Create(ctx context.Context, req *bookpb.CreateBookRequest) (*bookpb.Book, error) {
+	b := req.GetBook()
+	book := models.BookStore{
+		ID:          b.GetId(),
+		BookName:    b.GetTitle(),
+		BookAuthor:  b.GetAuthor(),
+		BookPages:   b.GetPages(),
+		BookEdition: b.GetEdition(),
+		BookYear:    b.GetYear(),
+	}
+	if errs := book.Validate(); len(errs) > 0 {
+		return nil, invalidBook(errs)
+	}
+	err := s.store.CreateBook(ctx, book)
+	if errors.Is(err, store.ErrDuplicate) {
+		return nil, status.Error(codes.AlreadyExists, "duplicate entry for ID: "+b.GetId())
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "call failed", "method", "Create", "op", "CreateBook", "error", err)
+		return nil, status.Error(codes.Internal, "db error inserting book")
+	}
+	return toProto(book), nil
+}
+
+func (s *bookServer) Update(ctx context.Context, req *bookpb.UpdateBookRequest) (*bookpb.Book, error) {
+	b := req.GetBook()
+	fields := map[string]string{}
+	for name, value := range map[string]string{
+		"title":   b.GetTitle(),
+		"author":  b.GetAuthor(),
+		"pages":   b.GetPages(),
+		"edition": b.GetEdition(),
+		"year":    b.GetYear(),
+	} {
+		if value != "" {
+			fields[name] = value
+		}
+	}
+	if len(fields) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no fields to update")
+	}
+	if errs := models.ValidateFields(fields); len(errs) > 0 {
+		return nil, invalidBook(errs)
+	}
+	// The proto has no revision yet, so updates are unconditional.
+	book, err := s.store.UpdateBook(ctx, req.GetId(), 0, fields)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "book not found")
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "call failed", "method", "Update", "op", "UpdateBook", "error", err)
+		return nil, status.Error(codes.Internal, "db error")
+	}
+	return toProto(book), nil
+}
+
+func (s *bookServer) Delete(ctx context.Context, req *bookpb.DeleteBookRequest) (*bookpb.DeleteBookResponse, error) {
+	err := s.store.DeleteBook(ctx, req.GetId())
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "book not found")
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "call failed", "method", "Delete", "op", "DeleteBook", "error", err)
+		return nil, status.Error(codes.Internal, "db error")
+	}
+	return &bookpb.DeleteBookResponse{}, nil
+}
+
+const (
+	// shutdownTimeout is how long running calls may take to finish once the
+	// service has been asked to stop
+	shutdownTimeout = 15 * time.Second
+	// healthInterval is how often the database is pinged for health checks
+	healthInterval = 10 * time.Second
+)
+
+// watchHealth reports the service as serving while the database can be
+// pinged, checking every healthInterval until ctx ends
+func watchHealth(ctx context.Context, hs *health.Server, st store.Repository) {
+	ticker := time.NewTicker(healthInterval)
+	defer ticker.Stop()
+	for {
+		status := healthpb.HealthCheckResponse_SERVING
+		pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		if err := st.Ping(pingCtx); err != nil {
+			slog.Warn("health check failed", "error", err)
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		cancel()
+		hs.SetServingStatus("", status)
+		hs.SetServingStatus(bookpb.BookService_ServiceDesc.ServiceName, status)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// auditCalls records the method of each call as the route of the book
+// changes it makes, and the address of the caller
+func auditCalls(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	src := audit.Source{Route: info.FullMethod}
+	if p, ok := peer.FromContext(ctx); ok {
+		src.ClientIP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(src.ClientIP); err == nil {
+			src.ClientIP = host
+		}
+	}
+	return handler(audit.WithSource(ctx, src), req)
+}
+
+func main() {
+	conf, err := config.Load("50051")
+	if err != nil {
+		logging.Fatal("failed to load configuration", "error", err)
+	}
+	if err := logging.Setup("api_grpc", conf.Log.Level, conf.Log.Format); err != nil {
+		logging.Fatal("failed to set up logging", "error", err)
+	}
+	storeConf := conf.Store()
+	ctx, cancel := context.WithTimeout(context.Background(), storeConf.ConnectRetry+20*time.Second)
+	defer cancel()
+
+	stopTracing, err := telemetry.FromEnv(ctx, "api_grpc")
+	if err != nil {
+		logging.Fatal("failed to set up tracing", "error", err)
+	}
+	defer stopTracing()
+
+	st, err := store.New(ctx, storeConf)
+	if err != nil {
+		logging.Fatal("failed to open storage", "error", err)
+	}
+	defer func() {
+		if err := st.Close(context.Background()); err != nil {
+			slog.Error("cannot close storage", "error", err)
+		}
+	}()
+
+	pubs, closeBus, err := events.PublishersFromEnv(ctx)
+	if err != nil {
+		logging.Fatal("failed to set up event publishers", "error", err)
+	}
+	defer closeBus()
+	st = audit.Wrap(st)
+	st = history.Wrap(st)
+	st = events.Wrap(st, append(pubs, webhooks.New(st))...)
+
+	opts := []grpc.ServerOption{grpc.StatsHandler(otelgrpc.NewServerHandler()), grpc.UnaryInterceptor(auditCalls)}
+	tlsConf, err := conf.Listener().TLSConfig()
+	if err != nil {
+		logging.Fatal("failed to load the TLS certificate", "error", err)
+	}
+	if tlsConf != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConf)))
+	}
+	srv := grpc.NewServer(opts...)
+	bookpb.RegisterBookServiceServer(srv, &bookServer{store: st})
+	// Reflection lets tools like grpcurl discover the service without the .proto file
+	reflection.Register(srv)
+	// The standard health service answers the probes of orchestrators.
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+
+	lis, err := conf.Listener().Listen()
+	if err != nil {
+		logging.Fatal("failed to listen", "error", err)
+	}
+	go func() {
+		slog.Info("API gRPC service starting", "addr", lis.Addr().String())
+		if err := srv.Serve(lis); err != nil {
+			logging.Fatal("cannot serve", "addr", lis.Addr().String(), "error", err)
+		}
+	}()
+
+	// On SIGINT or SIGTERM, let running calls finish before the storage is
+	// closed, but not for longer than shutdownTimeout.
+	sig, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go watchHealth(sig, hs, st)
+	<-sig.Done()
+	slog.Info("API gRPC service shutting down")
+	hs.Shutdown()
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(shutdownTimeout):
+		srv.Stop()
+	}
+}
@@ -2,126 +2,124 @@ package main
 
 import (
 	"context"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
-	"slices"
 	"time"
 
-	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"github.com/CAPS-Cloud/exercises/internal/audit"
+	"github.com/CAPS-Cloud/exercises/internal/config"
+	"github.com/CAPS-Cloud/exercises/internal/events"
+	"github.com/CAPS-Cloud/exercises/internal/handlers"
+	"github.com/CAPS-Cloud/exercises/internal/history"
+	"github.com/CAPS-Cloud/exercises/internal/logging"
+	"github.com/CAPS-Cloud/exercises/internal/lookup"
+	"github.com/CAPS-Cloud/exercises/internal/server"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/CAPS-Cloud/exercises/internal/telemetry"
+	"github.com/CAPS-Cloud/exercises/internal/webhooks"
 )
 
-// BookStore model
-type BookStore struct {
-	MongoID     primitive.ObjectID `bson:"_id,omitempty"`
-	ID          string             `bson:"ID"`
-	BookName    string             `bson:"BookName"`
-	BookAuthor  string             `bson:"BookAuthor"`
-	BookEdition string             `bson:"BookEdition"`
-	BookPages   string             `bson:"BookPages"`
-	BookYear    string             `bson:"BookYear"`
-}
-
-// prepareDatabase initializes the database and collection
-func prepareDatabase(client *mongo.Client, dbName string, collecName string) (*mongo.Collection, error) {
-	db := client.Database(dbName)
-	names, err := db.ListCollectionNames(context.TODO(), bson.D{{}})
-	if err != nil {
-		return nil, err
-	}
-	if !slices.Contains(names, collecName) {
-		cmd := bson.D{{"create", collecName}}
-		var result bson.M
-		if err = db.RunCommand(context.TODO(), cmd).Decode(&result); err != nil {
-			log.Printf("Failed to create collection: %v", err)
-			return nil, err
+// loadLoginConfig returns the login of admin and reads JWT_TTL. The
+// built-in admin is required whenever JWT_SECRET is set.
+func loadLoginConfig(secret string, admin config.Admin) handlers.LoginConfig {
+	conf := handlers.LoginConfig{
+		Username: admin.Username,
+		Password: admin.Password,
+		TTL:      24 * time.Hour,
+	}
+	if secret == "" {
+		return conf
+	}
+	if !admin.Enabled() {
+		logging.Fatal("JWT_SECRET is set but ADMIN_USERNAME or ADMIN_PASSWORD is missing")
+	}
+	if v := os.Getenv("JWT_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			logging.Fatal("invalid JWT_TTL: must be a positive duration like 1h", "value", v)
 		}
+		conf.TTL = ttl
 	}
-	coll := db.Collection(collecName)
-	return coll, nil
+	return conf
 }
 
 func main() {
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	conf, err := config.Load("3002")
+	if err != nil {
+		logging.Fatal("failed to load configuration", "error", err)
+	}
+	if err := logging.Setup("api_post_books", conf.Log.Level, conf.Log.Format); err != nil {
+		logging.Fatal("failed to set up logging", "error", err)
+	}
+	storeConf := conf.Store()
+	ctx, cancel := context.WithTimeout(context.Background(), storeConf.ConnectRetry+20*time.Second)
 	defer cancel()
 
-	uri := os.Getenv("DATABASE_URI")
-	if uri == "" {
-		log.Println("DATABASE_URI not set, using default localhost URI")
-		uri = "mongodb://localhost:27017/exercise-1?authSource=admin"
+	stopTracing, err := telemetry.FromEnv(ctx, "api_post_books")
+	if err != nil {
+		logging.Fatal("failed to set up tracing", "error", err)
 	}
+	defer stopTracing()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	secret := os.Getenv("JWT_SECRET")
+	login := loadLoginConfig(secret, conf.Admin)
+
+	st, err := store.New(ctx, storeConf)
 	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
+		logging.Fatal("failed to open storage", "error", err)
 	}
-
 	defer func() {
-		if err = client.Disconnect(ctx); err != nil {
-			log.Printf("Error disconnecting from MongoDB: %v", err)
+		if err := st.Close(context.Background()); err != nil {
+			slog.Error("cannot close storage", "error", err)
 		}
 	}()
 
-	if err := client.Ping(ctx, nil); err != nil {
-		log.Fatalf("Failed to ping MongoDB: %v", err)
-	}
-	log.Println("Successfully connected and pinged MongoDB.")
-
-	coll, err := prepareDatabase(client, "exercise-1", "information")
+	pubs, closeBus, err := events.PublishersFromEnv(ctx)
 	if err != nil {
-		log.Fatalf("Failed to prepare database: %v", err)
+		logging.Fatal("failed to set up event publishers", "error", err)
 	}
+	defer closeBus()
+	st = audit.Wrap(st)
+	st = history.Wrap(st)
+	st = events.Wrap(st, append(pubs, webhooks.New(st))...)
 
-	e := echo.New()
-	e.Use(middleware.Logger())
+	if err := st.EnsureAuthIndexes(ctx); err != nil {
+		logging.Fatal("failed to create auth indexes", "error", err)
+	}
 
-	// POST /api/books
-	e.POST("/api/books", func(c echo.Context) error {
-		var req struct {
-			ID      string `json:"id"`
-			Title   string `json:"title"`
-			Author  string `json:"author"`
-			Pages   string `json:"pages"`
-			Edition string `json:"edition"`
-			Year    string `json:"year"`
-		}
-		if err := c.Bind(&req); err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
-		}
-		// Check for duplicates (id, title, author, year, pages)
-		filter := bson.D{
-			{"ID", req.ID},
-		}
-		count, err := coll.CountDocuments(context.TODO(), filter)
-		if err != nil {
-			log.Printf("Error in POST /api/books (CountDocuments): %v", err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "db error checking duplicate ID"})
-		}
-		if count > 0 {
-			return c.JSON(http.StatusConflict, map[string]string{"error": "duplicate entry for ID: " + req.ID})
-		}
-		book := BookStore{
-			ID:          req.ID,
-			BookName:    req.Title,
-			BookAuthor:  req.Author,
-			BookPages:   req.Pages,
-			BookEdition: req.Edition,
-			BookYear:    req.Year,
-		}
-		_, err = coll.InsertOne(context.TODO(), book)
-		if err != nil {
-			log.Printf("Error in POST /api/books (InsertOne): %v", err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "db error inserting book"})
-		}
-		return c.JSON(http.StatusCreated, map[string]string{"message": "book created", "id": req.ID})
-	})
+	apiConf := handlers.Config{
+		JWTSecret: secret,
+		Login:     login,
+		MaxBooks:  conf.DB.MaxBooks,
+	}
+	lookups, err := lookup.ClientFromEnv()
+	if err != nil {
+		logging.Fatal("failed to set up metadata lookups", "error", err)
+	}
+	// Unset, OPENLIBRARY_URL and GOOGLE_BOOKS_URL default to the public
+	// APIs; set empty, they disable the routes using them.
+	if v, ok := os.LookupEnv("OPENLIBRARY_URL"); !ok {
+		apiConf.OpenLibrary = lookup.NewOpenLibrary(lookups, lookup.OpenLibraryURL)
+	} else if v != "" {
+		apiConf.OpenLibrary = lookup.NewOpenLibrary(lookups, v)
+	}
+	if v, ok := os.LookupEnv("GOOGLE_BOOKS_URL"); !ok {
+		apiConf.GoogleBooks = lookup.NewGoogleBooks(lookups, lookup.GoogleBooksURL, os.Getenv("GOOGLE_BOOKS_API_KEY"))
+	} else if v != "" {
+		apiConf.GoogleBooks = lookup.NewGoogleBooks(lookups, v, os.Getenv("GOOGLE_BOOKS_API_KEY"))
+	}
+	api := handlers.New(st, apiConf)
 
-	port := "3002"
-	log.Printf("API Post Books service starting on port %s", port)
-	e.Logger.Fatal(e.Start(":" + port))
+	e := server.New(conf.Server())
+	e.Use(telemetry.Middleware("api_post_books"))
+	server.MountHealth(e, map[string]server.Check{"database": st.Ping})
+	limit, err := server.RateLimitFromEnv()
+	if err != nil {
+		logging.Fatal("failed to set up rate limiting", "error", err)
+	}
+	if limit != nil {
+		e.Use(limit)
+	}
+	server.MountAPI(e, api.RegisterPost)
+	server.Start(e, "API Post Books", conf.Listener())
 }
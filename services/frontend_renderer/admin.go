@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/config"
+	"github.com/CAPS-Cloud/exercises/internal/handlers"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// adminKey is the context key of the user signed in to the /admin pages
+const adminKey = "admin"
+
+const (
+	// recentChanges is the number of audit entries the dashboard lists
+	recentChanges = 10
+	// adminPingTimeout bounds the database check of the dashboard
+	adminPingTimeout = 2 * time.Second
+)
+
+// registerAdmin serves the /admin pages, which run the operations that
+// cannot be undone, to the configured admin, asked for with basic auth.
+// Without an admin the pages do not exist. As browsers send the password
+// along with requests from any site, the forms carry a CSRF token. The
+// books of seedFile are what the pages seed.
+func registerAdmin(e *echo.Echo, st store.Repository, admin config.Admin, seedFile string) {
+	if !admin.Enabled() {
+		slog.Info("ADMIN_USERNAME and ADMIN_PASSWORD not set, the admin pages are disabled")
+		return
+	}
+	username, password := admin.Username, admin.Password
+	g := e.Group("/admin", middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Realm: "Bookstore admin",
+		Validator: func(u, p string, c echo.Context) (bool, error) {
+			userOK := subtle.ConstantTimeCompare([]byte(u), []byte(username)) == 1
+			passOK := subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1
+			if userOK && passOK {
+				c.Set(adminKey, u)
+			}
+			return userOK && passOK, nil
+		},
+	}), middleware.CSRFWithConfig(middleware.CSRFConfig{
+		TokenLookup:    "form:_csrf",
+		CookieName:     "_csrf",
+		CookiePath:     "/admin",
+		CookieHTTPOnly: true,
+		CookieSameSite: http.SameSiteStrictMode,
+	}))
+	g.GET("", adminPage(st))
+	// The form sends it as a POST, see server.MethodOverride
+	g.DELETE("/trash", purgeTrash(st))
+	g.POST("/seed", reseed(st, seedFile))
+	g.GET("/export.csv", exportBooks(st, "csv", "text/csv; charset=utf-8"))
+	g.GET("/export.ndjson", exportBooks(st, "ndjson", "application/x-ndjson"))
+}
+
+// adminPage serves GET /admin: the dashboard of the catalog, with its
+// totals, a histogram of the books per decade, the latest changes and
+// whether the database answers, and the forms of the admin operations. The
+// totals are computed by the database, see store.BookStats.
+func adminPage(st store.Repository) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+		stats, err := st.BookStats(ctx)
+		if err != nil {
+			logError(c, "BookStats", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to compute the statistics")
+		}
+		decades, err := st.BooksPerDecade(ctx)
+		if err != nil {
+			logError(c, "BooksPerDecade", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to compute the statistics")
+		}
+		// The bars of the histogram are relative to the largest decade.
+		var decadeMax int64
+		for _, dc := range decades {
+			decadeMax = max(decadeMax, dc.Books)
+		}
+		changes, err := st.ListAuditEntries(ctx, store.AuditQuery{Limit: recentChanges})
+		if err != nil {
+			logError(c, "ListAuditEntries", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch the recent changes")
+		}
+		// A database that does not answer is what the page should show,
+		// not an error.
+		pingCtx, cancel := context.WithTimeout(ctx, adminPingTimeout)
+		defer cancel()
+		start := time.Now()
+		health := map[string]interface{}{}
+		if err := st.Ping(pingCtx); err != nil {
+			health["Error"] = err.Error()
+		} else {
+			health["Latency"] = time.Since(start).Round(time.Microsecond).String()
+		}
+		return c.Render(http.StatusOK, "admin.html", map[string]interface{}{
+			"Flash":     takeFlash(c),
+			"CSRF":      c.Get(middleware.DefaultCSRFConfig.ContextKey),
+			"Stats":     stats,
+			"Decades":   decades,
+			"DecadeMax": decadeMax,
+			"Changes":   changes,
+			"Health":    health,
+		})
+	}
+}
+
+// purgeTrash serves DELETE /admin/trash: it deletes the books in the trash
+// for good and goes back to /admin
+func purgeTrash(st store.Repository) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		purged, err := st.PurgeBooks(auditContext(c, "DELETE /admin/trash"), store.BookQuery{})
+		if err != nil {
+			logError(c, "PurgeBooks", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to empty the trash")
+		}
+		message := strconv.Itoa(len(purged)) + " books have been deleted from the trash for good."
+		if len(purged) == 1 {
+			message = "1 book has been deleted from the trash for good."
+		}
+		setFlash(c, message)
+		return c.Redirect(http.StatusSeeOther, "/admin")
+	}
+}
+
+// reseed serves POST /admin/seed: it stores the books of seedFile, or the
+// example books, that are missing, like the services do when they start
+func reseed(st store.Repository, seedFile string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		books := store.ExampleBooks
+		if seedFile != "" {
+			var err error
+			if books, err = store.ReadSeedFile(seedFile); err != nil {
+				logError(c, "ReadSeedFile", err)
+				return echo.NewHTTPError(http.StatusInternalServerError, "The seed file cannot be read")
+			}
+		}
+		if err := store.SeedBooks(auditContext(c, "POST /admin/seed"), st, books); err != nil {
+			logError(c, "SeedBooks", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to store the seed books")
+		}
+		setFlash(c, "The missing seed books have been stored.")
+		return c.Redirect(http.StatusSeeOther, "/admin")
+	}
+}
+
+// exportBooks serves GET /admin/export.<format>: every book as a download
+// in format, see handlers.WriteBooks
+func exportBooks(st store.Repository, format, contentType string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, contentType)
+		res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="books.`+format+`"`)
+		res.WriteHeader(http.StatusOK)
+		if err := handlers.WriteBooks(c.Request().Context(), st, res, format); err != nil {
+			// The status has been sent; the download ends early.
+			logError(c, "WriteBooks", err)
+		}
+		return nil
+	}
+}
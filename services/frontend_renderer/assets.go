@@ -0,0 +1,31 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"log/slog"
+	"os"
+)
+
+// embeddedAssets are the templates, stylesheets and message catalogs of the
+// pages, built into the binary so that it runs from any directory
+//
+//go:embed views css locales
+var embeddedAssets embed.FS
+
+// loadAssets returns the files the pages are made of: those built into the
+// binary, or, if ASSETS_DIR is set, those in that directory, so that they can
+// be changed during development without rebuilding. The directory is laid
+// out like this one, with views/, css/ and locales/ in it. In dev mode it
+// defaults to the working directory, which is this one under go run.
+func loadAssets(devMode bool) fs.FS {
+	dir := os.Getenv("ASSETS_DIR")
+	if dir == "" && devMode {
+		dir = "."
+	}
+	if dir == "" {
+		return embeddedAssets
+	}
+	slog.Info("reading views, css and locales from disk", "dir", dir)
+	return os.DirFS(dir)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// feedSize is how many of the newest books /feed.atom lists
+const feedSize = 20
+
+// atomFeed is an Atom feed (RFC 4287)
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Author    atomPerson `xml:"author"`
+	Link      atomLink   `xml:"link"`
+	Summary   string     `xml:"summary"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+// bookSummary describes book in one sentence
+func bookSummary(book models.BookStore) string {
+	s := fmt.Sprintf("%s by %s", book.BookName, book.BookAuthor)
+	if book.BookYear != "" {
+		s += ", published " + book.BookYear
+	}
+	if book.BookPages != "" {
+		s += ", " + book.BookPages + " pages"
+	}
+	return s
+}
+
+// serveFeed serves GET /feed.atom: the newest books, so that users can
+// follow additions to the catalog in a feed reader. Each entry links to the
+// book in the API. Books stored before they were dated are left out.
+func serveFeed(st store.Repository) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		books, _, err := st.ListBooks(c.Request().Context(), store.BookQuery{Sort: store.SortCreated, Desc: true, Page: 1, Limit: feedSize})
+		if err != nil {
+			logError(c, "ListBooks", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "The feed is currently unavailable.")
+		}
+		base := c.Scheme() + "://" + c.Request().Host
+		feed := atomFeed{
+			ID:      base + "/feed.atom",
+			Title:   "Cloud Computing Exercise Website: new books",
+			Updated: time.Now().UTC().Format(time.RFC3339),
+			Links: []atomLink{
+				{Rel: "self", Type: "application/atom+xml", Href: base + "/feed.atom"},
+				{Rel: "alternate", Type: "text/html", Href: base + "/"},
+			},
+		}
+		for _, book := range books {
+			if book.CreatedAt == nil {
+				continue
+			}
+			created := book.CreatedAt.UTC().Format(time.RFC3339)
+			if len(feed.Entries) == 0 {
+				feed.Updated = created // the feed changes when a book is added
+			}
+			href := base + "/api/v1/books/" + url.PathEscape(book.ID)
+			feed.Entries = append(feed.Entries, atomEntry{
+				ID:        href,
+				Title:     book.BookName,
+				Published: created,
+				Updated:   created,
+				Author:    atomPerson{Name: book.BookAuthor},
+				Link:      atomLink{Rel: "alternate", Type: "application/json", Href: href},
+				Summary:   bookSummary(book),
+			})
+		}
+		data, err := xml.MarshalIndent(feed, "", "  ")
+		if err != nil {
+			logError(c, "MarshalIndent", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "The feed is currently unavailable.")
+		}
+		return c.Blob(http.StatusOK, "application/atom+xml; charset=utf-8", append([]byte(xml.Header), data...))
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/CAPS-Cloud/exercises/internal/audit"
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// flashCookie carries a message to the next page rendered, which shows it
+// once
+const flashCookie = "flash"
+
+// bookForm is the data of the book form: the values entered and the
+// problems found with them, both keyed by API field name
+type bookForm struct {
+	Values map[string]string
+	Errors map[string]string
+}
+
+// readBookForm returns the book fields posted by the form, trimmed
+func readBookForm(c echo.Context) map[string]string {
+	values := map[string]string{}
+	for _, name := range models.BookFields {
+		values[name] = strings.TrimSpace(c.FormValue(name))
+	}
+	return values
+}
+
+// setFlash leaves message for the next page
+func setFlash(c echo.Context, message string) {
+	c.SetCookie(&http.Cookie{
+		Name:     flashCookie,
+		Value:    url.QueryEscape(message),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// takeFlash returns the message left by setFlash, if any, and removes it
+func takeFlash(c echo.Context) string {
+	cookie, err := c.Cookie(flashCookie)
+	if err != nil {
+		return ""
+	}
+	c.SetCookie(&http.Cookie{Name: flashCookie, Path: "/", MaxAge: -1})
+	message, _ := url.QueryUnescape(cookie.Value)
+	return message
+}
+
+// auditContext returns the context of the request, recording the changes
+// made with it as made by the signed-in user, or admin, from the client of
+// c through route
+func auditContext(c echo.Context, route string) context.Context {
+	src := audit.Source{Route: route, ClientIP: c.RealIP()}
+	if user, ok := c.Get(adminKey).(string); ok {
+		src.Actor = user
+	} else if sess, ok := c.Get("session").(session); ok {
+		src.Actor = sess.Email
+		if src.Actor == "" {
+			src.Actor = sess.Subject
+		}
+	}
+	return audit.WithSource(c.Request().Context(), src)
+}
+
+// createBook serves POST /create: it stores the book posted by the create
+// form and redirects to /books, which shows that it was added. A book that
+// cannot be stored gets the form back with the problems found. Once
+// maxBooks books are stored, unless it is 0, no more are taken.
+func createBook(st store.Repository, maxBooks int64) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		values := readBookForm(c)
+		book := models.BookStore{
+			ID:          values["id"],
+			BookName:    values["title"],
+			BookAuthor:  values["author"],
+			BookPages:   values["pages"],
+			BookEdition: values["edition"],
+			BookYear:    values["year"],
+		}
+		errs := book.Validate()
+		if len(errs) == 0 {
+			remaining, err := store.RemainingQuota(c.Request().Context(), st, maxBooks)
+			if err != nil {
+				logError(c, "RemainingQuota", err)
+				return echo.NewHTTPError(http.StatusInternalServerError, "The book could not be saved.")
+			}
+			if remaining == 0 {
+				return echo.NewHTTPError(http.StatusForbidden, "The catalog is full, no more books can be added.")
+			}
+			err = st.CreateBook(auditContext(c, "POST /create"), book)
+			switch {
+			case errors.Is(err, store.ErrDuplicate):
+				errs["id"] = "is already taken by another book"
+			case errors.Is(err, store.ErrInvalid):
+				return echo.NewHTTPError(http.StatusUnprocessableEntity, "The book was rejected by the database schema.")
+			case err != nil:
+				logError(c, "CreateBook", err)
+				return echo.NewHTTPError(http.StatusInternalServerError, "The book could not be saved.")
+			}
+		}
+		if len(errs) > 0 {
+			// 422 makes HTMX swap the form back in, with the problems
+			return c.Render(http.StatusUnprocessableEntity, "create-form.html", bookForm{Values: values, Errors: errs})
+		}
+		setFlash(c, "\""+book.BookName+"\" has been added.")
+		return c.Redirect(http.StatusSeeOther, "/books")
+	}
+}
+
+// editFormValues returns the values of book as the edit form shows them
+func editFormValues(book models.BookStore) map[string]string {
+	values := map[string]string{"revision": strconv.FormatInt(book.Revision, 10)}
+	for name, value := range book.ToMap() {
+		if s, ok := value.(string); ok && slices.Contains(models.BookFields, name) {
+			values[name] = s
+		}
+	}
+	return values
+}
+
+// loadBook returns book :id, or the HTTP error to answer with if it cannot
+func loadBook(c echo.Context, st store.Repository) (models.BookStore, error) {
+	book, err := st.GetBook(c.Request().Context(), c.Param("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		return book, echo.NewHTTPError(http.StatusNotFound, "There is no book with this ID.")
+	}
+	if err != nil {
+		logError(c, "GetBook", err)
+		return book, echo.NewHTTPError(http.StatusInternalServerError, "Failed to load the book")
+	}
+	return book, nil
+}
+
+// editBookPage serves GET /books/:id/edit: the edit form, filled in with
+// the book as stored
+func editBookPage(st store.Repository) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		book, err := loadBook(c, st)
+		if err != nil {
+			return err
+		}
+		return c.Render(http.StatusOK, "edit-form.html", bookForm{Values: editFormValues(book)})
+	}
+}
+
+// saveBook applies the changes posted by an edit form to book :id and
+// returns the book as saved, or the form again with the problems found.
+// Like PUT /api/v1/books/:id, it only changes the book if it is still at
+// the revision the form was filled in with, so that edits made meanwhile
+// are not overwritten. Unlike there, empty pages, editions and years clear
+// the field; fields missing from the form are left as they are. Failures
+// other than problems with the form are returned as errors.
+func saveBook(c echo.Context, st store.Repository, route string) (models.BookStore, bookForm, error) {
+	id := c.Param("id")
+	form, err := c.FormParams()
+	if err != nil {
+		return models.BookStore{}, bookForm{}, echo.NewHTTPError(http.StatusBadRequest, "The form cannot be read.")
+	}
+	values := map[string]string{"id": id, "revision": form.Get("revision")}
+	fields := map[string]string{}
+	for _, name := range models.BookFields {
+		if _, ok := form[name]; ok && name != "id" {
+			fields[name] = strings.TrimSpace(form.Get(name))
+			values[name] = fields[name]
+		}
+	}
+	revision, err := strconv.ParseInt(values["revision"], 10, 64)
+	if err != nil || revision < 1 {
+		return models.BookStore{}, bookForm{}, echo.NewHTTPError(http.StatusBadRequest, "The form is missing the revision of the book.")
+	}
+	errs := models.ValidateFields(fields)
+	for _, name := range []string{"title", "author"} {
+		if value, ok := fields[name]; ok && value == "" {
+			errs[name] = "is required"
+		}
+	}
+	if len(errs) > 0 {
+		return models.BookStore{}, bookForm{Values: values, Errors: errs}, nil
+	}
+	book, err := st.UpdateBook(auditContext(c, route), id, revision, fields)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return book, bookForm{}, echo.NewHTTPError(http.StatusNotFound, "There is no book with this ID.")
+	case errors.Is(err, store.ErrConflict):
+		errs["revision"] = "The book has been changed since the form was opened. Reload the page to see the changes."
+		return book, bookForm{Values: values, Errors: errs}, nil
+	case errors.Is(err, store.ErrInvalid):
+		return book, bookForm{}, echo.NewHTTPError(http.StatusUnprocessableEntity, "The book was rejected by the database schema.")
+	case err != nil:
+		logError(c, "UpdateBook", err)
+		return book, bookForm{}, echo.NewHTTPError(http.StatusInternalServerError, "The book could not be saved.")
+	}
+	return book, bookForm{}, nil
+}
+
+// updateBook serves PUT /books/:id for the edit form, see saveBook. The
+// book is shown again once saved.
+func updateBook(st store.Repository) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		book, form, err := saveBook(c, st, "PUT /books/:id")
+		if err != nil {
+			return err
+		}
+		if len(form.Errors) > 0 {
+			return c.Render(http.StatusUnprocessableEntity, "edit-form.html", form)
+		}
+		setFlash(c, "\""+book.BookName+"\" has been saved.")
+		return c.Redirect(http.StatusSeeOther, "/books/"+url.PathEscape(book.ID))
+	}
+}
+
+// trashBook moves book :id to the trash, from which the API can restore
+// it, and returns it
+func trashBook(c echo.Context, st store.Repository, route string) (models.BookStore, error) {
+	id := c.Param("id")
+	ctx := auditContext(c, route)
+	book, err := st.GetBook(ctx, id)
+	if err == nil {
+		err = st.DeleteBook(ctx, id)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		return book, echo.NewHTTPError(http.StatusNotFound, "There is no book with this ID.")
+	}
+	if err != nil {
+		logError(c, "DeleteBook", err)
+		return book, echo.NewHTTPError(http.StatusInternalServerError, "The book could not be deleted.")
+	}
+	return book, nil
+}
+
+// deleteBook serves DELETE /books/:id for the delete button of the book
+// page
+func deleteBook(st store.Repository) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		book, err := trashBook(c, st, "DELETE /books/:id")
+		if err != nil {
+			return err
+		}
+		setFlash(c, "\""+book.BookName+"\" has been moved to the trash.")
+		return c.Redirect(http.StatusSeeOther, "/")
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+)
+
+// templateFuncs are the helpers the templates format data with, next to
+// the translation functions of translator
+var templateFuncs = template.FuncMap{
+	"truncate":   truncate,
+	"formatYear": formatYear,
+	"pluralize":  pluralize,
+	"dict":       dict,
+}
+
+// truncate shortens s to at most n characters, ending it with an ellipsis
+// if anything was cut. It takes s last so that it can end a pipeline:
+// {{ .title | truncate 40 }}.
+func truncate(n int, s string) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	if n < 1 {
+		return ""
+	}
+	return strings.TrimRightFunc(string(runes[:n-1]), func(r rune) bool { return r == ' ' }) + "…"
+}
+
+// formatYear returns a year as it is shown on pages, without the leading
+// zeros the store allows, and a dash if the year is not known
+func formatYear(year interface{}) string {
+	var y int
+	switch v := year.(type) {
+	case int:
+		y = v
+	case int64:
+		y = int(v)
+	case string:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return "–"
+		}
+		y = n
+	default:
+		return "–"
+	}
+	if y < 1 {
+		return "–"
+	}
+	return strconv.Itoa(y)
+}
+
+// pluralize returns singular if n is one and plural otherwise. n may be any
+// integer, so that counts can be passed as the handlers computed them.
+func pluralize(n interface{}, singular, plural string) (string, error) {
+	var count int64
+	switch v := n.(type) {
+	case int:
+		count = int64(v)
+	case int64:
+		count = v
+	default:
+		return "", fmt.Errorf("pluralize: %T is not a count", n)
+	}
+	if count == 1 {
+		return singular, nil
+	}
+	return plural, nil
+}
+
+// dict builds a map from its arguments, which alternate between keys and
+// values, so that a template can pass more than one value to another:
+// {{ template "field-error" dict "Label" "Title" "Error" .Errors.title }}.
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("dict: odd number of arguments")
+	}
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: key %v is not a string", pairs[i])
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// defaultLanguage is the language of pages asked for in a language there is
+// no catalog for, and of messages missing from the catalog of another one
+var defaultLanguage = language.English
+
+// catalog maps the keys of the messages of the UI to their text in one
+// language. The text may contain fmt verbs for the arguments given to t.
+type catalog map[string]string
+
+// loadCatalogs reads the message catalogs in dir of fsys, one
+// <language>.json per language, named by its BCP 47 tag
+func loadCatalogs(fsys fs.FS, dir string) (map[language.Tag]catalog, error) {
+	paths, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	catalogs := make(map[language.Tag]catalog, len(paths))
+	for _, name := range paths {
+		tag, err := language.Parse(strings.TrimSuffix(path.Base(name), ".json"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		var messages catalog
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		catalogs[tag] = messages
+	}
+	if _, ok := catalogs[defaultLanguage]; !ok {
+		return nil, fmt.Errorf("%s: no catalog for %s", dir, defaultLanguage)
+	}
+	return catalogs, nil
+}
+
+// translator returns the template functions for pages in lang: t, which
+// looks up a message and formats it with its arguments, falling back to the
+// default language and then to the key itself, and lang, which returns the
+// tag for the lang attribute of the page
+func translator(lang language.Tag, catalogs map[language.Tag]catalog) template.FuncMap {
+	return template.FuncMap{
+		"t": func(key string, args ...interface{}) string {
+			msg, ok := catalogs[lang][key]
+			if !ok {
+				msg, ok = catalogs[defaultLanguage][key]
+			}
+			if !ok {
+				msg = key
+			}
+			if len(args) == 0 {
+				return msg
+			}
+			return fmt.Sprintf(msg, args...)
+		},
+		"lang": func() string { return lang.String() },
+	}
+}
+
+// newLanguageMatcher returns a matcher that picks among the languages there
+// are catalogs for, preferring the default one when nothing matches
+func newLanguageMatcher(catalogs map[language.Tag]catalog) (language.Matcher, []language.Tag) {
+	tags := []language.Tag{defaultLanguage}
+	for tag := range catalogs {
+		if tag != defaultLanguage {
+			tags = append(tags, tag)
+		}
+	}
+	return language.NewMatcher(tags), tags
+}
@@ -2,151 +2,543 @@ package main
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
 	"io"
-	"log"
+	"io/fs"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
-	"slices"
+	"strings"
 	"time"
 
+	"github.com/CAPS-Cloud/exercises/internal/audit"
+	"github.com/CAPS-Cloud/exercises/internal/config"
+	"github.com/CAPS-Cloud/exercises/internal/events"
+	"github.com/CAPS-Cloud/exercises/internal/history"
+	"github.com/CAPS-Cloud/exercises/internal/logging"
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/server"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/CAPS-Cloud/exercises/internal/telemetry"
+	"github.com/CAPS-Cloud/exercises/internal/webhooks"
+	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/oauth2"
+	"golang.org/x/text/language"
 )
 
-// BookStore model
-type BookStore struct {
-	MongoID     primitive.ObjectID `bson:"_id,omitempty"`
-	ID          string             `bson:"ID"`
-	BookName    string             `bson:"BookName"`
-	BookAuthor  string             `bson:"BookAuthor"`
-	BookEdition string             `bson:"BookEdition"`
-	BookPages   string             `bson:"BookPages"`
-	BookYear    string             `bson:"BookYear"`
+// favicon is served at /favicon.ico so browsers stop producing 404s in the logs.
+//
+//go:embed favicon.ico
+var favicon []byte
+
+// pageContentSecurityPolicy lets the pages load what the templates use:
+// htmx and Swagger UI from unpkg, the font of Google Fonts, the scripts and
+// style attributes written into the templates and the data: images of
+// Swagger UI. The books stream and the partials come from the same origin.
+const pageContentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline' https://unpkg.com; " +
+	"style-src 'self' 'unsafe-inline' https://unpkg.com https://fonts.googleapis.com; " +
+	"font-src 'self' https://fonts.gstatic.com; " +
+	"img-src 'self' data:; " +
+	"frame-ancestors 'none'"
+
+// templateSet holds the templates parsed once per language there is a
+// message catalog for
+type templateSet struct {
+	tmpl    map[language.Tag]*template.Template
+	tags    []language.Tag
+	matcher language.Matcher
+}
+
+func parseTemplates(assets fs.FS) (*templateSet, error) {
+	catalogs, err := loadCatalogs(assets, "locales")
+	if err != nil {
+		return nil, err
+	}
+	set := &templateSet{tmpl: make(map[language.Tag]*template.Template, len(catalogs))}
+	set.matcher, set.tags = newLanguageMatcher(catalogs)
+	for _, tag := range set.tags {
+		tmpl, err := template.New("").Funcs(templateFuncs).Funcs(translator(tag, catalogs)).ParseFS(assets, "views/*.html")
+		if err != nil {
+			return nil, err
+		}
+		set.tmpl[tag] = tmpl
+	}
+	return set, nil
 }
 
-// Template renderer
+// Template renderer. Each page is rendered in the language that best matches
+// the Accept-Language header of the request. The templates are parsed once at
+// startup, or, with reload, again for every page so that changes to them
+// show without restarting.
 type Template struct {
-	tmpl *template.Template
+	assets fs.FS
+	reload bool
+	set    *templateSet
 }
 
-func loadTemplates() *Template {
-	// Assume templates are in a 'views' directory relative to the binary
-	return &Template{
-		tmpl: template.Must(template.ParseGlob("views/*.html")),
+func loadTemplates(assets fs.FS, reload bool) *Template {
+	set, err := parseTemplates(assets)
+	if err != nil {
+		logging.Fatal("failed to load templates", "error", err)
 	}
+	return &Template{assets: assets, reload: reload, set: set}
 }
 
 func (t *Template) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
-	return t.tmpl.ExecuteTemplate(w, name, data)
+	set := t.set
+	if t.reload {
+		var err error
+		if set, err = parseTemplates(t.assets); err != nil {
+			return err
+		}
+	}
+	accepted, _, _ := language.ParseAcceptLanguage(c.Request().Header.Get("Accept-Language"))
+	_, i, _ := set.matcher.Match(accepted...)
+	lang := set.tags[i]
+	c.Response().Header().Add(echo.HeaderVary, "Accept-Language")
+	c.Response().Header().Set("Content-Language", lang.String())
+	return set.tmpl[lang].ExecuteTemplate(w, name, data)
 }
 
-// prepareDatabase initializes the database and collection
-func prepareDatabase(client *mongo.Client, dbName string, collecName string) (*mongo.Collection, error) {
-	db := client.Database(dbName)
-	names, err := db.ListCollectionNames(context.TODO(), bson.D{{}})
+// findAllBooks retrieves all books, at most MaxResults of them
+func findAllBooks(ctx context.Context, st store.Repository) ([]map[string]interface{}, error) {
+	books, _, err := st.ListBooks(ctx, store.BookQuery{})
 	if err != nil {
 		return nil, err
 	}
-	if !slices.Contains(names, collecName) {
-		cmd := bson.D{{"create", collecName}}
-		var result bson.M
-		if err = db.RunCommand(context.TODO(), cmd).Decode(&result); err != nil {
-			log.Printf("Failed to create collection: %v", err)
-			return nil, err
-		}
+	ret := make([]map[string]interface{}, 0, len(books))
+	for _, book := range books {
+		ret = append(ret, book.ToMap())
 	}
-	coll := db.Collection(collecName)
-	return coll, nil
+	return ret, nil
+}
+
+// session is the signed-in user of the web UI, stored in the session cookie
+type session struct {
+	Subject string `json:"sub"`
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Expires int64  `json:"exp"`
+}
+
+// Names of the cookies set by the OIDC login flow
+const (
+	sessionCookie = "bookstore_session"
+	stateCookie   = "bookstore_oidc_state"
+)
+
+// sessionTTL is how long a sign-in stays valid
+const sessionTTL = 12 * time.Hour
+
+// oidcAuth signs users of the web UI in through an OpenID Connect provider.
+// Sessions are kept client-side in an HMAC-signed cookie.
+type oidcAuth struct {
+	verifier    *oidc.IDTokenVerifier
+	config      oauth2.Config
+	secret      []byte // signs the session and state cookies
+	defaultRole string // of sign-ins without a user, see sessionRole
 }
 
-// findAllBooks retrieves all books from the collection
-func findAllBooks(coll *mongo.Collection) ([]map[string]interface{}, error) {
-	cursor, err := coll.Find(context.TODO(), bson.D{{}})
+// newOIDCAuth discovers the provider from OIDC_ISSUER and reads
+// OIDC_CLIENT_ID, OIDC_CLIENT_SECRET, OIDC_REDIRECT_URL, SESSION_SECRET and
+// OIDC_DEFAULT_ROLE, which defaults to editor.
+// It returns nil when OIDC_ISSUER is not set, which leaves the UI open. That
+// is refused while JWT_SECRET protects the write endpoints of the APIs, as
+// the pages would otherwise change books without any sign-in.
+func newOIDCAuth(ctx context.Context) (*oidcAuth, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		if os.Getenv("JWT_SECRET") != "" {
+			return nil, errors.New("JWT_SECRET is set but OIDC_ISSUER is not, the pages that change books would be open")
+		}
+		return nil, nil
+	}
+	clientID := os.Getenv("OIDC_CLIENT_ID")
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	secret := os.Getenv("SESSION_SECRET")
+	if clientID == "" || redirectURL == "" || secret == "" {
+		return nil, errors.New("OIDC_ISSUER is set but OIDC_CLIENT_ID, OIDC_REDIRECT_URL or SESSION_SECRET is missing")
+	}
+	defaultRole := os.Getenv("OIDC_DEFAULT_ROLE")
+	if defaultRole == "" {
+		defaultRole = models.RoleEditor
+	}
+	if !models.ValidRole(defaultRole) {
+		return nil, fmt.Errorf("OIDC_DEFAULT_ROLE %q is not viewer, editor or admin", defaultRole)
+	}
+	provider, err := oidc.NewProvider(ctx, issuer)
 	if err != nil {
 		return nil, err
 	}
-	var results []BookStore
-	if err = cursor.All(context.TODO(), &results); err != nil {
-		return nil, err
+	return &oidcAuth{
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  redirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+		secret:      []byte(secret),
+		defaultRole: defaultRole,
+	}, nil
+}
+
+// sign returns value followed by its HMAC so that it can be stored in a cookie
+func (a *oidcAuth) sign(value []byte) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write(value)
+	return base64.RawURLEncoding.EncodeToString(value) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify returns the value of a cookie produced by sign, or false if it was
+// tampered with
+func (a *oidcAuth) verify(cookie string) ([]byte, bool) {
+	encValue, encMAC, ok := strings.Cut(cookie, ".")
+	if !ok {
+		return nil, false
+	}
+	value, err := base64.RawURLEncoding.DecodeString(encValue)
+	if err != nil {
+		return nil, false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(encMAC)
+	if err != nil {
+		return nil, false
+	}
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write(value)
+	return value, hmac.Equal(got, mac.Sum(nil))
+}
+
+// currentSession returns the unexpired session of the request, if any
+func (a *oidcAuth) currentSession(c echo.Context) (session, bool) {
+	var sess session
+	cookie, err := c.Cookie(sessionCookie)
+	if err != nil {
+		return sess, false
+	}
+	value, ok := a.verify(cookie.Value)
+	if !ok || json.Unmarshal(value, &sess) != nil {
+		return sess, false
+	}
+	return sess, time.Now().Unix() < sess.Expires
+}
+
+// login serves GET /login: it redirects to the provider and remembers in a
+// short-lived cookie where to return afterwards
+func (a *oidcAuth) login(c echo.Context) error {
+	state := make([]byte, 16)
+	if _, err := rand.Read(state); err != nil {
+		logError(c, "rand.Read", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Sign-in is currently unavailable.")
+	}
+	stateValue, _ := json.Marshal(map[string]string{
+		"state": hex.EncodeToString(state),
+		"next":  safeRedirect(c.QueryParam("next")),
+	})
+	c.SetCookie(&http.Cookie{
+		Name:     stateCookie,
+		Value:    a.sign(stateValue),
+		Path:     "/",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return c.Redirect(http.StatusFound, a.config.AuthCodeURL(hex.EncodeToString(state)))
+}
+
+// callback serves GET /auth/callback: it exchanges the authorization code,
+// verifies the ID token and starts a session
+func (a *oidcAuth) callback(c echo.Context) error {
+	var pending struct {
+		State string `json:"state"`
+		Next  string `json:"next"`
+	}
+	cookie, err := c.Cookie(stateCookie)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Sign-in expired, please try again.")
+	}
+	value, ok := a.verify(cookie.Value)
+	if !ok || json.Unmarshal(value, &pending) != nil || pending.State != c.QueryParam("state") {
+		return echo.NewHTTPError(http.StatusBadRequest, "Sign-in expired, please try again.")
+	}
+	c.SetCookie(&http.Cookie{Name: stateCookie, Path: "/", MaxAge: -1})
+
+	ctx := c.Request().Context()
+	token, err := a.config.Exchange(ctx, c.QueryParam("code"))
+	if err != nil {
+		logError(c, "Exchange", err)
+		return echo.NewHTTPError(http.StatusUnauthorized, "Sign-in failed.")
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		logError(c, "Exchange", errors.New("token response has no id_token"))
+		return echo.NewHTTPError(http.StatusUnauthorized, "Sign-in failed.")
+	}
+	idToken, err := a.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		logError(c, "Verify", err)
+		return echo.NewHTTPError(http.StatusUnauthorized, "Sign-in failed.")
+	}
+	var sess session
+	if err := idToken.Claims(&sess); err != nil {
+		logError(c, "Claims", err)
+		return echo.NewHTTPError(http.StatusUnauthorized, "Sign-in failed.")
+	}
+	// The session outlives the ID token, whose exp claim was decoded above
+	sess.Expires = time.Now().Add(sessionTTL).Unix()
+
+	sessValue, _ := json.Marshal(sess)
+	c.SetCookie(&http.Cookie{
+		Name:     sessionCookie,
+		Value:    a.sign(sessValue),
+		Path:     "/",
+		MaxAge:   int(sessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	return c.Redirect(http.StatusFound, pending.Next)
+}
+
+// logout serves GET /logout
+func (a *oidcAuth) logout(c echo.Context) error {
+	c.SetCookie(&http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	return c.Redirect(http.StatusFound, "/")
+}
+
+// requireSession gates pages that change data behind a signed-in session.
+// HTMX requests are redirected with HX-Redirect so that the whole page moves
+// to the provider instead of swapping it into #page-content. Without OIDC
+// configured, which newOIDCAuth only allows while JWT_SECRET is not set
+// either, every request is let through.
+func (a *oidcAuth) requireSession(next echo.HandlerFunc) echo.HandlerFunc {
+	if a == nil {
+		return next
+	}
+	return func(c echo.Context) error {
+		if sess, ok := a.currentSession(c); ok {
+			c.Set("session", sess)
+			return next(c)
+		}
+		if c.Request().Header.Get("HX-Request") == "true" {
+			// Fragments cannot be reloaded on their own, so come back to the page
+			c.Response().Header().Set("HX-Redirect", "/login")
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		return c.Redirect(http.StatusFound, "/login?next="+url.QueryEscape(c.Request().URL.RequestURI()))
+	}
+}
+
+// sessionRole returns the role of sess: that of the API user named like its
+// email address, as added through POST /api/v1/admin/users, or else the
+// default role of sign-ins
+func (a *oidcAuth) sessionRole(ctx context.Context, st store.Repository, sess session) (string, error) {
+	if sess.Email == "" {
+		return a.defaultRole, nil
 	}
+	user, err := st.FindUser(ctx, sess.Email)
+	if errors.Is(err, store.ErrNotFound) {
+		return a.defaultRole, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return user.Role, nil
+}
 
-	var ret []map[string]interface{}
-	for _, res := range results {
-		ret = append(ret, map[string]interface{}{
-			"id":      res.ID,
-			"title":   res.BookName,
-			"author":  res.BookAuthor,
-			"pages":   res.BookPages,
-			"edition": res.BookEdition,
-			"year":    res.BookYear,
+// requireRole gates pages behind a signed-in session, see requireSession,
+// whose role grants need, like the roles of the API: editors create and
+// change books, only admins move them to the trash.
+func (a *oidcAuth) requireRole(st store.Repository, need string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if a == nil {
+			return next
+		}
+		return a.requireSession(func(c echo.Context) error {
+			role, err := a.sessionRole(c.Request().Context(), st, c.Get("session").(session))
+			if err != nil {
+				logError(c, "FindUser", err)
+				return echo.NewHTTPError(http.StatusInternalServerError, "Sign-in is currently unavailable.")
+			}
+			if !models.HasRole(role, need) {
+				return echo.NewHTTPError(http.StatusForbidden, "Your account is not allowed to do this.")
+			}
+			return next(c)
 		})
 	}
+}
+
+// safeRedirect only allows local paths as post-login targets
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// searchBooks returns the books whose title or author contains q, ignoring
+// case: those matching by title first, then those matching only by author
+func searchBooks(ctx context.Context, st store.Repository, q string) ([]map[string]interface{}, error) {
+	found := map[string]bool{}
+	ret := []map[string]interface{}{}
+	for _, field := range []string{"title", "author"} {
+		books, _, err := st.ListBooks(ctx, store.BookQuery{Conditions: []store.Condition{{Field: field, Op: "contains", Value: q}}})
+		if err != nil {
+			return nil, err
+		}
+		for _, book := range books {
+			if !found[book.ID] {
+				found[book.ID] = true
+				ret = append(ret, book.ToMap())
+			}
+		}
+	}
 	return ret, nil
 }
 
+// logError logs that the operation op failed while rendering c
+func logError(c echo.Context, op string, err error) {
+	slog.ErrorContext(c.Request().Context(), "request failed",
+		"method", c.Request().Method, "route", c.Path(), "op", op, "error", err)
+}
+
 func main() {
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	conf, err := config.Load("3005")
+	if err != nil {
+		logging.Fatal("failed to load configuration", "error", err)
+	}
+	if err := logging.Setup("frontend_renderer", conf.Log.Level, conf.Log.Format); err != nil {
+		logging.Fatal("failed to set up logging", "error", err)
+	}
+	storeConf := conf.Store()
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeConf.ConnectRetry+20*time.Second)
 	defer cancel()
 
-	uri := os.Getenv("DATABASE_URI")
-	if uri == "" {
-		log.Println("DATABASE_URI not set, using default localhost URI")
-		uri = "mongodb://localhost:27017/exercise-1?authSource=admin"
+	stopTracing, err := telemetry.FromEnv(ctx, "frontend_renderer")
+	if err != nil {
+		logging.Fatal("failed to set up tracing", "error", err)
 	}
+	defer stopTracing()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	st, err := store.New(ctx, storeConf)
 	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
+		logging.Fatal("failed to open storage", "error", err)
 	}
-
 	defer func() {
-		if err = client.Disconnect(ctx); err != nil {
-			log.Printf("Error disconnecting from MongoDB: %v", err)
+		if err := st.Close(context.Background()); err != nil {
+			slog.Error("cannot close storage", "error", err)
 		}
 	}()
 
-	if err := client.Ping(ctx, nil); err != nil {
-		log.Fatalf("Failed to ping MongoDB: %v", err)
+	// Books created and edited through the pages are logged and announced
+	// like those changed through the APIs.
+	pubs, closeBus, err := events.PublishersFromEnv(ctx)
+	if err != nil {
+		logging.Fatal("failed to set up event publishers", "error", err)
 	}
-	log.Println("Successfully connected and pinged MongoDB.")
+	defer closeBus()
+	st = audit.Wrap(st)
+	st = history.Wrap(st)
+	st = events.Wrap(st, append(pubs, webhooks.New(st))...)
 
-	coll, err := prepareDatabase(client, "exercise-1", "information")
+	auth, err := newOIDCAuth(ctx)
 	if err != nil {
-		log.Fatalf("Failed to prepare database: %v", err)
+		logging.Fatal("failed to set up OIDC login", "error", err)
+	}
+	if auth == nil {
+		slog.Warn("OIDC_ISSUER not set, pages that change data are not protected")
+	}
+
+	devMode := os.Getenv("DEV_MODE") == "true"
+	if devMode {
+		slog.Warn("DEV_MODE set, templates are parsed again for every page")
 	}
+	e := newServer(conf, st, auth, devMode)
+	server.Start(e, "Frontend Renderer", conf.Listener())
+}
 
-	e := echo.New()
-	e.Use(middleware.Logger())
+// newServer sets up the pages on top of st, served as conf says. Pages that
+// change data need a session of auth with a role that allows it, if auth is
+// not nil. In dev mode the templates are parsed again for every page.
+func newServer(conf config.Config, st store.Repository, auth *oidcAuth, devMode bool) *echo.Echo {
+	e := server.New(conf.Server())
+	e.Pre(server.MethodOverride())
+	e.Use(server.ContentSecurityPolicy(pageContentSecurityPolicy))
+	e.Use(telemetry.Middleware("frontend_renderer"))
+	server.MountHealth(e, map[string]server.Check{"database": st.Ping})
 
 	// Renderer setup
-	e.Renderer = loadTemplates()
+	assets := loadAssets(devMode)
+	e.Renderer = loadTemplates(assets, devMode)
+	server.ErrorPages(e, func(c echo.Context, status int, message string) error {
+		data := map[string]interface{}{
+			"Status":    status,
+			"Title":     http.StatusText(status),
+			"Message":   message,
+			"RequestID": logging.RequestID(c.Request().Context()),
+		}
+		if c.Request().Header.Get("HX-Request") == "true" {
+			return c.Render(status, "error-message", data)
+		}
+		return c.Render(status, "error.html", data)
+	})
 
-	// Static files - assume 'css' directory relative to binary
-	e.Static("/css", "css")
+	// Static files
+	e.StaticFS("/css", echo.MustSubFS(assets, "css"))
+
+	e.GET("/favicon.ico", func(c echo.Context) error {
+		return c.Blob(http.StatusOK, "image/x-icon", favicon)
+	})
+
+	// Swagger UI for the OpenAPI document served by api_get_books
+	e.GET("/docs", func(c echo.Context) error {
+		return c.Render(http.StatusOK, "docs.html", map[string]string{"SpecURL": "/api/v1/openapi.json"})
+	})
+
+	e.GET("/feed.atom", serveFeed(st))
 
 	e.GET("/", func(c echo.Context) error {
-		return c.Render(http.StatusOK, "index", nil) // Ensure correct template name
+		return c.Render(http.StatusOK, "index", map[string]interface{}{"Flash": takeFlash(c)})
 	})
 
-	e.GET("/books", func(c echo.Context) error {
-		books, err := findAllBooks(coll)
+	e.GET("/books", booksPage(st))
+
+	e.GET("/books/:id", func(c echo.Context) error {
+		book, err := st.GetBook(c.Request().Context(), c.Param("id"))
+		if errors.Is(err, store.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "There is no book with this ID.")
+		}
 		if err != nil {
-			log.Printf("Error in GET /books (findAllBooks): %v", err)
-			return c.Render(http.StatusInternalServerError, "error.html", map[string]string{"message": "Failed to load books"})
+			logError(c, "GetBook", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to load the book")
 		}
-		return c.Render(http.StatusOK, "book-table", books) // Ensure correct template name
+		return c.Render(http.StatusOK, "book-detail", map[string]interface{}{"Book": book.ToMap(), "Flash": takeFlash(c)})
 	})
+	e.GET("/books/:id/edit", editBookPage(st), auth.requireRole(st, models.RoleEditor))
+	// The edit and delete forms send these as POSTs, see server.MethodOverride
+	e.PUT("/books/:id", updateBook(st), auth.requireRole(st, models.RoleEditor))
+	e.DELETE("/books/:id", deleteBook(st), auth.requireRole(st, models.RoleAdmin))
 
 	e.GET("/authors", func(c echo.Context) error {
-		books, err := findAllBooks(coll)
+		books, err := findAllBooks(c.Request().Context(), st)
 		if err != nil {
-			log.Printf("Error in GET /authors (findAllBooks): %v", err)
-			return c.Render(http.StatusInternalServerError, "error.html", map[string]string{"message": "Failed to load authors"})
+			logError(c, "findAllBooks", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to load authors")
 		}
 
 		authorSet := make(map[string]struct{})
@@ -163,37 +555,45 @@ func main() {
 	})
 
 	e.GET("/years", func(c echo.Context) error {
-		books, err := findAllBooks(coll)
+		years, err := bookYears(c.Request().Context(), st)
 		if err != nil {
-			log.Printf("Error in GET /years (findAllBooks): %v", err)
-			return c.Render(http.StatusInternalServerError, "error.html", map[string]string{"message": "Failed to load years"})
-		}
-		yearSet := make(map[string]struct{})
-		for _, book := range books {
-			if year, ok := book["year"].(string); ok {
-				yearSet[year] = struct{}{}
-			}
-		}
-		var years []string
-		for year := range yearSet {
-			years = append(years, year)
+			logError(c, "bookYears", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to load years")
 		}
 		return c.Render(http.StatusOK, "years.html", map[string]interface{}{"Years": years})
 	})
+	e.GET("/years/:year", yearPage(st))
+	registerPartials(e.Group("/partials"), st, auth)
+	registerAdmin(e, st, conf.Admin, conf.DB.SeedFile)
 
-	// The original main.go had /search and /create, keeping /search for now.
-	// /create returned NoContent, which might not be suitable for a frontend route.
-	// If /search needs a specific template, it should be created.
-	// For now, let's assume search.html exists or it's handled by client-side.
+	// The search bar, and below it the books whose title or author contains
+	// q; while typing, only the results are swapped
 	e.GET("/search", func(c echo.Context) error {
-		// Assuming search-bar.html is the correct template name from the original `main.go`
-		return c.Render(http.StatusOK, "search-bar.html", nil)
+		q := strings.TrimSpace(c.QueryParam("q"))
+		data := map[string]interface{}{"Q": q}
+		if q != "" {
+			books, err := searchBooks(c.Request().Context(), st, q)
+			if err != nil {
+				logError(c, "searchBooks", err)
+				return echo.NewHTTPError(http.StatusInternalServerError, "Search is currently unavailable.")
+			}
+			data["Books"] = books
+		}
+		return c.Render(http.StatusOK, "search-bar", data)
 	})
-	// e.GET("/create", func(c echo.Context) error {
-	// 	return c.NoContent(http.StatusNoContent)
-	// })
+	e.GET("/create", func(c echo.Context) error {
+		if err := c.Render(http.StatusOK, "create-form.html", bookForm{}); err != nil {
+			logError(c, "Render", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "The create form is currently unavailable.")
+		}
+		return nil
+	}, auth.requireRole(st, models.RoleEditor))
+	e.POST("/create", createBook(st, conf.DB.MaxBooks), auth.requireRole(st, models.RoleEditor))
 
-	port := "3005"
-	log.Printf("Frontend Renderer service starting on port %s", port)
-	e.Logger.Fatal(e.Start(":" + port))
+	if auth != nil {
+		e.GET("/login", auth.login)
+		e.GET("/auth/callback", auth.callback)
+		e.GET("/logout", auth.logout)
+	}
+	return e
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CAPS-Cloud/exercises/internal/config"
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// get serves GET target with the pages on top of an empty store, without
+// sign-in
+func get(t *testing.T, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	e := newServer(config.Config{}, store.NewMemory(), nil, false)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func TestFavicon(t *testing.T) {
+	rec := get(t, "/favicon.ico")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /favicon.ico = %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "image/") {
+		t.Errorf("Content-Type = %q, want an image", ct)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), favicon) {
+		t.Errorf("served %d bytes, want the %d of favicon.ico", rec.Body.Len(), len(favicon))
+	}
+}
+
+func TestCreateForm(t *testing.T) {
+	rec := get(t, "/create")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /create = %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want HTML", ct)
+	}
+	page := rec.Body.String()
+	for _, field := range []string{"id", "title", "author", "pages", "edition", "year"} {
+		if !strings.Contains(page, `name="`+field+`"`) {
+			t.Errorf("the create form has no %s field", field)
+		}
+	}
+}
+
+// TestOpenPagesNeedOpenAPIs checks that the pages only go without sign-in
+// while the APIs do too
+func TestOpenPagesNeedOpenAPIs(t *testing.T) {
+	t.Setenv("OIDC_ISSUER", "")
+	t.Setenv("JWT_SECRET", "")
+	if auth, err := newOIDCAuth(context.Background()); auth != nil || err != nil {
+		t.Fatalf("newOIDCAuth without JWT_SECRET = %v, %v, want no sign-in", auth, err)
+	}
+	t.Setenv("JWT_SECRET", "secret")
+	if _, err := newOIDCAuth(context.Background()); err == nil {
+		t.Fatal("newOIDCAuth with JWT_SECRET but no OIDC_ISSUER succeeded")
+	}
+}
+
+// TestDeleteNeedsAdmin checks that signed-in editors change books through
+// the pages but only admins move them to the trash
+func TestDeleteNeedsAdmin(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	for _, id := range []string{"1", "2"} {
+		if err := st.CreateBook(ctx, models.BookStore{ID: id, BookName: "Frankenstein", BookAuthor: "Mary Shelley"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.InsertUser(ctx, &models.User{Username: "ada@example.com", Role: models.RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	auth := &oidcAuth{secret: []byte("test"), defaultRole: models.RoleEditor}
+	e := newServer(config.Config{}, st, auth, false)
+	request := func(method, target, email string) int {
+		req := httptest.NewRequest(method, target, nil)
+		if email != "" {
+			value, _ := json.Marshal(session{Subject: email, Email: email, Expires: time.Now().Add(time.Hour).Unix()})
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: auth.sign(value)})
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		method, target, email string
+		want                  int
+	}{
+		{http.MethodDelete, "/books/1", "", http.StatusFound}, // to /login
+		{http.MethodGet, "/books/1/edit", "bob@example.com", http.StatusOK},
+		{http.MethodDelete, "/books/1", "bob@example.com", http.StatusForbidden},
+		{http.MethodDelete, "/partials/book-row/1", "bob@example.com", http.StatusForbidden},
+		{http.MethodDelete, "/books/1", "ada@example.com", http.StatusSeeOther},
+		{http.MethodDelete, "/partials/book-row/2", "ada@example.com", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := request(tt.method, tt.target, tt.email); got != tt.want {
+			t.Errorf("%s %s as %q = %d, want %d", tt.method, tt.target, tt.email, got, tt.want)
+		}
+	}
+}
+
+func TestCreateOverQuota(t *testing.T) {
+	st := store.NewMemory()
+	if err := st.CreateBook(context.Background(), models.BookStore{ID: "1", BookName: "Frankenstein", BookAuthor: "Mary Shelley"}); err != nil {
+		t.Fatal(err)
+	}
+	var conf config.Config
+	conf.DB.MaxBooks = 1
+	e := newServer(conf, st, nil, false)
+	form := url.Values{"id": {"2"}, "title": {"The Last Man"}, "author": {"Mary Shelley"}}
+	req := httptest.NewRequest(http.MethodPost, "/create", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("POST /create over quota = %d, want 403", rec.Code)
+	}
+	if _, err := st.GetBook(context.Background(), "2"); err == nil {
+		t.Error("POST /create stored a book over the quota")
+	}
+}
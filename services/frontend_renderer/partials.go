@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/CAPS-Cloud/exercises/internal/models"
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// The routes under /partials answer with a single piece of a page rather
+// than the page itself, for htmx to swap in place: the book table, and a row
+// of it that can be turned into a form, saved and deleted on its own.
+func registerPartials(g *echo.Group, st store.Repository, auth *oidcAuth) {
+	g.GET("/book-table", bookTablePartial(st))
+	g.GET("/book-row/:id", bookRowPartial(st))
+	g.GET("/book-row/:id/edit", editBookRowPartial(st), auth.requireRole(st, models.RoleEditor))
+	g.PUT("/book-row/:id", updateBookRowPartial(st), auth.requireRole(st, models.RoleEditor))
+	g.DELETE("/book-row/:id", deleteBookRowPartial(st), auth.requireRole(st, models.RoleAdmin))
+}
+
+// bookTablePartial serves GET /partials/book-table: the book table alone,
+// taking the same parameters as GET /books
+func bookTablePartial(st store.Repository) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		data, err := bookTable(c, st)
+		if err != nil {
+			return err
+		}
+		return c.Render(http.StatusOK, "book-table", data)
+	}
+}
+
+// bookRowPartial serves GET /partials/book-row/:id: the row of the book
+// table showing the book, which also puts a row back when editing it is
+// cancelled
+func bookRowPartial(st store.Repository) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		book, err := loadBook(c, st)
+		if err != nil {
+			return err
+		}
+		return c.Render(http.StatusOK, "book-row", book.ToMap())
+	}
+}
+
+// editBookRowPartial serves GET /partials/book-row/:id/edit: the row of the
+// book turned into a form
+func editBookRowPartial(st store.Repository) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		book, err := loadBook(c, st)
+		if err != nil {
+			return err
+		}
+		return c.Render(http.StatusOK, "book-row-edit", bookForm{Values: editFormValues(book)})
+	}
+}
+
+// updateBookRowPartial serves PUT /partials/book-row/:id for the form of
+// editBookRowPartial, see saveBook. It answers with the saved row, or with
+// the form and the problems found in it with status 422.
+func updateBookRowPartial(st store.Repository) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		book, form, err := saveBook(c, st, "PUT /partials/book-row/:id")
+		if err != nil {
+			return err
+		}
+		if len(form.Errors) > 0 {
+			return c.Render(http.StatusUnprocessableEntity, "book-row-edit", form)
+		}
+		return c.Render(http.StatusOK, "book-row", book.ToMap())
+	}
+}
+
+// deleteBookRowPartial serves DELETE /partials/book-row/:id: it moves the
+// book to the trash and answers with nothing, which htmx swaps in for the
+// row
+func deleteBookRowPartial(st store.Repository) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if _, err := trashBook(c, st, "DELETE /partials/book-row/:id"); err != nil {
+			return err
+		}
+		return c.HTML(http.StatusOK, "")
+	}
+}
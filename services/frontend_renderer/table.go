@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// booksPerPage is how many books a page of the book table shows
+const booksPerPage = 50
+
+// tableColumns are the columns of the book table, by the API field they are
+// sorted by, with the catalog key of their heading
+var tableColumns = []struct{ Field, Label string }{
+	{"title", "book.title"},
+	{"author", "book.author"},
+	{"edition", "book.edition"},
+	{"pages", "book.pages"},
+}
+
+// tableColumn is a heading of the book table. Href sorts the table by the
+// column, in the order opposite to the current one if it is already sorted
+// by it; Order is that current order, "" if it is sorted otherwise. Label
+// is translated by the template.
+type tableColumn struct {
+	Label string
+	Href  string
+	Order string
+}
+
+// booksURL returns the address of a page of the book table, leaving out
+// the parameters at their default
+func booksURL(sort, order string, page int64) string {
+	params := url.Values{}
+	if sort != "" {
+		params.Set("sort", sort)
+	}
+	if order == "desc" {
+		params.Set("order", order)
+	}
+	if page > 1 {
+		params.Set("page", strconv.FormatInt(page, 10))
+	}
+	if len(params) == 0 {
+		return "/books"
+	}
+	return "/books?" + params.Encode()
+}
+
+// bookTable returns the data of a page of the book table, sorted by ?sort=
+// in ?order=, with links to the other pages. Unknown sort fields and pages
+// out of range are replaced by the defaults instead of failing the page.
+func bookTable(c echo.Context, st store.Repository) (map[string]interface{}, error) {
+	q := store.BookQuery{Page: 1, Limit: booksPerPage}
+	sort, order := "", "asc"
+	for _, col := range tableColumns {
+		if col.Field == c.QueryParam("sort") {
+			sort = col.Field
+		}
+	}
+	if sort != "" && c.QueryParam("order") == "desc" {
+		order = "desc"
+	}
+	q.Sort, q.Desc = sort, order == "desc"
+	if page, err := strconv.ParseInt(c.QueryParam("page"), 10, 64); err == nil && page > 1 {
+		q.Page = page
+	}
+
+	ctx := c.Request().Context()
+	books, total, err := st.ListBooks(ctx, q)
+	pages := max(1, (total+booksPerPage-1)/booksPerPage)
+	if err == nil && q.Page > pages {
+		q.Page = pages
+		books, total, err = st.ListBooks(ctx, q)
+	}
+	if err != nil {
+		logError(c, "ListBooks", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to load books")
+	}
+
+	rows := make([]map[string]interface{}, 0, len(books))
+	for _, book := range books {
+		rows = append(rows, book.ToMap())
+	}
+	columns := make([]tableColumn, 0, len(tableColumns))
+	for _, col := range tableColumns {
+		column := tableColumn{Label: col.Label, Href: booksURL(col.Field, "asc", 1)}
+		if col.Field == sort {
+			column.Order = order
+			if order == "asc" {
+				column.Href = booksURL(col.Field, "desc", 1)
+			}
+		}
+		columns = append(columns, column)
+	}
+	data := map[string]interface{}{
+		"Books":   rows,
+		"Columns": columns,
+		"Self":    booksURL(sort, order, q.Page),
+		"Page":    q.Page,
+		"Pages":   pages,
+		"Total":   total,
+	}
+	if q.Page > 1 {
+		data["Prev"] = booksURL(sort, order, q.Page-1)
+	}
+	if q.Page < pages {
+		data["Next"] = booksURL(sort, order, q.Page+1)
+	}
+	return data, nil
+}
+
+// booksPage serves GET /books: a page of the book table, see bookTable,
+// with the pager below it
+func booksPage(st store.Repository) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		data, err := bookTable(c, st)
+		if err != nil {
+			return err
+		}
+		data["Flash"] = takeFlash(c)
+		// The download button sits above the table; its reloads only take the table.
+		return c.Render(http.StatusOK, "books-page", data)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/CAPS-Cloud/exercises/internal/store"
+	"github.com/labstack/echo/v4"
+)
+
+// compareYears orders years by their number rather than as text, so that
+// 999 comes before 2000
+func compareYears(a, b string) int {
+	x, errX := strconv.Atoi(a)
+	y, errY := strconv.Atoi(b)
+	if errX != nil || errY != nil {
+		return cmp.Compare(a, b)
+	}
+	return cmp.Compare(x, y)
+}
+
+// bookYears returns the years the books were published in, earliest first
+func bookYears(ctx context.Context, st store.Repository) ([]string, error) {
+	years, err := st.Distinct(ctx, "year")
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(years, compareYears)
+	return years, nil
+}
+
+// adjacentYears returns the years next to year among years, which are
+// sorted: the latest before it and the earliest after it, "" where there
+// is none. year itself need not be among them.
+func adjacentYears(years []string, year string) (prev, next string) {
+	i, found := slices.BinarySearchFunc(years, year, compareYears)
+	if i > 0 {
+		prev = years[i-1]
+	}
+	if found {
+		i++
+	}
+	if i < len(years) {
+		next = years[i]
+	}
+	return prev, next
+}
+
+// yearPage serves GET /years/:year: the books published in the year, with
+// links to the years before and after it that have books
+func yearPage(st store.Repository) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		year := c.Param("year")
+		if _, err := strconv.ParseUint(year, 10, 32); err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, "There is no such year.")
+		}
+		ctx := c.Request().Context()
+		books, _, err := st.ListBooks(ctx, store.BookQuery{Year: year})
+		if err != nil {
+			logError(c, "ListBooks", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to load the books of the year")
+		}
+		years, err := bookYears(ctx, st)
+		if err != nil {
+			logError(c, "bookYears", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to load the books of the year")
+		}
+		rows := make([]map[string]interface{}, 0, len(books))
+		for _, book := range books {
+			rows = append(rows, book.ToMap())
+		}
+		prev, next := adjacentYears(years, year)
+		return c.Render(http.StatusOK, "year.html", map[string]interface{}{
+			"Year":  year,
+			"Books": rows,
+			"Prev":  prev,
+			"Next":  next,
+		})
+	}
+}